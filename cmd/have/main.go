@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path"
+	"sort"
 	"strings"
 	"syscall"
 
@@ -63,6 +64,31 @@ func paths() (gopath, srcpath string) {
 	return
 }
 
+func printWarnings(manager *have.PkgManager, pkg *have.Package) {
+	for _, w := range pkg.Warnings() {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", w.PrettyString(manager.Fset))
+	}
+}
+
+func warningNames() []string {
+	var names []string
+	for name := range have.WarningNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Warnings enabled with the -warn flag, exits on unknown ones.
+func enabledWarnings() have.WarningSet {
+	ws, err := have.ParseWarnings(*warnings)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	return ws
+}
+
 func trans(args []string) {
 	var pkgs, files []string
 	for _, arg := range args {
@@ -78,6 +104,8 @@ func trans(args []string) {
 	var locator = NewFilesystemPkgLocator(srcpath)
 
 	manager := have.NewPkgManager(locator)
+	manager.Warnings = enabledWarnings()
+	manager.BuiltinErrorf = *builtinErrorf
 
 	for _, pkgName := range pkgs {
 		pkg, errs := manager.Load(pkgName)
@@ -94,6 +122,8 @@ func trans(args []string) {
 			os.Exit(1)
 		}
 
+		printWarnings(manager, pkg)
+
 		for _, f := range pkg.Files {
 			if f.Name == have.BuiltinsFileName {
 				continue
@@ -171,6 +201,8 @@ func run(args []string) {
 	}
 
 	manager := have.NewPkgManager(locator)
+	manager.Warnings = enabledWarnings()
+	manager.BuiltinErrorf = *builtinErrorf
 
 	pkg, errs := manager.Load("main")
 
@@ -186,6 +218,8 @@ func run(args []string) {
 		os.Exit(1)
 	}
 
+	printWarnings(manager, pkg)
+
 	tmpDir, err := ioutil.TempDir("", "hav")
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error creating temporary dir: %s", err)
@@ -222,6 +256,9 @@ func run(args []string) {
 }
 
 var toStdout = flag.CommandLine.Bool("stdout", false, "Print results to stdout rather than files")
+var warnings = flag.CommandLine.String("warn", "", "Comma-separated list of opt-in warnings to report: "+
+	strings.Join(warningNames(), ", ")+", or all")
+var builtinErrorf = flag.CommandLine.Bool("builtin-errorf", false, "Provide the errorf(format, args...) builtin, translated to fmt.Errorf")
 
 func main() {
 	flag.Usage = func() {
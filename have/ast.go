@@ -3,6 +3,7 @@ package have
 import (
 	"bytes"
 	"fmt"
+	"strings"
 
 	gotoken "go/token"
 )
@@ -96,7 +97,7 @@ func (s *TopLevelStmt) Decls() []string {
 		result = append(result, stmt.Name())
 	case *GenericStruct:
 		result = append(result, stmt.Name())
-	case *ImportStmt, *AssignStmt, *SendStmt, *SwitchStmt, *ExprStmt, *IfStmt, *ForStmt, *ForRangeStmt, *BranchStmt, *LabelStmt:
+	case *ImportStmt, *AssignStmt, *SendStmt, *IncDecStmt, *SwitchStmt, *ExprStmt, *IfStmt, *ForStmt, *ForRangeStmt, *BranchStmt, *LabelStmt:
 	case declStmt:
 		// TODO: Tests are leaking, add an interface to prevent this
 		result = stmt.Decls()
@@ -129,6 +130,11 @@ type Variable struct {
 	Type Type
 
 	init Expr
+	// Declared with `const`, init is then a constant expression.
+	isConst bool
+	// Declared with `const` without a type. The constant stays untyped
+	// if its initializer is untyped too, Type is then its default type.
+	untyped bool
 }
 
 func (o *Variable) Name() string           { return o.name }
@@ -222,12 +228,15 @@ type GenericParamTypeDecl struct {
 func (g *GenericParamTypeDecl) Name() string           { return g.name }
 func (g *GenericParamTypeDecl) ObjectType() ObjectType { return OBJECT_GENERIC_TYPE }
 
-var builtinTypeNames []string = []string{"bool", "byte", "complex128", "complex64", "error", "float32",
+var builtinTypeNames []string = []string{"bool", "byte", "complex128", "complex64", "float32",
 	"float64", "int", "int16", "int32", "int64", "int8", "rune",
 	"string", "uint", "uint16", "uint32", "uint64", "uint8", "uintptr"}
 
 var builtinTypes map[string]*TypeDecl = map[string]*TypeDecl{}
 
+// Name of the predeclared constraint satisfied by comparable types.
+const comparableConstraint = "comparable"
+
 func initVarDecls() {
 	for _, name := range builtinTypeNames {
 		builtinTypes[name] = &TypeDecl{
@@ -235,6 +244,30 @@ func initVarDecls() {
 			AliasedType: nil, // Simple types aren't aliases
 		}
 	}
+	// Alias for the empty interface, usable both as a type and as a constraint.
+	builtinTypes["any"] = &TypeDecl{
+		name:        "any",
+		AliasedType: &IfaceType{Keys: []string{}, Methods: map[string]*FuncDecl{}},
+	}
+	// The predeclared error interface. Like in declared interfaces, the
+	// methods are shared by the declaration and the interface type.
+	errorMethods := map[string]*FuncDecl{
+		"Error": &FuncDecl{
+			name: "Error",
+			typ:  &FuncType{Args: []Type{}, Results: []Type{&SimpleType{ID: SIMPLE_TYPE_STRING}}},
+		},
+	}
+	builtinTypes["error"] = &TypeDecl{
+		name:        "error",
+		AliasedType: &IfaceType{Keys: []string{"Error"}, Methods: errorMethods},
+		Methods:     errorMethods,
+	}
+	// Predeclared constraint satisfied by all comparable types. Unlike `any`, it
+	// can't be used as an ordinary type.
+	builtinTypes[comparableConstraint] = &TypeDecl{
+		name:        comparableConstraint,
+		AliasedType: &IfaceType{Keys: []string{}, Methods: map[string]*FuncDecl{}, comparable: true},
+	}
 }
 
 func GetBuiltinType(name string) (*TypeDecl, bool) {
@@ -268,6 +301,13 @@ type SendStmt struct {
 	Lhs, Rhs Expr
 }
 
+// implements SimpleStmt
+type IncDecStmt struct {
+	stmt
+	X     Expr
+	Token *Token
+}
+
 // implements Stmt
 type StructStmt struct {
 	stmt
@@ -303,6 +343,10 @@ type VarStmt struct {
 	stmt
 	Vars       DeclChain
 	IsFuncStmt bool
+	IsConst    bool
+	// Variables of a short variable declaration that were already declared
+	// in the same scope, they're just assigned new values.
+	Reused map[*Variable]bool
 }
 
 // Chain of variable declarations. Sample uses:
@@ -423,11 +467,27 @@ type ReturnStmt struct {
 	Values []Expr
 }
 
+// Defers a function call until the surrounding function returns.
+type DeferStmt struct {
+	stmt
+
+	Call *FuncCallExpr
+}
+
+// Runs a function call in a new goroutine.
+type GoStmt struct {
+	stmt
+
+	Call *FuncCallExpr
+}
+
 // Compiler macros are an internal mechanism for generating special-case
 // Go code, like Go's builtin functions. Placing "__compiler_macro" in a
 // function causes every call to this function to be replaced with the macro.
 // Macros can use %tN and %aN in their format string to put N-th generic
 // type parameter or N-th function argument in the generated code.
+// String literals following the format string are paths of Go packages that
+// the expansion refers to, e.g. __compiler_macro("fmt.Errorf(%a0)", "fmt").
 // Compiler macros are activated by the type checker, so a macro in an
 // inactive "when" statement branch does nothing.
 type compilerMacro struct {
@@ -435,6 +495,9 @@ type compilerMacro struct {
 
 	Active bool
 	Args   []Expr
+	// Go packages that the expansion refers to, files using the macro
+	// import them in the generated code.
+	goImports []string
 }
 
 type Generic interface {
@@ -442,6 +505,8 @@ type Generic interface {
 
 	// Name of the generic + names of the params.
 	Signature() (name string, params []string)
+	// Constraints of the params, nil entries are unconstrained.
+	Constraints() []Type
 	Instantiate(tc *TypesContext, params ...Type) (Object, string, []error)
 	Code() []rune
 	// Imports that should be used when parsing instantiation of the generic.
@@ -469,8 +534,13 @@ type GenericStruct struct {
 
 func (gs *GenericStruct) Name() string                  { return gs.struc.Name }
 func (gs *GenericStruct) Signature() (string, []string) { return gs.struc.Name, gs.params }
+func (gs *GenericStruct) Constraints() []Type           { return gs.struc.GenericConstraints }
 func (gs *GenericStruct) ObjectType() ObjectType        { return OBJECT_GENERIC }
 func (gs *GenericStruct) Instantiate(tc *TypesContext, params ...Type) (Object, string, []error) {
+	if err := checkConstraints(gs, params); err != nil {
+		return nil, "", []error{err}
+	}
+
 	// First, check if we've already been here and it's cached.
 	instKey := NewInstKey(gs, params)
 	i, ok := tc.instantiations[instKey]
@@ -510,8 +580,13 @@ type GenericFunc struct {
 
 func (gf *GenericFunc) Name() string                  { return gf.Func.name }
 func (gf *GenericFunc) Signature() (string, []string) { return gf.Func.name, gf.params }
+func (gf *GenericFunc) Constraints() []Type           { return gf.Func.GenericConstraints }
 func (gf *GenericFunc) ObjectType() ObjectType        { return OBJECT_GENERIC }
 func (gf *GenericFunc) Instantiate(tc *TypesContext, params ...Type) (Object, string, []error) {
+	if err := checkConstraints(gf, params); err != nil {
+		return nil, "", []error{err}
+	}
+
 	// First, check if we've already been here and it's cached.
 	instKey := NewInstKey(gf, params)
 	i, ok := tc.instantiations[instKey]
@@ -672,7 +747,6 @@ const (
 	SIMPLE_TYPE_BYTE
 	SIMPLE_TYPE_COMPLEX128
 	SIMPLE_TYPE_COMPLEX64
-	SIMPLE_TYPE_ERROR
 	SIMPLE_TYPE_FLOAT32
 	SIMPLE_TYPE_FLOAT64
 	SIMPLE_TYPE_INT
@@ -695,7 +769,6 @@ var simpleTypeAsStr = map[SimpleTypeID]string{
 	SIMPLE_TYPE_BYTE:       "byte",
 	SIMPLE_TYPE_COMPLEX128: "complex128",
 	SIMPLE_TYPE_COMPLEX64:  "complex64",
-	SIMPLE_TYPE_ERROR:      "error",
 	SIMPLE_TYPE_FLOAT32:    "float32",
 	SIMPLE_TYPE_FLOAT64:    "float64",
 	SIMPLE_TYPE_INT:        "int",
@@ -740,8 +813,22 @@ func (t *SimpleType) ZeroValue() string {
 }
 func (t *SimpleType) MapSubtypes(callback func(t Type) bool) {}
 
+// Returns the ID of the type that t is an alias of, byte and rune
+// are just other names for uint8 and int32.
+func (t *SimpleType) aliasedID() SimpleTypeID {
+	switch t.ID {
+	case SIMPLE_TYPE_BYTE:
+		return SIMPLE_TYPE_UINT8
+	case SIMPLE_TYPE_RUNE:
+		return SIMPLE_TYPE_INT32
+	}
+	return t.ID
+}
+
+// Tells if t can hold results of boolean expressions, like comparisons.
+// Named types based on bool can hold them too.
 func IsBoolAssignable(t Type) bool {
-	return IsAssignable(&SimpleType{SIMPLE_TYPE_BOOL}, t)
+	return IsAssignable(&SimpleType{SIMPLE_TYPE_BOOL}, t) || IsTypeBool(RootType(t))
 }
 func IsTypeBool(t Type) bool {
 	return t.Kind() == KIND_SIMPLE && t.(*SimpleType).ID == SIMPLE_TYPE_BOOL
@@ -767,6 +854,17 @@ func IsTypeIntKind(t Type) bool {
 	}
 	return false
 }
+func IsTypeUnsigned(t Type) bool {
+	if t.Kind() != KIND_SIMPLE {
+		return false
+	}
+	switch t.(*SimpleType).ID {
+	case SIMPLE_TYPE_UINT8, SIMPLE_TYPE_UINT16, SIMPLE_TYPE_UINT32, SIMPLE_TYPE_UINT64, SIMPLE_TYPE_UINT,
+		SIMPLE_TYPE_UINTPTR, SIMPLE_TYPE_BYTE:
+		return true
+	}
+	return false
+}
 func IsTypeFloatKind(t Type) bool {
 	if t.Kind() != KIND_SIMPLE {
 		return false
@@ -787,18 +885,30 @@ func IsTypeComplexType(t Type) bool {
 	}
 	return false
 }
+func IsTypeFloatingPoint(t Type) bool {
+	return IsTypeFloatKind(t) || IsTypeComplexType(t)
+}
 func IsTypeNumeric(t Type) bool {
 	return IsTypeIntKind(t) || IsTypeFloatKind(t) || IsTypeComplexType(t) || IsTypeSimple(t, SIMPLE_TYPE_RUNE)
 }
 
+// Size of arrays declared with `[...]`, it's inferred from the literal
+// initializing the array.
+const ArraySizeInferred = -1
+
 type ArrayType struct {
 	Size int
 	Of   Type
 }
 
-func (t *ArrayType) Known() bool    { return t.Of.Known() }
-func (t *ArrayType) String() string { return fmt.Sprintf("[%d]%s", t.Size, t.Of.String()) }
-func (t *ArrayType) Kind() Kind     { return KIND_ARRAY }
+func (t *ArrayType) Known() bool { return t.Size != ArraySizeInferred && t.Of.Known() }
+func (t *ArrayType) String() string {
+	if t.Size == ArraySizeInferred {
+		return "[...]" + t.Of.String()
+	}
+	return fmt.Sprintf("[%d]%s", t.Size, t.Of.String())
+}
+func (t *ArrayType) Kind() Kind { return KIND_ARRAY }
 func (t *ArrayType) ZeroValue() string {
 	b := bytes.Buffer{}
 	b.WriteString(fmt.Sprintf("%s{", t))
@@ -864,6 +974,9 @@ func (t *FuncType) Header() string {
 	out := &bytes.Buffer{}
 	out.WriteString("(")
 	for c, a := range t.Args {
+		if t.Ellipsis && c == len(t.Args)-1 {
+			out.WriteString("...")
+		}
 		out.WriteString(a.String())
 		if (c + 1) < len(t.Args) {
 			out.WriteString(", ")
@@ -967,19 +1080,36 @@ func (t *TupleType) MapSubtypes(callback func(t Type) bool) { mapSubtypes(t.Memb
 type StructType struct {
 	Members map[string]Type
 	// Keys of the Members map in the order of declaration
-	Keys    []string
-	Methods map[string]*FuncDecl
-	Name    string
+	Keys []string
+	// Members declared without a name, e.g. `Base` or `*Base`. They're
+	// keyed by the name of their type.
+	Embedded map[string]bool
+	Methods  map[string]*FuncDecl
+	Name     string
 	// Names of generic type paramaters. Nil for standard structs.
 	GenericParams []string
+	// Constraints of generic type parameters, nil for unconstrained ones.
+	GenericConstraints []Type
 	// Values of generic parameters. Nil for standard structs.
 	GenericParamVals []Type
 
 	selfType *CustomType
 }
 
+// Returns the type of the n-th member, methods aren't counted.
 func (t *StructType) GetTypeN(n int) Type {
-	return t.Members[t.Keys[n]]
+	return t.Members[t.MemberKeys()[n]]
+}
+
+// Names of members in the order of declaration, without methods.
+func (t *StructType) MemberKeys() []string {
+	keys := make([]string, 0, len(t.Members))
+	for _, k := range t.Keys {
+		if _, ok := t.Members[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	return keys
 }
 
 func (t *StructType) Known() bool {
@@ -994,15 +1124,21 @@ func (t *StructType) Known() bool {
 func (t *StructType) String() string {
 	out := &bytes.Buffer{}
 	out.WriteString("struct {")
-	for i, k := range t.Keys {
+	written := 0
+	for _, k := range t.Keys {
 		if _, ok := t.Members[k]; !ok {
 			// Not a plain member, but a method
 			continue
 		}
-		fmt.Fprintf(out, "%s %s", k, t.Members[k].String())
-		if (i + 1) < len(t.Members) {
+		if written > 0 {
 			out.Write([]byte("; "))
 		}
+		if t.Embedded[k] {
+			out.WriteString(t.Members[k].String())
+		} else {
+			fmt.Fprintf(out, "%s %s", k, t.Members[k].String())
+		}
+		written++
 	}
 	out.WriteByte('}')
 	return out.String()
@@ -1020,23 +1156,58 @@ type IfaceType struct {
 	// Keys in the order of declaration
 	Keys    []string
 	Methods map[string]*FuncDecl
-	name    string
+	// Unions of types permitted by the interface, one for each line, e.g.
+	// `~int | ~float64`. A type has to be in all of them. Nil for interfaces
+	// without type set elements (they permit any type).
+	TypeSet [][]*TypeSetTerm
+	// Interfaces embedded in this one, e.g. `Stringer`. The parser can't
+	// tell them apart from single type terms, they're moved here from TypeSet
+	// by embedIfaces once type names are bound.
+	Embedded []Type
+	name     string
+	// True for the predeclared `comparable` constraint and interfaces
+	// embedding it.
+	comparable bool
+	// TypeSet together with unions of embedded interfaces, filled by
+	// embedIfaces.
+	allUnions [][]*TypeSetTerm
+	// Set once embedIfaces processed the interface.
+	embedsDone bool
+}
+
+// A single element of a union in an interface's type set.
+type TypeSetTerm struct {
+	// True for `~T` terms, which permit all types with T as their underlying type.
+	Tilde bool
+	Type  Type
+}
+
+func (t *TypeSetTerm) String() string {
+	if t.Tilde {
+		return "~" + t.Type.String()
+	}
+	return t.Type.String()
 }
 
 func (t *IfaceType) Known() bool { return true }
 func (t *IfaceType) Kind() Kind  { return KIND_INTERFACE }
 
 func (t *IfaceType) String() string {
-	out := &bytes.Buffer{}
-	out.WriteString("interface{")
-	for i, k := range t.Keys {
-		fmt.Fprintf(out, "%s%s", t.Methods[k].name, t.Methods[k].typ.Header())
-		if (i + 1) < len(t.Methods) {
-			out.Write([]byte("; "))
+	var elems []string
+	for _, e := range t.Embedded {
+		elems = append(elems, e.String())
+	}
+	for _, union := range t.TypeSet {
+		terms := make([]string, len(union))
+		for i, term := range union {
+			terms[i] = term.String()
 		}
+		elems = append(elems, strings.Join(terms, " | "))
 	}
-	out.WriteByte('}')
-	return out.String()
+	for _, k := range t.Keys {
+		elems = append(elems, t.Methods[k].name+t.Methods[k].typ.Header())
+	}
+	return "interface{" + strings.Join(elems, "; ") + "}"
 }
 
 func (t *IfaceType) ZeroValue() string                      { return "nil" }
@@ -1079,7 +1250,10 @@ func (t *CustomType) PackagePtr() *ImportStmt {
 	return t.Package
 }
 
-type UnknownType struct{}
+type UnknownType struct {
+	// Set for the type of `nil` before it's known what kind of nil it is.
+	fromNil bool
+}
 
 func (t *UnknownType) Known() bool                            { return false }
 func (t *UnknownType) String() string                         { return "_" }
@@ -1117,6 +1291,12 @@ type BasicLit struct {
 	expr
 
 	token *Token
+	// Set for literals directly preceded by a unary minus, so that
+	// their value can be checked for overflows correctly.
+	negated bool
+	// Value of string literals with escape sequences decoded. The token
+	// keeps the literal as written, it's used for code generation.
+	value string
 }
 
 type CompoundLitKind int
@@ -1219,6 +1399,8 @@ type FuncCallExpr struct {
 
 	// nil unless Left refers to a function
 	fn *FuncDecl
+	// Innermost function containing the call, nil outside functions.
+	caller *FuncDecl
 }
 
 // implements PrimaryExpr
@@ -1239,12 +1421,26 @@ type FuncDecl struct {
 	PtrReceiver bool
 	// Names of generic type paramaters. Nil for standard functions.
 	GenericParams []string
+	// Constraints of generic type parameters, nil for unconstrained ones.
+	GenericConstraints []Type
 	// Values of generic parameters. Nil for standard functions.
 	GenericParamVals []Type
+	// True if the function is called directly by a defer statement.
+	Deferred bool
 
 	compilerMacros []*compilerMacro
 }
 
+// Tells whether results of the function are named, bare returns are only
+// allowed in such functions.
+func (fd *FuncDecl) hasNamedResults() bool {
+	named := false
+	fd.Results.eachPair(func(v *Variable, init Expr) {
+		named = named || v.name != ""
+	})
+	return named
+}
+
 // implements PrimaryExpr
 type Ident struct {
 	expr
@@ -1,6 +1,9 @@
 package have
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 import gotoken "go/token"
 
@@ -31,3 +34,98 @@ func (ce *CompileError) PrettyString(fset *gotoken.FileSet) string {
 	position := fset.Position(ce.Pos)
 	return fmt.Sprintf("%s:%d: %s", position.Filename, position.Line, ce.Message)
 }
+
+// Short description of an expression, used to point users to the offending
+// code in error messages.
+func describeExpr(e Expr) string {
+	switch e := e.(type) {
+	case *Ident:
+		return fmt.Sprintf("`%s`", e.name)
+	case *NilExpr:
+		return "`nil`"
+	case *BasicLit:
+		return fmt.Sprintf("literal `%v`", e.token.Value)
+	case *CompoundLit:
+		return "composite literal"
+	case *DotSelector:
+		return fmt.Sprintf("selector `.%s`", e.Right.name)
+	case *FuncCallExpr:
+		return fmt.Sprintf("call of %s", describeExpr(e.Left))
+	case *FuncDecl:
+		return "function literal"
+	}
+	return "expression"
+}
+
+// Spells out simple expressions the way they were written, for error messages.
+// Returns false if the expression is too complex to be worth repeating.
+func exprSource(e Expr) (string, bool) {
+	switch e := e.(type) {
+	case *Ident:
+		return e.name, true
+	case *NilExpr:
+		return "nil", true
+	case *BasicLit:
+		return fmt.Sprintf("%v", e.token.Value), true
+	case *DotSelector:
+		left, ok := exprSource(e.Left)
+		return left + "." + e.Right.name, ok
+	case *BinaryOp:
+		left, okLeft := exprSource(e.Left)
+		right, okRight := exprSource(e.Right)
+		return fmt.Sprintf("%s %v %s", left, e.op.Value, right), okLeft && okRight
+	}
+	return "", false
+}
+
+// Like Type.String(), but spells out types that are not known at all.
+func describeType(t Type) string {
+	if t == nil || t.Kind() == KIND_UNKNOWN {
+		return "unknown"
+	}
+	return t.String()
+}
+
+// Suggests a fix for converting `arg` of type `from` to `to` that failed,
+// the result is appended to the error message. Returns an empty string
+// if there's nothing to suggest.
+func conversionHint(arg Expr, from, to Type) string {
+	rootFrom, rootTo := RootType(from), RootType(to)
+
+	switch {
+	case to.Kind() == KIND_POINTER && rootFrom.Kind() == KIND_ARRAY:
+		if src, ok := exprSource(arg); ok {
+			return fmt.Sprintf(", use the address operator instead: `&%s`", src)
+		}
+		return ", use the address operator instead"
+	case IsTypeString(rootFrom) && IsTypeIntKind(rootTo):
+		return ", use strconv.Atoi to parse integers"
+	}
+
+	fromStruct, ok1 := rootFrom.(*StructType)
+	toStruct, ok2 := rootTo.(*StructType)
+	if ok1 && ok2 {
+		fields := differingFields(fromStruct, toStruct)
+		if len(fields) == 0 {
+			return ", fields are declared in a different order"
+		}
+		return fmt.Sprintf(", fields differ: %s", strings.Join(fields, ", "))
+	}
+	return ""
+}
+
+// Lists fields that are missing in one of the structs, or have different types.
+func differingFields(a, b *StructType) []string {
+	result := []string{}
+	for _, name := range a.MemberKeys() {
+		if typ, ok := b.Members[name]; !ok || !IsIdentincal(typ, a.Members[name]) {
+			result = append(result, name)
+		}
+	}
+	for _, name := range b.MemberKeys() {
+		if _, ok := a.Members[name]; !ok {
+			result = append(result, name)
+		}
+	}
+	return result
+}
@@ -41,12 +41,19 @@ func TestErrors(t *testing.T) {
 			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
 func main() {
 	var x int = "aaa"
-}`}}, []string{"a.hav:3: Can't use this literal for type int"},
+}`}}, []string{"a.hav:3: Can't use a string literal as int"},
 		},
 
 		{
 			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
-~`}}, []string{"a.hav:2: Unexpected token (expected a primary expression): TOKEN_UNEXP_CHAR"},
+func main() {
+	var x bool = 1.5
+}`}}, []string{"a.hav:3: Can't use a float literal as bool"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+$`}}, []string{"a.hav:2: Unexpected token (expected a primary expression): TOKEN_UNEXP_CHAR"},
 		},
 
 		{
@@ -62,6 +69,719 @@ func main() {
 	somethingUnknown[int]()
 }`}}, []string{"a.hav:3: Unknown identifier: somethingUnknown"},
 		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f() int {
+	var x = 1
+	return somethingUnknown.member
+}`}}, []string{"a.hav:4: Unknown identifier: somethingUnknown"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	somethingUnknown = 1
+}`}}, []string{"a.hav:3: Unknown identifier: somethingUnknown"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+struct T {
+	func *Mutate() {
+		pass
+	}
+}
+func getVal() T {
+	return T{}
+}
+func main() {
+	getVal().Mutate()
+}`}}, []string{"a.hav:11: Cannot call pointer method Mutate on a non-addressable value of type T"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+struct Base {
+	func *Mutate() {
+		pass
+	}
+}
+struct T {
+	Base
+}
+func main() {
+	T{}.Mutate()
+}`}}, []string{"a.hav:11: Cannot call pointer method Mutate on a non-addressable value of type T"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var x = 10.0 % 3.0
+}`}}, []string{"a.hav:3: Operator % not defined on float64"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var x int8 = 0xFF
+}`}}, []string{"a.hav:3: Constant 0xFF overflows int8"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var x = int(true)
+}`}}, []string{"a.hav:3: Impossible conversion from bool to int"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f() (int, int) {
+	return 1, 2
+}
+func main() {
+	var a, b, c int
+	a, b, c = f()
+}`}}, []string{"a.hav:7: Assignment mismatch: 3 variables but call of `f` returns 2 values"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f() (int, int) {
+	return 1, 2
+}
+func main() {
+	var i interface{} = f()
+}`}}, []string{"a.hav:6: Multiple-value call of `f` in single-value context"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var s = "1"
+	var i = int(s)
+}`}}, []string{"a.hav:4: Impossible conversion from string to int, use strconv.Atoi to parse integers"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+struct A { x int; y string; z int }
+struct B { x int; y int; w int }
+func main() {
+	var a A
+	var b = B(a)
+}`}}, []string{"a.hav:6: Impossible conversion from A to B, fields differ: y, z, w"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+struct A { x []byte; y int }
+struct B { x []uint8; y string }
+func main() {
+	var a A
+	var b = B(a)
+}`}}, []string{"a.hav:6: Impossible conversion from A to B, fields differ: y"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+struct A { x int; y string }
+struct B { y string; x int }
+func main() {
+	var a A
+	var b = B(a)
+}`}}, []string{"a.hav:6: Impossible conversion from A to B, fields are declared in a different order"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+struct T {
+	x int
+	func M() {
+		pass
+	}
+}
+struct U { x int }
+func main() {
+	var u U
+	u.M()
+}`}}, []string{"a.hav:11: No such member: M (M is a method of T, not U)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	blah(123)
+}`}}, []string{"a.hav:3: Unknown identifier: blah"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var blah = 1
+	var x = blah(123)
+}`}}, []string{"a.hav:4: blah is neither a type nor a function, it's a value of type int"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f(a int, b string, c int) { pass }
+func g() (int, string) { return 1, "a" }
+func main() {
+	go f(g())
+}`}}, []string{"a.hav:5: Too few arguments in call of `f`: got 2 from call of `g`, want 3 (func(int, string, int))"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var x = 1
+	var a = x << -1
+	var b = x << 1.5
+}`}}, []string{"a.hav:4: Invalid shift count -1, it must be a non-negative integer"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+    if true {
+        var a = 1
+      var b = 2
+    }
+}`}}, []string{"a.hav:5: Inconsistent dedent, indentation doesn't match any outer level"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+struct T { x int; y string; z bool }
+func main() {
+	var t = T{1, "a"}
+}`}}, []string{"a.hav:4: Type has 3 members, but literal has just 2 (missing: z)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+const x = int8(100)
+func main() {
+	const y = x * 2
+}`}}, []string{"a.hav:4: Constant 200 overflows int8"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+const (
+	a int8 = iota * 100
+	b
+)
+const (
+	c int8 = 100 + iota * 27
+	d
+	e
+)`}}, []string{"a.hav:7: Constant 154 overflows int8"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var a = int8(1000)
+}`}}, []string{"a.hav:3: Constant 1000 overflows int8"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+const big = 1 << 100
+const small = big >> 98
+func main() {
+	var a = small
+	var b = big
+}`}}, []string{"a.hav:6: Constant 1267650600228229401496703205376 overflows int"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+const x = 1 << 2000`}}, []string{"a.hav:2: Constant overflow, `1 << 2000` exceeds 512 bits"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+const y = 1 << 400
+const z = y * y`}}, []string{"a.hav:3: Constant overflow, `y * y` exceeds 512 bits"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var x = 1 << 2000
+}`}}, []string{"a.hav:3: Constant overflow, `1 << 2000` exceeds 512 bits"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+const (
+	a int
+)`}}, []string{"a.hav:2: Missing value in const declaration of a"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+const x = int64(5)
+func main() {
+	x = 6
+}`}}, []string{"a.hav:4: Cannot assign to x, it's a constant"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `#!/usr/bin/have
+package a
+func main() {
+	print(x)
+}`}}, []string{"a.hav:4: Unknown identifier: x"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f(a int, b string) {
+	pass
+}
+func main() {
+	f(1)
+}`}}, []string{"a.hav:6: Too few arguments in call of `f`: got 1, want 2 (func(int, string))"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f(a int, b string) {
+	pass
+}
+func main() {
+	f(1, "a", 2)
+}`}}, []string{"a.hav:6: Too many arguments in call of `f`: got 3, want 2 (func(int, string))"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f(a int, b string, c ...int) {
+	pass
+}
+func main() {
+	f(1)
+}`}}, []string{"a.hav:6: Too few arguments in call of `f`: got 1, want at least 2 (func(int, string, ...int))"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f(a int, b string, c ...int) {
+	pass
+}
+func main() {
+	var xs []int
+	f(1, xs...)
+}`}}, []string{"a.hav:7: Too few arguments in call of `f`: got 2, want 3 (func(int, string, ...int))"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f(a int) int {
+	return a
+}
+func main() {
+	var x = f(1, 2)
+}`}}, []string{"a.hav:6: Too many arguments in call of `f`: got 2, want 1 (func(int) int)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f[T](a T, b T) T {
+	return a
+}
+func main() {
+	var x = f(1)
+}`}}, []string{"a.hav:6: Too few arguments in call of `f`: got 1, want 2 (func(T, T) T)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var x = int64(1, 2)
+}`}}, []string{"a.hav:3: Too many arguments in conversion to int64: got 2, want 1"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var anInt int
+	var s = anInt.(string)
+}`}}, []string{"a.hav:4: Invalid type assertion: `anInt` (non-interface type int) on left"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var anInt int
+	switch anInt.(type) {
+	case string:
+		pass
+	}
+}`}}, []string{"a.hav:4: Invalid type assertion: `anInt` (non-interface type int) on left"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f(done chan int) {
+	if <-done {
+		pass
+	}
+}`}}, []string{"a.hav:3: Non-bool condition, value received from the channel is int"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+const x = int64(1) << 40
+const y = 1 + x * x - x`}}, []string{"a.hav:3: Constant 1208925819614629174706176 overflows int64"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f() int {
+	return 1, 2
+}`}}, []string{"a.hav:3: Too many return values: got 2, want 1 (int)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f() (int, string, error) {
+	return 1, "a"
+}`}}, []string{"a.hav:3: Too few return values: got 2, want 3 (int, string, error)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f() (int, error) {
+	return
+}`}}, []string{"a.hav:3: Missing return values: want 2 (int, error), bare return needs named results"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f() (int, string) {
+	return 1, "a"
+}
+func g() (int, string, error) {
+	return f()
+}`}}, []string{"a.hav:6: Value count mismatch: call of `f` returns 2 values, want 3 (int, string, error)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f() (int, string) {
+	return 1, "a"
+}
+func g() (string, int) {
+	return f()
+}`}}, []string{"a.hav:6: Can't assign `int` to `string` (value #1 of call of `f`)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+var s = "a" "b"`}}, []string{"a.hav:2: Unexpected token after a statement"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var s = "a" "b"
+}`}}, []string{"a.hav:3: Unexpected token after a statement"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+type M map[[]int]bool`}}, []string{"a.hav:2: Invalid map key type []int, slices are only comparable with nil"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var m map[func()]int
+	print(m)
+}`}}, []string{"a.hav:3: Invalid map key type func(), functions are only comparable with nil"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+struct S {
+	k []int
+}
+var m map[S]int`}}, []string{"a.hav:5: Invalid map key type S, field k of type []int isn't comparable"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func between(a, b, c int) bool {
+	return a < b < c
+}`}}, []string{"a.hav:3: Invalid operation: operator < not defined on bool (result of b < c)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var x, y int
+	y = x++
+}`}}, []string{"a.hav:4: Unexpected ++, it's a statement, not an expression"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var s = "a"
+	s--
+}`}}, []string{"a.hav:4: Invalid operation: -- on `s` (non-numeric type string)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func g() {
+	pass
+}
+func main() {
+	var a, b = g()
+}`}}, []string{"a.hav:6: Too few values on the right side (call of `g` returns no values)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func g() int {
+	return 1
+}
+func main() {
+	var a, b int
+	a, b = g()
+}`}}, []string{"a.hav:7: Too few values on the right side (call of `g` returns only 1 value)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+struct StructWithSlice {
+	v []int
+}
+func f(i interface{}) bool {
+	return i == StructWithSlice{}
+}`}}, []string{"a.hav:6: Types interface{} and StructWithSlice aren't comparable, field v of type []int isn't comparable"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f(nums ...int) {
+	pass
+}
+func main() {
+	var xs []int
+	f(1, 2, xs...)
+}`}}, []string{"a.hav:7: Can't mix individual variadic arguments with a spread slice in call of `f`"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", "package a\nvar s = `a\n\"b\"\nc`\nvar x int = s"}},
+			[]string{"a.hav:5: Types int and string are not assignable"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", "package a\nvar s = `abc\n"}},
+			[]string{"a.hav:2: Unterminated raw string literal"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+var s = "a\qb"`}}, []string{"a.hav:2: Invalid string literal"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+interface I {
+	func Read() int
+	func Close()
+}
+struct S {
+	func Read() int {
+		return 1
+	}
+}
+func f(i I) {
+	var s = i.(S)
+}`}}, []string{"a.hav:12: Impossible type assertion: `S` doesn't implement `I` (missing method Close)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+interface I {
+	func Read() int
+}
+struct S {
+	func Read() string {
+		return ""
+	}
+}
+func f() {
+	var i I = S{}
+}`}}, []string{"a.hav:11: Types I and S are not assignable, `S` doesn't implement `I` (wrong type for method Read: have func() string, want func() int)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+interface I {
+	func Read() int
+}
+struct S {
+	func *Read() int {
+		return 1
+	}
+}
+func f() {
+	var s S
+	var i I = s
+}`}}, []string{"a.hav:12: Types I and S are not assignable, `S` doesn't implement `I` (method Read has a pointer receiver)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+import "b"
+func main() {
+	var x = b.Foo("1")
+}`}, fakeLocatorFile{"b", "b.hav", `package b
+type Foo int`}}, []string{"a.hav:4: Impossible conversion from string to b.Foo, use strconv.Atoi to parse integers"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+import "b"
+func main() {
+	var x = b.Bar(1)
+}`}, fakeLocatorFile{"b", "b.hav", `package b
+type Foo int`}}, []string{"a.hav:4: Package b doesn't have member Bar"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	a := 1
+	a := 2
+}`}}, []string{"a.hav:4: No new variables on the left side of :="},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f(a int) {
+	a, _ := 2, 3
+}`}}, []string{"a.hav:3: No new variables on the left side of :="},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	a := 1
+	a, b := "x", 2
+}`}}, []string{"a.hav:4: Can't use a string literal as int"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var a, b int
+	a, b = 1, 2, 3
+}`}}, []string{"a.hav:4: Assignment mismatch: 2 variables but 3 values"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var xs [3]int
+	var p *[3]int = ((*[3]int)(xs))
+}`}}, []string{"a.hav:4: Impossible conversion from [3]int to *[3]int, use the address operator instead: `&xs`"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+struct S { xs [3]int }
+func main() {
+	var s S
+	var p *[3]int = ((*[3]int)(s.xs))
+}`}}, []string{"a.hav:5: Impossible conversion from [3]int to *[3]int, use the address operator instead: `&s.xs`"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+struct A { x int }
+struct B { x int }
+struct C {
+	A
+	*B
+}
+func main() {
+	var c C
+	var x = c.x
+}`}}, []string{"a.hav:10: Ambiguous selector x: A.x and B.x"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var x comparable
+}`}}, []string{"a.hav:3: `comparable` can only be used as a constraint of a generic param"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func zero[T]() T {
+	var x T
+	return x
+}
+func main() {
+	var x int = zero()
+}`}}, []string{"a.hav:7: Cannot infer generic param T, specify it explicitly"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func main() {
+	var x = nil
+}`}}, []string{"a.hav:3: Too little information to infer the type of `nil` (declared: unknown, value: unknown)"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+var s = "a
+b"`}}, []string{"a.hav:2: Newline in string literal"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+const c = 2.5
+var x int = c`}}, []string{"a.hav:3: Constant 2.5 truncated to int"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+var x [...]int`}}, []string{"a.hav:2: Invalid use of `[...]`, array length can only be inferred in composite literals"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+var x = [][...]int{{1}}`}}, []string{"a.hav:2: Invalid use of `[...]`, array length can only be inferred in composite literals"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+func f(a [...]int) {
+	pass
+}`}}, []string{"a.hav:2: Invalid use of `[...]`, array length can only be inferred in composite literals"},
+		},
+
+		{
+			[]fakeLocatorFile{fakeLocatorFile{"a", "a.hav", `package a
+var y = [3]int{1, 2, 3}
+var x = [...]int(y)`}}, []string{"a.hav:3: Invalid use of `[...]`, array length can only be inferred in composite literals"},
+		},
 	}
 
 	for _, c := range cases {
@@ -26,6 +26,9 @@ func NewFile(name, code string) *File {
 
 func (f *File) Parse() []error {
 	f.parser = NewParser(NewLexer([]rune(f.Code), f.tfile, 0))
+	if f.tc != nil {
+		f.parser.maxDepth = f.tc.maxDepth
+	}
 	err := f.parser.ParseFile(f)
 	if err != nil {
 		return []error{err}
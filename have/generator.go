@@ -3,6 +3,7 @@ package have
 import (
 	"bytes"
 	"fmt"
+	"path"
 	"regexp"
 	"sort"
 	"strconv"
@@ -160,7 +161,7 @@ func (eg EmptyGenerable) Generate(tc *TypesContext, current *CodeChunk)
 func (vs EmptyGenerable) InlineGenerate(tc *TypesContext, current *CodeChunk, noParenth bool) {}
 
 func (i *ImportStmt) Generate(tc *TypesContext, current *CodeChunk) {
-	current.AddChprintf(tc, "import %s \"%s\"\n", i.name, i.path)
+	current.AddChprintf(tc, "import %s %s\n", i.name, strconv.Quote(i.path))
 }
 
 func (id *Ident) Generate(tc *TypesContext, current *CodeChunk) {
@@ -188,7 +189,7 @@ func (lit *BasicLit) Generate(tc *TypesContext, current *CodeChunk) {
 	case TOKEN_FALSE:
 		current.AddString("false")
 		return
-	case TOKEN_INT, TOKEN_STR, TOKEN_RUNE:
+	case TOKEN_INT, TOKEN_FLOAT, TOKEN_IMAG, TOKEN_STR, TOKEN_RUNE:
 		val = lit.token.Value.(string)
 	default:
 		panic("impossible")
@@ -232,6 +233,11 @@ func (op *UnaryOp) Generate(tc *TypesContext, current *CodeChunk) {
 }
 
 func (op *BinaryOp) Generate(tc *TypesContext, current *CodeChunk) {
+	if op.op.IsLogicalOp() && op.hasMixedBoolOperands(tc) {
+		// Go requires operands of identical types.
+		current.AddChprintf(tc, "(bool(%C) %s bool(%C))", op.Left.(Generable), op.op.Value.(string), op.Right.(Generable))
+		return
+	}
 	// TODO: Put the right operator in
 	current.AddChprintf(tc, "(%C %s %C)", op.Left.(Generable), op.op.Value.(string), op.Right.(Generable))
 }
@@ -265,7 +271,10 @@ func (vd *VarDecl) Generate(tc *TypesContext, current *CodeChunk) {
 			inits.AddChprintf(tc, "%C", init)
 			noMoreInits = true
 		} else {
-			if init != nil {
+			if init != nil && v.untyped && isUntypedConst(init) {
+				// Converting to the default type would make the constant typed.
+				inits.AddChprintf(tc, "%C", init)
+			} else if init != nil {
 				inits.AddChprintf(tc, "(%s)(%C)", v.Type, init)
 			} else {
 				inits.AddChprintf(tc, "(%s)(%s)", v.Type, v.Type.ZeroValue())
@@ -313,29 +322,59 @@ func (vs *VarStmt) Generate(tc *TypesContext, current *CodeChunk) {
 		vs.Vars[0].Inits[0].(Generable).Generate(tc, current)
 		return
 	}
+	if len(vs.Reused) > 0 {
+		// `var` would declare the reused variables again.
+		vs.InlineGenerate(tc, current, true)
+		current.AddString("\n")
+		return
+	}
+	keyword := "var"
+	if vs.IsConst {
+		keyword = "const"
+	}
 	for i, vd := range vs.Vars {
-		current.AddChprintf(tc, "var %C\n", vd)
+		current.AddChprintf(tc, "%s %C\n", keyword, vd)
 		if i+1 < len(vs.Vars) {
 			current.AddChprintf(tc, "%C", ForcedIndent)
 		}
 	}
 }
 
+// Generates the declaration with `:=`, it's used in headers of statements
+// like `if`, and for short variable declarations that reuse variables.
 func (vs *VarStmt) InlineGenerate(tc *TypesContext, current *CodeChunk, noParenth bool) {
 	if vs == nil || len(vs.Vars) == 0 {
 		return
 	}
 
-	i := 0
+	i, count := 0, vs.Vars.countVars()
 	left, right := current.NewChunk(), current.NewChunk()
+	noMoreInits := false
 
 	vs.Vars.eachPair(func(vd *Variable, init Expr) {
 		left.AddString(vd.name)
-		right.AddChprintf(tc, "(%s)(%C)", vd.Type, init.(Generable))
 
-		if i+1 < len(vs.Vars) {
+		var it Type
+		if init != nil {
+			it, _ = init.(TypedExpr).Type(tc)
+		}
+
+		if noMoreInits {
+		} else if init == nil {
+			right.AddChprintf(tc, "(%s)(%s)", vd.Type, vd.Type.ZeroValue())
+		} else if it.Kind() == KIND_TUPLE {
+			// Values of a multi-value call can't be converted.
+			right.AddChprintf(tc, "%C", init.(Generable))
+			noMoreInits = true
+		} else {
+			right.AddChprintf(tc, "(%s)(%C)", vd.Type, init.(Generable))
+		}
+
+		if i+1 < count {
 			left.AddString(", ")
-			right.AddString(", ")
+			if !noMoreInits {
+				right.AddString(", ")
+			}
 		}
 
 		i++
@@ -383,6 +422,16 @@ func (as *AssignStmt) InlineGenerate(tc *TypesContext, current *CodeChunk, noPar
 	}
 }
 
+func (ids *IncDecStmt) Generate(tc *TypesContext, current *CodeChunk) {
+	ids.InlineGenerate(tc, current, true)
+	current.AddString("\n")
+}
+
+func (ids *IncDecStmt) InlineGenerate(tc *TypesContext, current *CodeChunk, noParenth bool) {
+	ids.X.(Generable).Generate(tc, current)
+	current.AddChprintf(tc, "%s", ids.Token.Value)
+}
+
 func (ae *ArrayExpr) Generate(tc *TypesContext, current *CodeChunk) {
 	if alias, ok := tc.goNames[ae]; ok {
 		current.AddChprintf(tc, alias)
@@ -616,9 +665,27 @@ func (fs *ForRangeStmt) Generate(tc *TypesContext, current *CodeChunk) {
 
 func (f *File) Generate(tc *TypesContext, current *CodeChunk) {
 	current.AddChprintf(tc, "package %s\n\n", f.Pkg)
+
+	// Packages needed by compiler macros are known only after the
+	// statements are generated.
+	imports := current.NewChunk()
+	tc.goImports = map[string]bool{}
+
 	for _, stmt := range f.statements {
 		stmt.Stmt.(Generable).Generate(tc, current)
 	}
+
+	paths := []string{}
+	for goPath := range tc.goImports {
+		// Skip packages that the file imports under their own names anyway.
+		if imp, ok := f.parser.imports[path.Base(goPath)]; !ok || imp.path != goPath {
+			paths = append(paths, goPath)
+		}
+	}
+	sort.Strings(paths)
+	for _, goPath := range paths {
+		imports.AddChprintf(tc, "import %s\n", strconv.Quote(goPath))
+	}
 }
 
 func (bs *BranchStmt) Generate(tc *TypesContext, current *CodeChunk) {
@@ -651,6 +718,14 @@ func (rs *ReturnStmt) Generate(tc *TypesContext, current *CodeChunk) {
 	current.AddChprintf(tc, "\n")
 }
 
+func (ds *DeferStmt) Generate(tc *TypesContext, current *CodeChunk) {
+	current.AddChprintf(tc, "defer %C\n", ds.Call)
+}
+
+func (gs *GoStmt) Generate(tc *TypesContext, current *CodeChunk) {
+	current.AddChprintf(tc, "go %C\n", gs.Call)
+}
+
 func (ls *LabelStmt) Generate(tc *TypesContext, current *CodeChunk) {
 	current.AddChprintf(tc, "%s:\n", ls.Name())
 }
@@ -664,6 +739,10 @@ func generateStruct(tc *TypesContext, current *CodeChunk, st *StructType) {
 			// Not a plain member, but a method
 			continue
 		}
+		if st.Embedded[name] {
+			ch.AddChprintf(tc, "%s\n", st.Members[name])
+			continue
+		}
 		ch.AddChprintf(tc, "%s %s\n", name, st.Members[name])
 	}
 
@@ -737,13 +816,6 @@ func (ws *WhenStmt) Generate(tc *TypesContext, current *CodeChunk) {
 	}
 }
 
-func removeQuotes(s string) string {
-	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
-		return s[1 : len(s)-1]
-	}
-	return s
-}
-
 var reArgs = regexp.MustCompile(`%[atv]\d+`)
 
 func (cm *compilerMacro) generate(tc *TypesContext, current *CodeChunk, args []Expr, types []Type, ellipsis bool) {
@@ -751,7 +823,11 @@ func (cm *compilerMacro) generate(tc *TypesContext, current *CodeChunk, args []E
 		return
 	}
 
-	pattern := removeQuotes(cm.Args[0].(*BasicLit).token.Value.(string))
+	for _, goPath := range cm.goImports {
+		tc.goImports[goPath] = true
+	}
+
+	pattern := cm.Args[0].(*BasicLit).value
 	str := []byte(pattern)
 	all := reArgs.FindAllIndex(str, -1)
 
@@ -2,6 +2,9 @@ package have
 
 import (
 	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
 	"strings"
 	"testing"
 )
@@ -71,6 +74,50 @@ if t, k := (int)(1), (string)("aaa"); ((t == 2) && (k == "bbb")) {
 	print(1)
 } `,
 		},
+		{source: "if t := 1; t == 2 { print(1) }", reference: `
+if t := (int)(1); (t == 2) {
+	print(1)
+}`,
+		},
+		{source: "t, k := 1, \"aaa\"", reference: `var t, k = (int)(1), (string)("aaa")`},
+		{source: `
+func g() (int, error) {
+	return 1, nil
+}
+func f() {
+	a, e := g()
+	b, e := g()
+	if c, e := g(); e != nil {
+		print(a, b, c)
+	}
+	a, d := 2, "d"
+	print(d)
+}`, reference: `
+func g() (int, error) {
+	return 1, nil
+}
+func f() {
+	var a, e = g()
+	b, e := g()
+	if c, e := g(); (e != nil) {
+		print(a, b, c)
+	}
+	a, d := (int)(2), (string)("d")
+	print(d)
+}`},
+		{source: `
+func f(a int) {
+	if true {
+		a := "s"
+		print(a)
+	}
+}`, reference: `
+func f(a int) {
+	if true {
+		var a = (string)("s")
+		print(a)
+	}
+}`},
 		{source: "if 1 == 2 { print(1) } else { print(2) }", reference: `
 if (1 == 2) {
 	print(1)
@@ -95,6 +142,11 @@ for true {
 	print("b")
 }`, reference: `for x := (int)(0); (x < 100); print("a") {
 	print("b")
+}`},
+		{source: `for x := 0; x < 100; print("a") {
+	print("b")
+}`, reference: `for x := (int)(0); (x < 100); print("a") {
+	print("b")
 }`},
 		{source: `for var x = 0; x < 100; print("a") { break }`,
 			reference: `for x := (int)(0); (x < 100); print("a") {
@@ -173,6 +225,19 @@ var x A = nil`,
 			reference: `
 type A interface{a() int}
 var x = (A)(nil)`},
+		{source: `
+interface A {
+	func a() int
+}
+interface B {
+	A
+	func b()
+}
+var x B = nil`,
+			reference: `
+type A interface{a() int}
+type B interface{A; b()}
+var x = (B)(nil)`},
 		{source: `var x map[int]string
 var y = x[1]
 y = x[1]`,
@@ -204,6 +269,26 @@ y = x[1:4]
 }`, reference: `func a() (int, string) {
 	return 1, "bla"
 }`},
+		{source: `type Flag bool
+var flag Flag
+var ok bool
+var x = ok || (flag && true)`,
+			reference: `type Flag bool
+var flag = (Flag)(false)
+var ok = (bool)(false)
+var x = (bool)((bool(ok) || bool((flag && true))))`},
+		{source: `var x [3]int = [...]int{1, 2, 3}`,
+			reference: `var x = ([3]int)([3]int{
+	1,
+	2,
+	3,
+})`},
+		{source: `var x = 1
+var a = x << 1.0`,
+			reference: `var x = (int)(1)
+var a = (int)((x << 1.0))`},
+		{source: `var h func(string, ...int)`,
+			reference: `var h = (func(string, ...int))(nil)`},
 	}
 	testCases(t, cases)
 }
@@ -305,6 +390,15 @@ func TestGenerateReturnStmts(t *testing.T) {
 	return 7, "ble"
 }`},
 		{source: `
+func a() (int, string) { return 7, "ble" }
+func b() (int, string) { return a() }`,
+			reference: `func a() (int, string) {
+	return 7, "ble"
+}
+func b() (int, string) {
+	return a()
+}`},
+		{source: `
 struct A {
 	x int
 }
@@ -450,6 +544,14 @@ case 1, 2, 3:
 			reference: `switch x := (int)(1); (x + 2) {
 case 1, 2, 3:
 	// pass
+}`},
+		{source: `switch x := 1; x + 2 {
+case 1, 2, 3:
+	pass
+}`,
+			reference: `switch x := (int)(1); (x + 2) {
+case 1, 2, 3:
+	// pass
 }`},
 		{source: `switch {
 case true || false:
@@ -542,6 +644,144 @@ func a() {
 	testCases(t, cases)
 }
 
+func TestGenerateEmbeddedFields(t *testing.T) {
+	cases := []generatorTestCase{
+		{source: `
+struct Base {
+	x int
+}
+struct A {
+	Base
+	*Base2
+	y string
+}
+struct Base2 {
+	z int
+}
+func f(a A) int {
+	return a.x + a.z
+}`,
+			reference: `type Base struct {
+	x int
+}
+
+type A struct {
+	Base
+	*Base2
+	y string
+}
+
+type Base2 struct {
+	z int
+}
+
+func f(a A) (int) {
+	return (a.x + a.z)
+}`},
+	}
+	testCases(t, cases)
+}
+
+func TestGenerateGoStmt(t *testing.T) {
+	cases := []generatorTestCase{
+		{source: `
+func f(a int, b string) {
+	pass
+}
+func g() (int, string) {
+	return 1, "a"
+}
+func h() {
+	go f(g())
+	go func() { pass }()
+}`,
+			reference: `func f(a int, b string) {
+	// pass
+}
+func g() (int, string) {
+	return 1, "a"
+}
+func h() {
+	go f(g())
+	go func () {
+		// pass
+	}()
+}`},
+	}
+	testCases(t, cases)
+}
+
+func TestGenerateConstDecl(t *testing.T) {
+	cases := []generatorTestCase{
+		{source: `
+const x = int64(5)
+func f() {
+	const y = x * 2
+	print(y)
+}`,
+			reference: `const x = (int64)(int64(5))
+func f() {
+	const y = (int64)((x * 2))
+	print(y)
+}`},
+		{source: `
+const (
+	a = iota
+	b
+	c
+)
+const (
+	x, y = iota, iota * 10
+	_, _
+	z, w
+)`,
+			reference: `const a = 0
+const b = 1
+const c = 2
+const x, y = 0, (0 * 10)
+const _, _ = 1, (1 * 10)
+const z, w = 2, (2 * 10)`},
+		{source: `
+const big = 1 << 100
+const small = big >> 98
+func f() {
+	var x float64 = small
+	print(x)
+}`,
+			reference: `const big = (1 << 100)
+const small = (big >> 98)
+func f() {
+	var x = (float64)(small)
+	print(x)
+}`},
+	}
+	testCases(t, cases)
+}
+
+func TestGenerateIncDecStmt(t *testing.T) {
+	cases := []generatorTestCase{
+		{source: `
+func f() {
+	var x, m = 1, map[string]int{}
+	x++
+	m["a"]--
+	for x = 0; x < 10; x++ {
+		print(x)
+	}
+}`,
+			reference: `
+func f() {
+	var x, m = (int)(1), (map[string]int)(map[string]int{})
+	x++
+	m["a"]--
+	for x = 0; (x < 10); x++ {
+		print(x)
+	}
+}`},
+	}
+	testCases(t, cases)
+}
+
 func TestGenerateWhenStmt(t *testing.T) {
 	cases := []generatorTestCase{
 		{source: `
@@ -767,3 +1007,61 @@ abc("test", 1, 2, 3)`},
 
 	testCases(t, cases)
 }
+
+func TestGenerateCompilerMacroImports(t *testing.T) {
+	code := `package main
+
+func upper(s string) string {
+	__compiler_macro("strings.ToUpper(%a0)", "strings")
+}
+
+func main() {
+	print(upper("a"))
+}`
+	pkg := NewPackage("main", NewFile("main.go", code))
+	if errs := pkg.ParseAndCheck(); len(errs) > 0 {
+		t.Fatalf("Errors when compiling: %v", errs)
+	}
+	output := pkg.Files[0].GenerateCode()
+	if !strings.Contains(output, `import "strings"`) || !strings.Contains(output, `strings.ToUpper("a")`) {
+		t.Fatalf("Macro's import missing in:\n%s", output)
+	}
+}
+
+func TestGenerateErrorfBuiltin(t *testing.T) {
+	code := `package main
+
+func check(x int) error {
+	if x > 2 {
+		return errorf("bad value %d of %s", x, "check")
+	}
+	return nil
+}
+
+func main() {
+	print(check(3).Error())
+}`
+	pkg := NewPackage("main", NewFile("main.go", code))
+	pkg.builtinErrorf = true
+	if errs := pkg.ParseAndCheck(); len(errs) > 0 {
+		t.Fatalf("Errors when compiling: %v", errs)
+	}
+	output := pkg.Files[0].GenerateCode()
+	if !strings.Contains(output, `import "fmt"`) {
+		t.Fatalf("fmt isn't imported by:\n%s", output)
+	}
+
+	// The generated file has to be valid Go.
+	os.MkdirAll("tmp", 0744)
+	outputFile := "tmp/errorf.go"
+	if err := ioutil.WriteFile(outputFile, []byte(output), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := exec.Command("go", "run", outputFile).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Running generated code failed: %s\n%s\n%s", err, result, output)
+	}
+	if string(result) != "bad value 3 of check" {
+		t.Errorf("Unexpected output of generated code: %q", result)
+	}
+}
@@ -43,6 +43,14 @@ func (is *IdentStack) findObject(name string) Object {
 	return nil
 }
 
+// Like findObject, but only looks in the innermost scope.
+func (is *IdentStack) findObjectInScope(name string) Object {
+	if is.empty() {
+		return nil
+	}
+	return (*is)[len(*is)-1][name]
+}
+
 // Returns either a *TypeDecl or *GenericTypeDecl.(or nil when not found).
 func (is *IdentStack) findTypeDecl(name string) Object {
 	if decl, ok := GetBuiltinType(name); ok {
@@ -49,86 +49,124 @@ func (t *Token) IsLogicalOp() bool {
 	return false
 }
 
+// Tells if operator's operands can only be integers.
+func (t *Token) IsIntegerOp() bool {
+	switch t.Type {
+	case TOKEN_PERCENT, TOKEN_AMP, TOKEN_PIPE:
+		return true
+	}
+	return false
+}
+
+// Tells if a token is the blank identifier `_`. Words starting with an
+// underscore, like `_foo`, are ordinary identifiers.
+func (t *Token) IsBlank() bool {
+	return t.Type == TOKEN_WORD && t.Value.(string) == Blank
+}
+
+// Tells if a token is any of the shift operators.
+func (t *Token) IsShiftOp() bool {
+	switch t.Type {
+	case TOKEN_SHL, TOKEN_SHR:
+		return true
+	}
+	return false
+}
+
 //go:generate stringer -type=TokenType
 const (
-	TOKEN_EOF          TokenType = iota + 1
-	TOKEN_INDENT                 // indent - []rune of whitespace characters
-	TOKEN_FOR                    // the "for" keyword
-	TOKEN_WORD                   // alphanumeric word, starts witn a letter
-	TOKEN_ASSIGN                 // =
-	TOKEN_EQUALS                 // ==
-	TOKEN_NEQUALS                // !=
-	TOKEN_GT                     // >
-	TOKEN_LT                     // <
-	TOKEN_EQ_LT                  // <=
-	TOKEN_EQ_GT                  // >=
-	TOKEN_NEGATE                 // !
-	TOKEN_INT                    // Integer number literal
-	TOKEN_FLOAT                  // Float number literal
-	TOKEN_IMAG                   // Imaginary part literal
-	TOKEN_STR                    // string literal
-	TOKEN_RUNE                   // rune literal
-	TOKEN_DOT                    // .
-	TOKEN_ELLIPSIS               // ...
-	TOKEN_LPARENTH               // (
-	TOKEN_RPARENTH               // )
-	TOKEN_LBRACKET               // [
-	TOKEN_RBRACKET               // ]
-	TOKEN_LBRACE                 // {
-	TOKEN_RBRACE                 // }
-	TOKEN_PLUS                   // +
-	TOKEN_PLUS_ASSIGN            // +=
-	TOKEN_INCREMENT              // ++
-	TOKEN_MINUS                  // -
-	TOKEN_MINUS_ASSIGN           // -=
-	TOKEN_DECREMENT              // --
-	TOKEN_VAR                    // the "var" keyword
-	TOKEN_IF                     // the "if" keyword
-	TOKEN_ELSE                   // the "else" keyword
-	TOKEN_ELIF                   // the "elif" keyword
-	TOKEN_SWITCH                 // the "switch" keyword
-	TOKEN_CASE                   // the "case" keyword
-	TOKEN_DEFAULT                // the "default" keyword
-	TOKEN_RETURN                 // the "return" keyword
-	TOKEN_TRUE                   // the "true" keyword
-	TOKEN_FALSE                  // the "false" keyword
-	TOKEN_STRUCT                 // the "struct" keyword
-	TOKEN_MAP                    // the "map" keyword
-	TOKEN_FUNC                   // the "func" keyword
-	TOKEN_IMPORT                 // the "import" keyword
-	TOKEN_AS                     // the "as" keyword
-	TOKEN_TYPE                   // the "type" keyword
-	TOKEN_IN                     // the "in" keyword
-	TOKEN_PASS                   // the "pass" keyword
-	TOKEN_PACKAGE                // the "package" keyword
-	TOKEN_BREAK                  // the "break" keyword
-	TOKEN_CONTINUE               // the "continue" keyword
-	TOKEN_FALLTHROUGH            // the "fallthrough" keyword
-	TOKEN_GOTO                   // the "goto" keyword
-	TOKEN_INTERFACE              // the "interface" keyword
-	TOKEN_NIL                    // the "nil" keyword
-	TOKEN_CHAN                   // the "chan" keyword
-	TOKEN_RANGE                  // the "range" keyword
-	TOKEN_WHEN                   // the "when" keyword
-	TOKEN_IMPLEMENTS             // the "implements" keyword
-	TOKEN_IS                     // the "is" keyword
-	TOKEN_MUL                    // *
-	TOKEN_DIV                    // /
-	TOKEN_MUL_ASSIGN             // *=
-	TOKEN_DIV_ASSIGN             // /=
-	TOKEN_SHL                    // <<
-	TOKEN_SHR                    // >>
-	TOKEN_SEND                   // <-
-	TOKEN_COMMA                  // ,
-	TOKEN_COLON                  // :
-	TOKEN_SEMICOLON              // ;
-	TOKEN_AMP                    // &
-	TOKEN_PIPE                   // |
-	TOKEN_PERCENT                // %
-	TOKEN_AND                    // &&
-	TOKEN_OR                     // ||
-	TOKEN_SHARP                  // #
-	TOKEN_UNEXP_CHAR             // For error reporting
+	TOKEN_EOF            TokenType = iota + 1
+	TOKEN_INDENT                   // indent - []rune of whitespace characters
+	TOKEN_FOR                      // the "for" keyword
+	TOKEN_WORD                     // alphanumeric word, starts witn a letter
+	TOKEN_ASSIGN                   // =
+	TOKEN_EQUALS                   // ==
+	TOKEN_NEQUALS                  // !=
+	TOKEN_GT                       // >
+	TOKEN_LT                       // <
+	TOKEN_EQ_LT                    // <=
+	TOKEN_EQ_GT                    // >=
+	TOKEN_NEGATE                   // !
+	TOKEN_INT                      // Integer number literal
+	TOKEN_FLOAT                    // Float number literal
+	TOKEN_IMAG                     // Imaginary part literal
+	TOKEN_STR                      // string literal
+	TOKEN_RUNE                     // rune literal
+	TOKEN_DOT                      // .
+	TOKEN_ELLIPSIS                 // ...
+	TOKEN_LPARENTH                 // (
+	TOKEN_RPARENTH                 // )
+	TOKEN_LBRACKET                 // [
+	TOKEN_RBRACKET                 // ]
+	TOKEN_LBRACE                   // {
+	TOKEN_RBRACE                   // }
+	TOKEN_PLUS                     // +
+	TOKEN_PLUS_ASSIGN              // +=
+	TOKEN_INCREMENT                // ++
+	TOKEN_MINUS                    // -
+	TOKEN_MINUS_ASSIGN             // -=
+	TOKEN_DECREMENT                // --
+	TOKEN_VAR                      // the "var" keyword
+	TOKEN_IF                       // the "if" keyword
+	TOKEN_ELSE                     // the "else" keyword
+	TOKEN_ELIF                     // the "elif" keyword
+	TOKEN_SWITCH                   // the "switch" keyword
+	TOKEN_CASE                     // the "case" keyword
+	TOKEN_DEFAULT                  // the "default" keyword
+	TOKEN_RETURN                   // the "return" keyword
+	TOKEN_TRUE                     // the "true" keyword
+	TOKEN_FALSE                    // the "false" keyword
+	TOKEN_STRUCT                   // the "struct" keyword
+	TOKEN_MAP                      // the "map" keyword
+	TOKEN_FUNC                     // the "func" keyword
+	TOKEN_IMPORT                   // the "import" keyword
+	TOKEN_AS                       // the "as" keyword
+	TOKEN_TYPE                     // the "type" keyword
+	TOKEN_IN                       // the "in" keyword
+	TOKEN_PASS                     // the "pass" keyword
+	TOKEN_PACKAGE                  // the "package" keyword
+	TOKEN_BREAK                    // the "break" keyword
+	TOKEN_CONTINUE                 // the "continue" keyword
+	TOKEN_FALLTHROUGH              // the "fallthrough" keyword
+	TOKEN_GOTO                     // the "goto" keyword
+	TOKEN_INTERFACE                // the "interface" keyword
+	TOKEN_NIL                      // the "nil" keyword
+	TOKEN_CHAN                     // the "chan" keyword
+	TOKEN_RANGE                    // the "range" keyword
+	TOKEN_WHEN                     // the "when" keyword
+	TOKEN_IMPLEMENTS               // the "implements" keyword
+	TOKEN_IS                       // the "is" keyword
+	TOKEN_DEFER                    // the "defer" keyword
+	TOKEN_GO                       // the "go" keyword
+	TOKEN_CONST                    // the "const" keyword
+	TOKEN_MUL                      // *
+	TOKEN_DIV                      // /
+	TOKEN_MUL_ASSIGN               // *=
+	TOKEN_DIV_ASSIGN               // /=
+	TOKEN_SHL                      // <<
+	TOKEN_SHR                      // >>
+	TOKEN_SEND                     // <-
+	TOKEN_COMMA                    // ,
+	TOKEN_COLON                    // :
+	TOKEN_SEMICOLON                // ;
+	TOKEN_AMP                      // &
+	TOKEN_PIPE                     // |
+	TOKEN_PERCENT                  // %
+	TOKEN_AND                      // &&
+	TOKEN_OR                       // ||
+	TOKEN_SHARP                    // #
+	TOKEN_TILDE                    // ~
+	TOKEN_DEFINE                   // :=
+	TOKEN_XOR                      // ^
+	TOKEN_XOR_ASSIGN               // ^=
+	TOKEN_PERCENT_ASSIGN           // %=
+	TOKEN_AMP_ASSIGN               // &=
+	TOKEN_PIPE_ASSIGN              // |=
+	TOKEN_SHL_ASSIGN               // <<=
+	TOKEN_SHR_ASSIGN               // >>=
+	TOKEN_AND_NOT                  // &^
+	TOKEN_AND_NOT_ASSIGN           // &^=
+	TOKEN_UNEXP_CHAR               // For error reporting
 )
 
 type Lexer struct {
@@ -136,8 +174,13 @@ type Lexer struct {
 	all []rune
 	// Characters not processed yet.
 	buf []rune
-	// Stack of opened indents.
+	// Stack of opened indents, as widths of the leading whitespace.
 	indentsStack []int
+	// The first inconsistent dedent, reported by the parser.
+	indentErr *CompileError
+	// Stack of opened brackets, newlines inside parentheses and square
+	// brackets don't emit indent tokens, so expressions can span lines.
+	bracketsStack []rune
 	// We don't want to emit indent tokens for blank lines,
 	// so we need to postpone indent tokens for a while.
 	tokenIndent *Token
@@ -155,6 +198,42 @@ func NewLexer(buf []rune, tfile *gotoken.File, offset int) *Lexer {
 	return &Lexer{all: buf, buf: buf, indentsStack: []int{}, tfile: tfile, offset: offset}
 }
 
+// Updates the stack of indents with an indent of a non-blank line. Like in Python,
+// a line can only dedent to one of the enclosing levels, dedenting to any other
+// level is an error.
+func (l *Lexer) trackIndent(t *Token) {
+	width := len([]rune(t.Value.(string)))
+	top := func() int {
+		if len(l.indentsStack) == 0 {
+			return 0
+		}
+		return l.indentsStack[len(l.indentsStack)-1]
+	}
+
+	if width < top() {
+		for len(l.indentsStack) > 0 && top() > width {
+			l.indentsStack = l.indentsStack[:len(l.indentsStack)-1]
+		}
+		if top() != width && l.indentErr == nil {
+			l.indentErr = &CompileError{
+				Message: "Inconsistent dedent, indentation doesn't match any outer level",
+				Pos:     t.Pos,
+			}
+		}
+	}
+	if width > top() {
+		l.indentsStack = append(l.indentsStack, width)
+	}
+}
+
+// Returns the first indentation error, if any.
+func (l *Lexer) IndentErr() error {
+	if l.indentErr == nil {
+		return nil
+	}
+	return l.indentErr
+}
+
 func countWhiteChars(buf []rune) int {
 	i := 0
 	for i < len(buf) && (unicode.IsSpace(buf[i]) && buf[i] != '\n') {
@@ -202,6 +281,19 @@ func (l *Lexer) skipMultilineComment() ([]rune, error) {
 	return nil, errors.New("Did not close comment")
 }
 
+// Skips the `#!` line that lets a source file be run as a script.
+// It's only recognized at the very beginning of a file. The newline is
+// consumed too, so that the next line starts without an indent token.
+func (l *Lexer) skipShebang() {
+	if l.skipped == 0 && len(l.buf) >= 2 && string(l.buf[:2]) == "#!" {
+		l.skipLine()
+		if !l.isEnd() {
+			l.tfile.AddLine(l.skipped)
+			l.skip()
+		}
+	}
+}
+
 // Skip whitespace and comments
 func (l *Lexer) skipFluff() {
 	for {
@@ -227,6 +319,28 @@ func (l *Lexer) scanWord() []rune {
 	return result
 }
 
+func (l *Lexer) openBracket(ch rune) {
+	l.bracketsStack = append(l.bracketsStack, ch)
+}
+
+func (l *Lexer) closeBracket() {
+	// Unbalanced brackets are reported by the parser.
+	if len(l.bracketsStack) > 0 {
+		l.bracketsStack = l.bracketsStack[:len(l.bracketsStack)-1]
+	}
+}
+
+// Tells whether the innermost opened bracket is a parenthesis or a square
+// bracket. Braces start blocks of code (e.g. of a func literal passed as an
+// argument), so indents are emitted inside them.
+func (l *Lexer) insideBrackets() bool {
+	if len(l.bracketsStack) == 0 {
+		return false
+	}
+	top := l.bracketsStack[len(l.bracketsStack)-1]
+	return top == '(' || top == '['
+}
+
 // Advance lexer's buffer by one character.
 func (l *Lexer) skip() {
 	l.skipped++
@@ -259,30 +373,6 @@ func (l *Lexer) checkAlt(alts ...string) (alt string, ok bool) {
 	return "", false
 }
 
-func (l *Lexer) loadEscapedString() (string, error) {
-	if len(l.buf) == 0 || l.buf[0] != '"' {
-		return "", fmt.Errorf("String literal has to start with a double quote")
-	}
-
-	l.skip()
-
-	i := 0
-	for ; i < len(l.buf); i++ {
-		switch l.buf[i] {
-		case '\\':
-			i++
-			if i == len(l.buf) {
-				return "", fmt.Errorf("Unexpected file end - middle of a string literal")
-			}
-		case '"':
-			s := string(l.buf[:i])
-			l.skipBy(i + 1)
-			return s, nil
-		}
-	}
-	return "", fmt.Errorf("Unterminated string literal")
-}
-
 func (l *Lexer) newToken(typ TokenType, val interface{}) *Token {
 	return &Token{Type: typ, Offset: l.curTokenPos, Value: val, Pos: l.tfile.Pos(l.curTokenPos + l.offset)}
 }
@@ -293,12 +383,30 @@ func (l *Lexer) retNewToken(typ TokenType, val interface{}) *Token {
 	return l.newToken(typ, val)
 }
 
+// Returns the offset of a newline inside the interpreted string literal at
+// the beginning of the buffer, or -1 if the literal ends before the line does.
+func (l *Lexer) newlineInString() int {
+	for i := 1; i < len(l.buf); i++ {
+		switch l.buf[i] {
+		case '\\':
+			if i+1 < len(l.buf) && l.buf[i+1] != '\n' {
+				i++
+			}
+		case '"':
+			return -1
+		case '\n':
+			return i
+		}
+	}
+	return -1
+}
+
 func (l *Lexer) scanGoToken() (token gotoken.Token, lit string, err error) {
 	// TODO: We shouldn't be setting everything up from scratch every time.
 
 	fs := gotoken.NewFileSet()
 	code := make([]byte, 0, len(l.buf))
-	tmp := make([]byte, 3)
+	tmp := make([]byte, utf8.UTFMax)
 
 	// TODO: Don't use []rune, if Golang doesn't need it neither do we and it leads
 	// to stuff like this.
@@ -316,7 +424,17 @@ func (l *Lexer) scanGoToken() (token gotoken.Token, lit string, err error) {
 
 	s.Init(f, []byte(code), errorHandler, 0)
 	_, tok, lit := s.Scan()
-	l.skipBy(len([]rune(lit)))
+	if n := len([]rune(lit)); n <= len(l.buf) {
+		// Raw strings can span multiple lines.
+		for i, ch := range []rune(lit) {
+			if ch == '\n' {
+				l.tfile.AddLine(l.skipped + i)
+			}
+		}
+		l.skipBy(n)
+	} else {
+		err = fmt.Errorf("Scanner error: literal longer than the input")
+	}
 
 	return tok, lit, err
 }
@@ -343,12 +461,14 @@ func (l *Lexer) Slice(start, end *Token) []rune {
 }
 
 func (l *Lexer) Next() *Token {
+	l.skipShebang()
 	l.curTokenPos = l.skipped
 
 	if !l.isEnd() && l.buf[0] != '\n' {
 		if l.tokenIndent != nil {
 			t := l.tokenIndent
 			l.tokenIndent = nil
+			l.trackIndent(t)
 			return t
 		}
 	}
@@ -365,7 +485,9 @@ func (l *Lexer) Next() *Token {
 		l.skip()
 		indent := string(l.skipWhiteChars())
 		l.skipInlineComment()
-		l.tokenIndent = l.newToken(TOKEN_INDENT, indent)
+		if !l.insideBrackets() {
+			l.tokenIndent = l.newToken(TOKEN_INDENT, indent)
+		}
 		return l.Next()
 	case unicode.IsSpace(ch):
 		l.skipWhiteChars()
@@ -395,6 +517,12 @@ func (l *Lexer) Next() *Token {
 			return l.retNewToken(TOKEN_DEFAULT, nil)
 		case "return", "ret":
 			return l.retNewToken(TOKEN_RETURN, nil)
+		case "defer":
+			return l.retNewToken(TOKEN_DEFER, nil)
+		case "go":
+			return l.retNewToken(TOKEN_GO, nil)
+		case "const":
+			return l.retNewToken(TOKEN_CONST, nil)
 		case "true":
 			return l.retNewToken(TOKEN_TRUE, nil)
 		case "false":
@@ -473,8 +601,10 @@ func (l *Lexer) Next() *Token {
 			return l.retNewToken(TOKEN_DECREMENT, alt)
 		}
 	case ch == '<':
-		alt, _ := l.checkAlt("<<", "<-", "<=", "<")
+		alt, _ := l.checkAlt("<<=", "<<", "<-", "<=", "<")
 		switch alt {
+		case "<<=":
+			return l.retNewToken(TOKEN_SHL_ASSIGN, alt)
 		case "<":
 			return l.retNewToken(TOKEN_LT, alt)
 		case "<-":
@@ -485,8 +615,10 @@ func (l *Lexer) Next() *Token {
 			return l.retNewToken(TOKEN_EQ_LT, alt)
 		}
 	case ch == '>':
-		alt, _ := l.checkAlt(">>", ">=", ">")
+		alt, _ := l.checkAlt(">>=", ">>", ">=", ">")
 		switch alt {
+		case ">>=":
+			return l.retNewToken(TOKEN_SHR_ASSIGN, alt)
 		case ">":
 			return l.retNewToken(TOKEN_GT, alt)
 		case ">>":
@@ -494,29 +626,46 @@ func (l *Lexer) Next() *Token {
 		case ">=":
 			return l.retNewToken(TOKEN_EQ_GT, alt)
 		}
-	case unicode.IsNumber(ch) || ch == '"' || ch == '`' || ch == '\'':
+	case unicode.IsNumber(ch) || ch == '"' || ch == '`' || ch == '\'',
+		// Float literals can start with a dot, e.g. `.5`.
+		ch == '.' && len(l.buf) > 1 && unicode.IsDigit(l.buf[1]):
+		if ch == '"' {
+			if i := l.newlineInString(); i >= 0 {
+				// Only raw strings can span multiple lines. The error
+				// token points at the newline.
+				l.skipBy(i)
+				l.curTokenPos = l.skipped
+				return l.newToken(TOKEN_UNEXP_CHAR, '\n')
+			}
+		}
 		gotok, lit, err := l.scanGoToken()
 		if err != nil {
-			return nil
+			return l.newToken(TOKEN_UNEXP_CHAR, ch)
 		}
 		return l.fromGoToken(gotok, lit)
 	case ch == '(':
 		l.skip()
+		l.openBracket(ch)
 		return l.retNewToken(TOKEN_LPARENTH, nil)
 	case ch == ')':
 		l.skip()
+		l.closeBracket()
 		return l.retNewToken(TOKEN_RPARENTH, nil)
 	case ch == '[':
 		l.skip()
+		l.openBracket(ch)
 		return l.retNewToken(TOKEN_LBRACKET, nil)
 	case ch == ']':
 		l.skip()
+		l.closeBracket()
 		return l.retNewToken(TOKEN_RBRACKET, nil)
 	case ch == '{':
 		l.skip()
+		l.openBracket(ch)
 		return l.retNewToken(TOKEN_LBRACE, nil)
 	case ch == '}':
 		l.skip()
+		l.closeBracket()
 		return l.retNewToken(TOKEN_RBRACE, nil)
 	case ch == '.':
 		alt, _ := l.checkAlt("...", ".")
@@ -547,7 +696,7 @@ func (l *Lexer) Next() *Token {
 		case "/*":
 			_, err := l.skipMultilineComment()
 			if err != nil {
-				return nil
+				return l.newToken(TOKEN_UNEXP_CHAR, ch)
 			}
 			return l.Next()
 		}
@@ -558,31 +707,83 @@ func (l *Lexer) Next() *Token {
 		l.skip()
 		return l.retNewToken(TOKEN_SEMICOLON, nil)
 	case ch == ':':
+		if _, ok := l.checkAlt(":="); ok {
+			return l.retNewToken(TOKEN_DEFINE, ":=")
+		}
 		l.skip()
 		return l.retNewToken(TOKEN_COLON, nil)
 	case ch == '%':
-		l.skip()
-		return l.retNewToken(TOKEN_PERCENT, "%")
+		alt, _ := l.checkAlt("%=", "%")
+		switch alt {
+		case "%=":
+			return l.retNewToken(TOKEN_PERCENT_ASSIGN, alt)
+		case "%":
+			return l.retNewToken(TOKEN_PERCENT, alt)
+		}
 	case ch == '&':
-		alt, _ := l.checkAlt("&&", "&")
+		alt, _ := l.checkAlt("&&", "&^=", "&^", "&=", "&")
 		switch alt {
 		case "&&":
 			return l.retNewToken(TOKEN_AND, alt)
+		case "&^=":
+			return l.retNewToken(TOKEN_AND_NOT_ASSIGN, alt)
+		case "&^":
+			return l.retNewToken(TOKEN_AND_NOT, alt)
+		case "&=":
+			return l.retNewToken(TOKEN_AMP_ASSIGN, alt)
 		case "&":
 			return l.retNewToken(TOKEN_AMP, alt)
 		}
 	case ch == '|':
-		alt, _ := l.checkAlt("||", "|")
+		alt, _ := l.checkAlt("||", "|=", "|")
 		switch alt {
 		case "||":
 			return l.retNewToken(TOKEN_OR, alt)
+		case "|=":
+			return l.retNewToken(TOKEN_PIPE_ASSIGN, alt)
 		case "|":
 			return l.retNewToken(TOKEN_PIPE, alt)
 		}
+	case ch == '~':
+		l.skip()
+		return l.retNewToken(TOKEN_TILDE, "~")
+	case ch == '^':
+		alt, _ := l.checkAlt("^=", "^")
+		switch alt {
+		case "^=":
+			return l.retNewToken(TOKEN_XOR_ASSIGN, alt)
+		case "^":
+			return l.retNewToken(TOKEN_XOR, alt)
+		}
 	}
 	return l.newToken(TOKEN_UNEXP_CHAR, ch)
 }
 
+// Splits the whole source into tokens, up to TOKEN_EOF. Malformed input results
+// in an error, it never causes a panic.
+func SafeTokenize(src []rune) (tokens []*Token, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			tokens, err = nil, fmt.Errorf("Lexer failure: %v", r)
+		}
+	}()
+
+	fs := gotoken.NewFileSet()
+	l := NewLexer(src, fs.AddFile("", fs.Base(), len(src)), 0)
+
+	for {
+		token := l.Next()
+		tokens = append(tokens, token)
+
+		switch token.Type {
+		case TOKEN_EOF:
+			return tokens, nil
+		case TOKEN_UNEXP_CHAR:
+			return tokens, fmt.Errorf("Unexpected character at offset %d: %q", token.Offset, token.Value)
+		}
+	}
+}
+
 // Can be used to mark a fragment of code in the file and then extract it.
 type fragment struct {
 	from, code []rune
@@ -3,6 +3,7 @@ package have
 import (
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	gotoken "go/token"
@@ -60,6 +61,80 @@ func TestIndents(t *testing.T) {
 	})
 }
 
+func TestIndentsAtEOF(t *testing.T) {
+	// Indented block at the end of a file without a trailing newline.
+	testTokens(t, []rune("{\n  a\n    b}"), []*Token{
+		&Token{TOKEN_LBRACE, 0, nil, 0},
+		&Token{TOKEN_INDENT, 1, "  ", 0},
+		&Token{TOKEN_WORD, 4, "a", 0},
+		&Token{TOKEN_INDENT, 5, "    ", 0},
+		&Token{TOKEN_WORD, 10, "b", 0},
+		&Token{TOKEN_RBRACE, 11, nil, 0},
+		&Token{TOKEN_EOF, 12, nil, 0}})
+
+	// Trailing whitespace after the last line doesn't emit an indent.
+	testTokens(t, []rune("a\n  "), []*Token{
+		&Token{TOKEN_WORD, 0, "a", 0},
+		&Token{TOKEN_EOF, 4, nil, 0}})
+}
+
+func TestInconsistentDedent(t *testing.T) {
+	cases := []struct {
+		code  string
+		valid bool
+		line  int
+	}{
+		{"a\n  b\n    c\n\n  d\ne", true, 0},
+		{"a\n    b\n        c\na", true, 0},
+		{"a\n    b\n        c\n      d", false, 4},
+		{"a\n    b\n  c", false, 3},
+	}
+
+	for i, c := range cases {
+		fs := gotoken.NewFileSet()
+		in := []rune(c.code)
+		tfile := fs.AddFile("a.hav", fs.Base(), len(in))
+		l := NewLexer(in, tfile, 0)
+		for tok := l.Next(); tok.Type != TOKEN_EOF; tok = l.Next() {
+		}
+
+		err := l.IndentErr()
+		if (err == nil) != c.valid {
+			t.Fatalf("Case %d: unexpected indentation error: %v", i, err)
+		}
+		if err != nil {
+			if line := fs.Position(err.(*CompileError).Pos).Line; line != c.line {
+				t.Fatalf("Case %d: error reported at line %d instead of %d", i, line, c.line)
+			}
+		}
+	}
+}
+
+func TestIndentsInsideBrackets(t *testing.T) {
+	// Expressions inside parentheses and square brackets can span lines.
+	testTokens(t, []rune("f(a,\n  b)\nx"), []*Token{
+		&Token{TOKEN_WORD, 0, "f", 0},
+		&Token{TOKEN_LPARENTH, 1, nil, 0},
+		&Token{TOKEN_WORD, 2, "a", 0},
+		&Token{TOKEN_COMMA, 3, nil, 0},
+		&Token{TOKEN_WORD, 7, "b", 0},
+		&Token{TOKEN_RPARENTH, 8, nil, 0},
+		&Token{TOKEN_INDENT, 9, "", 0},
+		&Token{TOKEN_WORD, 10, "x", 0},
+		&Token{TOKEN_EOF, 11, nil, 0}})
+
+	// Braces inside parentheses open a block of code again.
+	testTokens(t, []rune("f({\n  b})"), []*Token{
+		&Token{TOKEN_WORD, 0, "f", 0},
+		&Token{TOKEN_LPARENTH, 1, nil, 0},
+		&Token{TOKEN_LBRACE, 2, nil, 0},
+		&Token{TOKEN_INDENT, 3, "  ", 0},
+		&Token{TOKEN_WORD, 6, "b", 0},
+		&Token{TOKEN_RBRACE, 7, nil, 0},
+		&Token{TOKEN_RPARENTH, 8, nil, 0},
+		&Token{TOKEN_EOF, 9, nil, 0}})
+}
+
 func TestEquals(t *testing.T) {
 	testTokens(t, []rune("for == = <= >="), []*Token{
 		&Token{TOKEN_FOR, 0, nil, 0},
@@ -74,6 +149,26 @@ func TestNumbers(t *testing.T) {
 	testTokens(t, []rune("123"), []*Token{
 		&Token{TOKEN_INT, 0, "123", 0},
 		&Token{TOKEN_EOF, 3, nil, 0}})
+	testTokens(t, []rune("0xFF 0o17 0b1010"), []*Token{
+		&Token{TOKEN_INT, 0, "0xFF", 0},
+		&Token{TOKEN_INT, 5, "0o17", 0},
+		&Token{TOKEN_INT, 10, "0b1010", 0},
+		&Token{TOKEN_EOF, 16, nil, 0}})
+	testTokens(t, []rune("3 3.14 1e10 2i"), []*Token{
+		&Token{TOKEN_INT, 0, "3", 0},
+		&Token{TOKEN_FLOAT, 2, "3.14", 0},
+		&Token{TOKEN_FLOAT, 7, "1e10", 0},
+		&Token{TOKEN_IMAG, 12, "2i", 0},
+		&Token{TOKEN_EOF, 14, nil, 0}})
+}
+
+func TestLeadingDotFloat(t *testing.T) {
+	testTokens(t, []rune(".5 a.b"), []*Token{
+		&Token{TOKEN_FLOAT, 0, ".5", 0},
+		&Token{TOKEN_WORD, 3, "a", 0},
+		&Token{TOKEN_DOT, 4, ".", 0},
+		&Token{TOKEN_WORD, 5, "b", 0},
+		&Token{TOKEN_EOF, 6, nil, 0}})
 }
 
 func TestKeywords(t *testing.T) {
@@ -81,6 +176,28 @@ func TestKeywords(t *testing.T) {
 		&Token{TOKEN_VAR, 0, nil, 0},
 		&Token{TOKEN_FOR, 4, nil, 0},
 		&Token{TOKEN_EOF, 7, nil, 0}})
+	testTokens(t, []rune("go goto gone"), []*Token{
+		&Token{TOKEN_GO, 0, nil, 0},
+		&Token{TOKEN_GOTO, 3, nil, 0},
+		&Token{TOKEN_WORD, 8, "gone", 0},
+		&Token{TOKEN_EOF, 12, nil, 0}})
+	testTokens(t, []rune("const constant"), []*Token{
+		&Token{TOKEN_CONST, 0, nil, 0},
+		&Token{TOKEN_WORD, 6, "constant", 0},
+		&Token{TOKEN_EOF, 14, nil, 0}})
+}
+
+func TestShebang(t *testing.T) {
+	testTokens(t, []rune("#!/usr/bin/have\nvar x"), []*Token{
+		&Token{TOKEN_VAR, 16, nil, 0},
+		&Token{TOKEN_WORD, 20, "x", 0},
+		&Token{TOKEN_EOF, 21, nil, 0}})
+
+	// Only the first line can be a shebang.
+	testTokens(t, []rune("var\n#!/usr/bin/have"), []*Token{
+		&Token{TOKEN_VAR, 0, nil, 0},
+		&Token{TOKEN_INDENT, 3, "", 0},
+		&Token{TOKEN_UNEXP_CHAR, 4, '#', 0}})
 }
 
 func TestString(t *testing.T) {
@@ -97,6 +214,24 @@ func TestString(t *testing.T) {
 		&Token{TOKEN_STR, 0, "`12\"3`", 0},
 		&Token{TOKEN_WORD, 7, "hej", 0},
 		&Token{TOKEN_EOF, 10, nil, 0}})
+
+	// Raw strings keep backslashes and newlines.
+	testTokens(t, []rune("`a\\n\n\"b\"` c"), []*Token{
+		&Token{TOKEN_STR, 0, "`a\\n\n\"b\"`", 0},
+		&Token{TOKEN_WORD, 10, "c", 0},
+		&Token{TOKEN_EOF, 11, nil, 0}})
+	testTokens(t, []rune("`abc"), []*Token{
+		&Token{TOKEN_UNEXP_CHAR, 0, '`', 0}})
+
+	// Adjacent literals aren't concatenated.
+	testTokens(t, []rune(`"a" "b"`), []*Token{
+		&Token{TOKEN_STR, 0, `"a"`, 0},
+		&Token{TOKEN_STR, 4, `"b"`, 0},
+		&Token{TOKEN_EOF, 7, nil, 0}})
+	testTokens(t, []rune("\"a\"`b`"), []*Token{
+		&Token{TOKEN_STR, 0, `"a"`, 0},
+		&Token{TOKEN_STR, 3, "`b`", 0},
+		&Token{TOKEN_EOF, 6, nil, 0}})
 }
 
 func TestRune(t *testing.T) {
@@ -104,6 +239,16 @@ func TestRune(t *testing.T) {
 		&Token{TOKEN_RUNE, 0, "'@'", 0}})
 	testTokens(t, []rune("'ą'"), []*Token{
 		&Token{TOKEN_RUNE, 0, "'ą'", 0}})
+	testTokens(t, []rune(`'\n' '\'' '\x41' '\u0105'`), []*Token{
+		&Token{TOKEN_RUNE, 0, `'\n'`, 0},
+		&Token{TOKEN_RUNE, 5, `'\''`, 0},
+		&Token{TOKEN_RUNE, 10, `'\x41'`, 0},
+		&Token{TOKEN_RUNE, 17, `'\u0105'`, 0},
+		&Token{TOKEN_EOF, 25, nil, 0}})
+	testTokens(t, []rune("'a"), []*Token{
+		&Token{TOKEN_UNEXP_CHAR, 0, '\'', 0}})
+	testTokens(t, []rune("'ab'"), []*Token{
+		&Token{TOKEN_UNEXP_CHAR, 0, '\'', 0}})
 }
 
 func TestBraces(t *testing.T) {
@@ -122,6 +267,85 @@ func TestPlus(t *testing.T) {
 		&Token{TOKEN_EOF, 7, nil, 0}})
 }
 
+func TestShortVarDecl(t *testing.T) {
+	testTokens(t, []rune("a := b:"), []*Token{
+		&Token{TOKEN_WORD, 0, "a", 0},
+		&Token{TOKEN_DEFINE, 2, ":=", 0},
+		&Token{TOKEN_WORD, 5, "b", 0},
+		&Token{TOKEN_COLON, 6, nil, 0},
+		&Token{TOKEN_EOF, 7, nil, 0}})
+}
+
+func TestXor(t *testing.T) {
+	testTokens(t, []rune("a^b ^= ^c"), []*Token{
+		&Token{TOKEN_WORD, 0, "a", 0},
+		&Token{TOKEN_XOR, 1, "^", 0},
+		&Token{TOKEN_WORD, 2, "b", 0},
+		&Token{TOKEN_XOR_ASSIGN, 4, "^=", 0},
+		&Token{TOKEN_XOR, 7, "^", 0},
+		&Token{TOKEN_WORD, 8, "c", 0},
+		&Token{TOKEN_EOF, 9, nil, 0}})
+}
+
+func TestCompoundAssignments(t *testing.T) {
+	testTokens(t, []rune("a %= b &= c |= d"), []*Token{
+		&Token{TOKEN_WORD, 0, "a", 0},
+		&Token{TOKEN_PERCENT_ASSIGN, 2, "%=", 0},
+		&Token{TOKEN_WORD, 5, "b", 0},
+		&Token{TOKEN_AMP_ASSIGN, 7, "&=", 0},
+		&Token{TOKEN_WORD, 10, "c", 0},
+		&Token{TOKEN_PIPE_ASSIGN, 12, "|=", 0},
+		&Token{TOKEN_WORD, 15, "d", 0},
+		&Token{TOKEN_EOF, 16, nil, 0}})
+	testTokens(t, []rune("a <<= b >>= c &^= d"), []*Token{
+		&Token{TOKEN_WORD, 0, "a", 0},
+		&Token{TOKEN_SHL_ASSIGN, 2, "<<=", 0},
+		&Token{TOKEN_WORD, 6, "b", 0},
+		&Token{TOKEN_SHR_ASSIGN, 8, ">>=", 0},
+		&Token{TOKEN_WORD, 12, "c", 0},
+		&Token{TOKEN_AND_NOT_ASSIGN, 14, "&^=", 0},
+		&Token{TOKEN_WORD, 18, "d", 0},
+		&Token{TOKEN_EOF, 19, nil, 0}})
+	// Operators without the assignment are still recognized.
+	testTokens(t, []rune("a%b&^c<<d&e"), []*Token{
+		&Token{TOKEN_WORD, 0, "a", 0},
+		&Token{TOKEN_PERCENT, 1, "%", 0},
+		&Token{TOKEN_WORD, 2, "b", 0},
+		&Token{TOKEN_AND_NOT, 3, "&^", 0},
+		&Token{TOKEN_WORD, 5, "c", 0},
+		&Token{TOKEN_SHL, 6, "<<", 0},
+		&Token{TOKEN_WORD, 8, "d", 0},
+		&Token{TOKEN_AMP, 9, "&", 0},
+		&Token{TOKEN_WORD, 10, "e", 0},
+		&Token{TOKEN_EOF, 11, nil, 0}})
+}
+
+func TestBlankIdent(t *testing.T) {
+	testTokens(t, []rune("_ _foo"), []*Token{
+		&Token{TOKEN_WORD, 0, "_", 0},
+		&Token{TOKEN_WORD, 2, "_foo", 0},
+		&Token{TOKEN_EOF, 6, nil, 0}})
+
+	fs := gotoken.NewFileSet()
+	in := []rune("_ _foo foo_")
+	l := NewLexer(in, fs.AddFile("a.go", fs.Base(), len(in)), 0)
+	for _, blank := range []bool{true, false, false} {
+		if tok := l.Next(); tok.IsBlank() != blank {
+			t.Errorf("IsBlank() of %v is %v, expected %v", tok, tok.IsBlank(), blank)
+		}
+	}
+}
+
+func TestTypeSetUnion(t *testing.T) {
+	testTokens(t, []rune("~int | ~float64"), []*Token{
+		&Token{TOKEN_TILDE, 0, "~", 0},
+		&Token{TOKEN_WORD, 1, "int", 0},
+		&Token{TOKEN_PIPE, 5, "|", 0},
+		&Token{TOKEN_TILDE, 7, "~", 0},
+		&Token{TOKEN_WORD, 8, "float64", 0},
+		&Token{TOKEN_EOF, 15, nil, 0}})
+}
+
 func TestComments(t *testing.T) {
 	testTokens(t, []rune("\n//bla\n \n  for"), []*Token{
 		&Token{TOKEN_INDENT, 8, "  ", 0},
@@ -164,3 +388,49 @@ func TestFragment(t *testing.T) {
 		t.Fatalf("Not equal: '%s'", substr)
 	}
 }
+
+func TestNewlineInString(t *testing.T) {
+	tokens, err := SafeTokenize([]rune("x = \"a\nb\""))
+	if err == nil {
+		t.Fatalf("Multi-line interpreted string wasn't rejected")
+	}
+	if last := tokens[len(tokens)-1]; last.Type != TOKEN_UNEXP_CHAR || last.Offset != 6 {
+		t.Fatalf("Expected an error token at the newline, got %#v", last)
+	}
+
+	// Escaped newlines are fine.
+	if _, err := SafeTokenize([]rune("\"a\\nb\"")); err != nil {
+		t.Fatalf("Escaped newline was rejected: %s", err)
+	}
+	if _, err := SafeTokenize([]rune("`a\nb`")); err != nil {
+		t.Fatalf("Multi-line raw string was rejected: %s", err)
+	}
+}
+
+func TestSafeTokenize(t *testing.T) {
+	tokens, err := SafeTokenize([]rune("var x = 1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if len(tokens) != 5 || tokens[4].Type != TOKEN_EOF {
+		t.Fatalf("Unexpected tokens: %v", tokens)
+	}
+
+	for _, src := range []string{"$", "\"unterminated", "'", "/* unterminated", "0x", "1e"} {
+		if _, err := SafeTokenize([]rune(src)); err == nil {
+			t.Errorf("Expected an error for %q", src)
+		}
+	}
+}
+
+func FuzzSafeTokenize(f *testing.F) {
+	for _, seed := range []string{"var x = 1", "func f() {\n\tpass\n}", "\"a\\", "'", "0x", ".5", "(\n[\n{\n", "0\U000afbef"} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, src []byte) {
+		// Panics are converted to errors, but they still are bugs.
+		if _, err := SafeTokenize([]rune(string(src))); err != nil && strings.HasPrefix(err.Error(), "Lexer failure") {
+			t.Fatalf("Lexer panicked on %q: %s", src, err)
+		}
+	})
+}
@@ -2,6 +2,7 @@ package have
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	gotoken "go/token"
@@ -14,6 +15,9 @@ type Package struct {
 	manager *PkgManager
 	tc      *TypesContext
 	Fset    *gotoken.FileSet
+
+	// Register the optional errorf builtin, see PkgManager.BuiltinErrorf.
+	builtinErrorf bool
 }
 
 func NewPackage(path string, files ...*File) *Package {
@@ -37,9 +41,13 @@ func (p *Package) addFile(f *File) {
 
 const BuiltinsFileName = "_builtin.hav"
 
-func builtinsFile(pkgName string) *File {
+// Optional builtin for constructing errors, calls are generated as calls of
+// fmt.Errorf, so generated files that use it import "fmt".
+const errorfBuiltin = `
+func errorf(format string, args ...any) error { __compiler_macro("fmt.Errorf(%a0, %v1)", "fmt") }`
+
+func builtinsFile(pkgName string, withErrorf bool) *File {
 	code := "package " + pkgName + `
-type error interface { func Error() string }
 func print(s ...interface{}) bool { return false }
 func read() string { pass }
 func len[T](c T) int { __compiler_macro("len(%a0)") }
@@ -52,7 +60,11 @@ func cap(v interface{}) int { pass }
 func copy[T](dst, src []T) int { __compiler_macro("copy(%a0, %a1)") }
 func delete[T, K](m map[T]K, key T) { __compiler_macro("delete(%a0, %a1)") }
 func panic(v interface{}) { pass }
+func recover() interface{} { pass }
 func close[T](c chan<- T) { pass }`
+	if withErrorf {
+		code += errorfBuiltin
+	}
 	return &File{
 		Name: BuiltinsFileName,
 		Code: code,
@@ -75,6 +87,9 @@ func newPackageWithManager(path string, manager *PkgManager) (*Package, error) {
 		tc:      NewTypesContext(),
 		Fset:    manager.Fset,
 	}
+	pkg.tc.enabledWarnings = manager.Warnings
+	pkg.tc.maxDepth = manager.MaxNestingDepth
+	pkg.builtinErrorf = manager.BuiltinErrorf
 
 	for _, f := range files {
 		pkg.addFile(f)
@@ -271,7 +286,7 @@ func (o *Package) ParseAndCheck() []error {
 		return errors
 	}
 
-	builtins := builtinsFile(pkgName)
+	builtins := builtinsFile(pkgName, o.builtinErrorf)
 	o.addFile(builtins)
 	errors = append(errors, builtins.Parse()...)
 
@@ -279,6 +294,9 @@ func (o *Package) ParseAndCheck() []error {
 		return errors
 	}
 
+	o.tc.builtinRecover = funcUnderneath(&Ident{object: builtins.objects["recover"]})
+	o.tc.builtinPanic = funcUnderneath(&Ident{object: builtins.objects["panic"]})
+
 	importPaths := map[string]bool{}
 
 	for _, f := range o.Files {
@@ -313,6 +331,17 @@ func (o *Package) ParseAndCheck() []error {
 		}
 	}
 
+	typeNames := []string{}
+	for name, obj := range o.objects {
+		if obj.ObjectType() == OBJECT_TYPE {
+			typeNames = append(typeNames, name)
+		}
+	}
+	sort.Strings(typeNames)
+	for _, name := range typeNames {
+		o.tc.typeDecls = append(o.tc.typeDecls, o.objects[name].(*TypeDecl))
+	}
+
 	for _, f := range o.Files {
 		for _, stmt := range f.statements {
 			stmt.loadDeps()
@@ -341,6 +370,9 @@ func (o *Package) ParseAndCheck() []error {
 		}
 	}
 
+	// Functions deferred by name are only known once everything is checked.
+	o.tc.checkRecoverCalls()
+
 	if len(errors) > 0 {
 		return errors
 	}
@@ -348,6 +380,11 @@ func (o *Package) ParseAndCheck() []error {
 	return errors
 }
 
+// Non-fatal diagnostics found while type checking the package.
+func (o *Package) Warnings() []*CompileError {
+	return o.tc.warnings
+}
+
 func (o *Package) GetObject(name string) Object {
 	return o.objects[name]
 }
@@ -370,6 +407,14 @@ type PkgManager struct {
 	locator   PkgLocator
 
 	Fset *gotoken.FileSet
+
+	// Opt-in warnings reported for loaded packages.
+	Warnings WarningSet
+	// Register the `errorf(format string, args ...any) error` builtin.
+	BuiltinErrorf bool
+	// Limit of how deeply expressions can be nested, deeper ones are reported
+	// as errors instead of overflowing the stack.
+	MaxNestingDepth int
 }
 
 func NewPkgManager(locator PkgLocator) *PkgManager {
@@ -378,6 +423,8 @@ func NewPkgManager(locator PkgLocator) *PkgManager {
 		greyNodes: make(map[string]bool),
 		locator:   locator,
 		Fset:      gotoken.NewFileSet(),
+
+		MaxNestingDepth: DefaultMaxNestingDepth,
 	}
 }
 
@@ -433,6 +480,21 @@ func (r *Instantiation) getGoName() string {
 	return r.goName
 }
 
+// Checks whether generic arguments satisfy constraints of the generic's params.
+func checkConstraints(g Generic, params []Type) error {
+	_, names := g.Signature()
+	for i, constraint := range g.Constraints() {
+		if constraint == nil || i >= len(params) {
+			continue
+		}
+		if !SatisfiesConstraint(params[i], constraint) {
+			return fmt.Errorf("Type %s doesn't satisfy constraint %s of generic param %s",
+				params[i], constraint, names[i])
+		}
+	}
+	return nil
+}
+
 func (r *Instantiation) ParseAndCheck() []error {
 	tfile, offset := r.Generic.Location()
 	r.parser = NewParser(NewLexer(r.Generic.Code(), tfile, offset))
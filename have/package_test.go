@@ -194,6 +194,40 @@ var y = (int)(10)`},
 	testPkg(t, false, files)
 }
 
+func TestCompilePackageDefer(t *testing.T) {
+	files := []struct {
+		name, file, gocode string
+	}{
+		{
+			"hello.hav",
+			`package main
+func cleanup() {
+	print("done")
+}
+func main() {
+	defer cleanup()
+	defer func() {
+		var r = recover()
+		print(r)
+	}()
+}`,
+			`package main
+
+func cleanup() {
+	print("done")
+}
+func main() {
+	defer cleanup()
+	defer func () {
+		var r = (interface{})(recover())
+		print(r)
+	}()
+}`,
+		},
+	}
+	testPkg(t, false, files)
+}
+
 func TestCompilePackageGenericFunc(t *testing.T) {
 	files := []struct {
 		name, file, gocode string
@@ -640,6 +674,33 @@ var aaa = (b.B)(b.B(123))`,
 	testPkgImport(t, files, outputCode, false)
 }
 
+func TestPkgImport_TypeCastsOfValues(t *testing.T) {
+	files := []fakeLocatorFile{
+		{"a", "a.hav", `package a
+import "b"
+func f(x int, p b.P) b.Foo {
+	var s = b.S(p)
+	return b.Foo(x)
+}`},
+		{"b", "b.hav", `package b
+type Foo int
+struct S { x int }
+struct P { x int }`},
+	}
+
+	outputCode := map[string]string{
+		"a.hav": `package a
+
+import b "b"
+func f(x int, p b.P) (b.Foo) {
+	var s = (b.S)(b.S(p))
+	return b.Foo(x)
+}`,
+	}
+
+	testPkgImport(t, files, outputCode, false)
+}
+
 func TestPkgImport3_Line(t *testing.T) {
 	files := []fakeLocatorFile{
 		{"a", "a.hav", `package a
@@ -40,6 +40,17 @@ type Parser struct {
 	nakedControlClause bool
 
 	prevLbl *LabelStmt // Just declared labal is stored here temporarily
+
+	// Set when the scope of the next code block is already open, function
+	// arguments are declared in the same scope as the function's body.
+	blockScopeOpen bool
+
+	// Current and maximum depth of nested expressions, types and blocks.
+	depth, maxDepth int
+
+	// Set right before parsing the type on the left of a composite literal,
+	// `[...]` is only allowed as the outermost part of that type.
+	inferredSizeAllowed bool
 }
 
 type Imports map[string]*ImportStmt
@@ -80,9 +91,22 @@ func NewParserWithoutBuiltins(lex *Lexer) *Parser {
 		unboundIdents:    make(map[string][]*Ident),
 		topLevelDecls:    make(map[string]Object),
 		imports:          make(map[string]*ImportStmt),
+		maxDepth:         DefaultMaxNestingDepth,
 	}
 }
 
+// Has to be paired with leave(). Like TypesContext.enter, it fails before
+// the stack overflows on deeply nested code.
+func (p *Parser) enter(t *Token) error {
+	p.depth++
+	if p.depth > p.maxDepth {
+		return CompileErrorf(t, "Code too deeply nested")
+	}
+	return nil
+}
+
+func (p *Parser) leave() { p.depth-- }
+
 // Put back a token.
 func (p *Parser) putBack(tok *Token) {
 	if tok == nil {
@@ -320,11 +344,24 @@ func (p *Parser) parseColonAndCustomBlock(terminators []TokenType) (*CodeBlock,
 
 // Parse an indented block of code.
 func (p *Parser) parseCustomCodeBlock(terminators []TokenType, consumeTerminator bool) (*CodeBlock, error) {
+	defer p.leave()
+	if err := p.enter(p.peek()); err != nil {
+		return nil, err
+	}
+
 	result := &CodeBlock{Labels: map[string]*LabelStmt{}}
 
 	p.branchTreesStack.pushNew()
 	defer p.branchTreesStack.pop()
 
+	// Every block is a scope, names declared in it shadow outer ones.
+	if p.blockScopeOpen {
+		p.blockScopeOpen = false
+	} else {
+		p.identStack.pushScope()
+		defer p.identStack.popScope()
+	}
+
 	isTerminator := func(typ TokenType) bool {
 		for _, t := range terminators {
 			if t == typ {
@@ -371,7 +408,7 @@ func (p *Parser) parseCustomCodeBlock(terminators []TokenType, consumeTerminator
 			if isTerminator(p.peek().Type) {
 				continue // Break in next iteration
 			}
-			return nil, CompileErrorf(p.peek(), "Unexpected token after a statement")
+			return nil, unexpectedAfterStmt(p.peek())
 		}
 	}
 
@@ -477,7 +514,7 @@ func (p *Parser) parseWhileLikeFor() (*ForStmt, error) {
 	var err error
 	result := ForStmt{}
 
-	result.Condition, err = p.parseExpr()
+	result.Condition, err = p.parseCtrlClauseExpr()
 	if err != nil {
 		return nil, err
 	}
@@ -857,7 +894,7 @@ func (p *Parser) parseFuncStmt() (Stmt, error) {
 
 	p.identStack.popScope()
 	p.identStack.addObject(funcVar)
-	return &VarStmt{stmt{expr: expr{ident.Pos}}, []*VarDecl{decl}, true}, nil
+	return &VarStmt{stmt: stmt{expr: expr{ident.Pos}}, Vars: []*VarDecl{decl}, IsFuncStmt: true}, nil
 }
 
 // varKeyword controls whether the `var` keyword should be expected
@@ -865,7 +902,7 @@ func (p *Parser) parseFuncStmt() (Stmt, error) {
 func (p *Parser) parseVarStmt(varKeyword bool) (*VarStmt, error) {
 	firstTok := p.nextToken()
 	if varKeyword {
-		if firstTok.Type != TOKEN_VAR {
+		if firstTok.Type != TOKEN_VAR && firstTok.Type != TOKEN_CONST {
 			return nil, CompileErrorf(firstTok, "Impossible happened")
 		}
 	} else {
@@ -873,12 +910,226 @@ func (p *Parser) parseVarStmt(varKeyword bool) (*VarStmt, error) {
 		p.putBack(firstTok)
 	}
 
-	vars, err := p.parseVarDecl()
+	isConst := varKeyword && firstTok.Type == TOKEN_CONST
+
+	var vars []*VarDecl
+	var err error
+	if isConst {
+		vars, err = p.parseConstDecl()
+	} else {
+		vars, err = p.parseVarDecl()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := &VarStmt{stmt: stmt{expr: expr{firstTok.Pos}}, Vars: vars, IsConst: isConst}
+
+	for _, vd := range vars {
+		if isConst && len(vd.Inits) == 0 {
+			return nil, CompileErrorf(firstTok, "Missing value in const declaration of %s", vd.Vars[0].name)
+		}
+	}
+
+	stmt.Vars.eachPair(func(v *Variable, init Expr) {
+		v.isConst = isConst
+		if _, noType := v.Type.(*UnknownType); isConst && noType {
+			v.untyped = true
+		}
+		p.identStack.addObject(v)
+	})
+
+	return stmt, nil
+}
+
+// Parses specs of a const declaration, either a single one or a group:
+//
+//	const (
+//		A = iota
+//		B
+//	)
+//
+// Like in Go, a spec without a type and initializers repeats those of
+// the previous spec, and `iota` is the index of the spec in its group.
+func (p *Parser) parseConstDecl() ([]*VarDecl, error) {
+	grouped := false
+	if p.peek().Type == TOKEN_LPARENTH {
+		p.nextToken()
+		grouped = true
+	}
+
+	var result []*VarDecl
+	var prevTail []*Token
+
+	for iota := 0; ; iota++ {
+		if grouped {
+			if _, ok := p.expect(TOKEN_RPARENTH); ok {
+				return result, nil
+			}
+		}
+
+		spec := p.scanConstSpec(grouped)
+		if len(spec) == 0 {
+			return nil, CompileErrorf(p.peek(), "Expected const declaration")
+		}
+
+		// Leading list of names, the rest is the type and initializers.
+		n := 1
+		for n+1 < len(spec) && spec[n].Type == TOKEN_COMMA && spec[n+1].Type == TOKEN_WORD {
+			n += 2
+		}
+		names, tail := spec[:n], spec[n:]
+		if len(tail) == 0 && prevTail != nil {
+			tail = prevTail
+		}
+		prevTail = tail
+
+		tokens := append([]*Token{}, names...)
+		for i, t := range tail {
+			if t.Type == TOKEN_WORD && t.Value.(string) == "iota" && (i == 0 || tail[i-1].Type != TOKEN_DOT) {
+				t = &Token{Type: TOKEN_INT, Offset: t.Offset, Value: strconv.Itoa(iota), Pos: t.Pos}
+			}
+			tokens = append(tokens, t)
+		}
+		end := &Token{Type: TOKEN_SEMICOLON, Offset: spec[len(spec)-1].Offset, Pos: spec[len(spec)-1].Pos}
+		p.putBackStack(append(tokens, end))
+
+		decls, err := p.parseVarDecl()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.expect(TOKEN_SEMICOLON); !ok || t != end {
+			return nil, CompileErrorf(t, "Unexpected token in const declaration: %s", t.Type)
+		}
+		result = append(result, decls...)
+
+		if !grouped {
+			return result, nil
+		}
+	}
+}
+
+// Consumes tokens of one const spec. In groups every spec starts on
+// a new line, newlines inside brackets don't end the spec.
+func (p *Parser) scanConstSpec(grouped bool) []*Token {
+	var spec []*Token
+	depth := 0
+
+	for {
+		t := p.nextToken()
+		if t.Type == TOKEN_EOF {
+			p.putBack(t)
+			return spec
+		}
+		if grouped && depth == 0 && len(spec) > 0 &&
+			p.lex.tfile.Line(t.Pos) != p.lex.tfile.Line(spec[len(spec)-1].Pos) {
+			p.putBack(t)
+			return spec
+		}
+
+		switch t.Type {
+		case TOKEN_LPARENTH, TOKEN_LBRACKET, TOKEN_LBRACE:
+			depth++
+		case TOKEN_RPARENTH, TOKEN_RBRACKET, TOKEN_RBRACE:
+			if depth == 0 {
+				p.putBack(t)
+				return spec
+			}
+			depth--
+		case TOKEN_SEMICOLON:
+			if depth == 0 {
+				return spec
+			}
+		case TOKEN_INDENT:
+			if depth == 0 {
+				p.putBack(t)
+				return spec
+			}
+		}
+		spec = append(spec, t)
+	}
+}
+
+// Tells whether the next tokens form a short variable declaration,
+// e.g. `a, b := f()`. No tokens are consumed.
+func (p *Parser) scanForShortVarDecl() bool {
+	stack := []*Token{}
+	defer func() { p.putBackStack(stack) }()
+
+	for {
+		t := p.nextToken()
+		stack = append(stack, t)
+		if t.Type != TOKEN_WORD {
+			return false
+		}
+
+		t = p.nextToken()
+		stack = append(stack, t)
+		switch t.Type {
+		case TOKEN_DEFINE:
+			return true
+		case TOKEN_COMMA:
+		default:
+			return false
+		}
+	}
+}
+
+// Parses a short variable declaration, `a, b := x, y` is equivalent
+// to `var a, b = x, y`. Like in Go, variables already declared in the same
+// scope are only assigned, but at least one of the variables has to be new.
+func (p *Parser) parseShortVarDecl() (*VarStmt, error) {
+	firstTok := p.peek()
+	vars := []*Variable{}
+	reused := map[*Variable]bool{}
+	newVars := 0
+
+	for {
+		t := p.nextToken()
+		if t.Type != TOKEN_WORD {
+			return nil, CompileErrorf(t, "Expected identifier")
+		}
+		name := t.Value.(string)
+
+		if obj := p.identStack.findObjectInScope(name); obj != nil && name != Blank {
+			v, ok := obj.(*Variable)
+			if !ok {
+				return nil, CompileErrorf(t, "Cannot assign to %s", name)
+			}
+			if v.isConst {
+				return nil, CompileErrorf(t, "Cannot assign to %s, it's a constant", name)
+			}
+			vars = append(vars, v)
+			reused[v] = true
+		} else {
+			if name != Blank {
+				newVars++
+			}
+			vars = append(vars, &Variable{name: name, Type: &UnknownType{}})
+		}
+
+		t = p.nextToken()
+		if t.Type == TOKEN_DEFINE {
+			break
+		}
+		if t.Type != TOKEN_COMMA {
+			return nil, CompileErrorf(t, "Unexpected token %s", t.Type)
+		}
+	}
+
+	if newVars == 0 {
+		return nil, CompileErrorf(firstTok, "No new variables on the left side of :=")
+	}
+
+	inits, _, err := p.parseArgs(len(vars), false)
 	if err != nil {
 		return nil, err
 	}
 
-	stmt := &VarStmt{stmt{expr: expr{firstTok.Pos}}, vars, false}
+	stmt := &VarStmt{stmt: stmt{expr: expr{firstTok.Pos}}, Vars: DeclChain{&VarDecl{Vars: vars, Inits: inits}}}
+	if len(reused) > 0 {
+		stmt.Reused = reused
+	}
 
 	stmt.Vars.eachPair(func(v *Variable, init Expr) {
 		p.identStack.addObject(v)
@@ -1107,6 +1358,7 @@ func (p *Parser) parseStruct(receiverTypeDecl *TypeDecl, genericPossible bool) (
 	name := ""
 
 	var genericParams []string
+	var genericConstraints []Type
 	var err error
 
 	if receiverTypeDecl != nil {
@@ -1130,7 +1382,7 @@ func (p *Parser) parseStruct(receiverTypeDecl *TypeDecl, genericPossible bool) (
 			// Scope for generic params
 			p.identStack.pushScope()
 			defer p.identStack.popScope()
-			genericParams, err = p.parseGenericParams()
+			genericParams, genericConstraints, err = p.parseGenericParams()
 			if err != nil {
 				return nil, err
 			}
@@ -1156,7 +1408,7 @@ func (p *Parser) parseStruct(receiverTypeDecl *TypeDecl, genericPossible bool) (
 	}
 
 	selfType := &CustomType{Name: name, Decl: receiverTypeDecl}
-	result := &StructType{Name: name, Members: map[string]Type{}, Keys: []string{}, Methods: map[string]*FuncDecl{}, GenericParams: genericParams, selfType: selfType}
+	result := &StructType{Name: name, Members: map[string]Type{}, Embedded: map[string]bool{}, Keys: []string{}, Methods: map[string]*FuncDecl{}, GenericParams: genericParams, GenericConstraints: genericConstraints, selfType: selfType}
 
 	self, selfp := &Variable{name: "self", Type: selfType}, &Variable{name: "self", Type: &PointerType{To: selfType}}
 
@@ -1165,6 +1417,16 @@ func (p *Parser) parseStruct(receiverTypeDecl *TypeDecl, genericPossible bool) (
 
 		switch token.Type {
 		case TOKEN_WORD:
+			switch p.peek().Type {
+			case TOKEN_INDENT, TOKEN_SEMICOLON, TOKEN_RBRACE:
+				// Embedded field, named after its type.
+				p.putBack(token)
+				if err = p.parseEmbeddedField(result, token.Value.(string)); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
 			names := []string{token.Value.(string)}
 
 			for p.peek().Type == TOKEN_COMMA {
@@ -1187,6 +1449,16 @@ func (p *Parser) parseStruct(receiverTypeDecl *TypeDecl, genericPossible bool) (
 				result.Members[name] = typ
 			}
 			result.Keys = append(result.Keys, names...)
+		case TOKEN_MUL:
+			// Embedded pointer field, e.g. `*Base`.
+			t, ok := p.expect(TOKEN_WORD)
+			if !ok {
+				return nil, CompileErrorf(t, "Expected type name after `*` in embedded field")
+			}
+			p.putBackStack([]*Token{token, t})
+			if err = p.parseEmbeddedField(result, t.Value.(string)); err != nil {
+				return nil, err
+			}
 		case TOKEN_FUNC:
 			if receiverTypeDecl == nil {
 				return nil, CompileErrorf(token, "Cannot declare methods in inline struct declarations")
@@ -1223,6 +1495,19 @@ func (p *Parser) parseStruct(receiverTypeDecl *TypeDecl, genericPossible bool) (
 	}
 }
 
+// Parses the type of an embedded field and adds it to the struct
+// under the name of the type.
+func (p *Parser) parseEmbeddedField(st *StructType, name string) error {
+	typ, err := p.parseType()
+	if err != nil {
+		return err
+	}
+	st.Members[name] = typ
+	st.Embedded[name] = true
+	st.Keys = append(st.Keys, name)
+	return nil
+}
+
 func (p *Parser) parseInterface(named bool) (*IfaceType, error) {
 	name := ""
 	if named {
@@ -1270,6 +1555,14 @@ func (p *Parser) parseInterface(named bool) (*IfaceType, error) {
 			fun.PtrReceiver = ptrReceiver
 			result.Methods[fun.name] = fun
 			result.Keys = append(result.Keys, fun.name)
+		case TOKEN_TILDE, TOKEN_WORD, TOKEN_LBRACKET, TOKEN_MUL, TOKEN_MAP:
+			// Type set element, e.g. `~int | ~float64`, or an embedded
+			// interface - they look the same until types are known.
+			p.putBack(token)
+			err = p.parseTypeSetUnion(result)
+			if err != nil {
+				return nil
+			}
 		case TOKEN_PASS:
 		default:
 			return token
@@ -1279,6 +1572,9 @@ func (p *Parser) parseInterface(named bool) (*IfaceType, error) {
 
 	for {
 		token := parseMember()
+		if err != nil {
+			return nil, err
+		}
 
 		if token != nil {
 			switch token.Type {
@@ -1293,6 +1589,32 @@ func (p *Parser) parseInterface(named bool) (*IfaceType, error) {
 	}
 }
 
+// Parses a union of types from an interface's type set and appends
+// it to iface.
+func (p *Parser) parseTypeSetUnion(iface *IfaceType) error {
+	var union []*TypeSetTerm
+	for {
+		term := &TypeSetTerm{}
+		if p.peek().Type == TOKEN_TILDE {
+			p.nextToken()
+			term.Tilde = true
+		}
+
+		var err error
+		term.Type, err = p.parseType()
+		if err != nil {
+			return err
+		}
+		union = append(union, term)
+
+		if p.peek().Type != TOKEN_PIPE {
+			iface.TypeSet = append(iface.TypeSet, union)
+			return nil
+		}
+		p.nextToken()
+	}
+}
+
 func (p *Parser) parseChanType() (*ChanType, error) {
 	dir := CHAN_DIR_BI
 
@@ -1365,8 +1687,8 @@ func (p *Parser) typeFromWord(name string) Type {
 		}
 	} else {
 		// TODO: we don't want so much code which is mostly used just for tests
-		if _, ok := GetBuiltinType(name); ok {
-			return &SimpleType{ID: simpleTypeStrToID[name]}
+		if decl, ok := GetBuiltinType(name); ok {
+			return decl.Type()
 		}
 		return &CustomType{Name: name, Decl: nil}
 	}
@@ -1407,6 +1729,14 @@ var doesntLookLikeTypeErr = errors.New("Not a type")
 // to check if the next token could be the beginning of a type at all.
 func (p *Parser) attemptTypeParse(justTry bool) (Type, error) {
 	token := p.nextToken()
+	defer p.leave()
+	if err := p.enter(token); err != nil {
+		return nil, err
+	}
+
+	inferredSizeAllowed := p.inferredSizeAllowed
+	p.inferredSizeAllowed = false
+
 	switch token.Type {
 	case TOKEN_MUL:
 		ptrTo, err := p.parseType()
@@ -1450,7 +1780,7 @@ func (p *Parser) attemptTypeParse(justTry bool) (Type, error) {
 				return nil, CompileErrorf(t, "Expected ']'")
 			}
 
-			size, err := strconv.ParseInt(next.Value.(string), 10, 64)
+			size, err := strconv.ParseInt(next.Value.(string), 0, 64)
 			if err != nil {
 				return nil, CompileErrorf(next, "Couldn't parse array size")
 			}
@@ -1461,6 +1791,20 @@ func (p *Parser) attemptTypeParse(justTry bool) (Type, error) {
 			}
 
 			return &ArrayType{Of: arrayOf, Size: int(size)}, nil
+		case TOKEN_ELLIPSIS:
+			if !inferredSizeAllowed {
+				return nil, CompileErrorf(next, inferredSizeMisuse)
+			}
+			if t, ok := p.expect(TOKEN_RBRACKET); !ok {
+				return nil, CompileErrorf(t, "Expected ']'")
+			}
+
+			arrayOf, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+
+			return &ArrayType{Of: arrayOf, Size: ArraySizeInferred}, nil
 		default:
 			return nil, CompileErrorf(next, "Invalid type name, expected slice or array")
 
@@ -1509,6 +1853,9 @@ func (p *Parser) attemptTypeParse(justTry bool) (Type, error) {
 				p.unboundTypes[name] = append(p.unboundTypes[name], typ)
 				return typ, nil
 			} else {
+				if name == comparableConstraint {
+					return nil, CompileErrorf(token, "`%s` can only be used as a constraint of a generic param", name)
+				}
 				return p.typeFromWord(name), nil
 			}
 		}
@@ -1546,6 +1893,31 @@ func (p *Parser) parseTypeExpr() (*TypeExpr, error) {
 	return &TypeExpr{expr{loc}, typ}, nil
 }
 
+// Identifiers inside compound literals aren't bound, because they can turn out
+// to be member names. The type name on the left of a nested literal can't be
+// a member name though, so it has to be bound like outside of literals.
+func (p *Parser) bindLiteralTypeName(left Expr) {
+	if !p.ignoreUnknowns || p.dontLookup {
+		return
+	}
+
+	ident, ok := left.(*Ident)
+	if !ok {
+		if sel, isSel := left.(*DotSelector); isSel {
+			ident, ok = sel.Left.(*Ident)
+		}
+	}
+	if !ok || ident.object != nil {
+		return
+	}
+
+	if pkg := p.imports[ident.name]; pkg != nil {
+		ident.object = pkg
+	} else {
+		p.unboundIdents[ident.name] = append(p.unboundIdents[ident.name], ident)
+	}
+}
+
 // Parses either a function type name or a function literal. It's useful because they
 // begin similarily and can both be used in primary expressions.
 // Returns either TypeExpr with function type or FuncDecl.
@@ -1572,6 +1944,11 @@ func (p *Parser) wordToExpr(word *Token) PrimaryExpr {
 	ident := &Ident{expr: expr{word.Pos}, name: name}
 	var result PrimaryExpr = ident
 
+	if word.IsBlank() {
+		// The blank identifier never refers to an object.
+		return result
+	}
+
 	if p.parsingGenericInstantiation() && p.genericParams[name] != nil {
 		typ, ok := p.genericParams[name]
 		if !ok {
@@ -1602,6 +1979,7 @@ func (p *Parser) parsePrimaryExpr() (PrimaryExpr, error) {
 	// either a literal or an expression that will be type-converted.
 	// In such situations, we should skip any indents in-between.
 	needsMore := false
+	var skippedIndent *Token
 
 	switch token.Type {
 	case TOKEN_LPARENTH:
@@ -1615,19 +1993,26 @@ func (p *Parser) parsePrimaryExpr() (PrimaryExpr, error) {
 	case TOKEN_WORD:
 		left = p.wordToExpr(token)
 	case TOKEN_STR:
-		left = &BasicLit{expr{token.Pos}, token}
+		value, err := strconv.Unquote(token.Value.(string))
+		if err != nil {
+			return nil, CompileErrorf(token, "Invalid string literal")
+		}
+		left = &BasicLit{expr: expr{token.Pos}, token: token, value: value}
 	case TOKEN_INT, TOKEN_FLOAT, TOKEN_IMAG, TOKEN_TRUE, TOKEN_FALSE, TOKEN_RUNE:
-		return &BasicLit{expr{token.Pos}, token}, nil
+		return &BasicLit{expr: expr{token.Pos}, token: token}, nil
 	case TOKEN_NIL:
-		return &NilExpr{}, nil
+		return &NilExpr{expr{token.Pos}}, nil
 	case TOKEN_FUNC:
 		p.putBack(token)
 		left, err = p.parseFuncTypeOrLit()
 		if err != nil {
 			return nil, err
 		}
-	case TOKEN_MAP, TOKEN_STRUCT, TOKEN_LBRACKET:
+	case TOKEN_MAP, TOKEN_STRUCT, TOKEN_LBRACKET, TOKEN_CHAN:
 		p.putBack(token)
+		// It can be the type of a literal, but that's only known once
+		// `{` follows, see the check in the loop below.
+		p.inferredSizeAllowed = true
 		left, err = p.parseTypeExpr()
 		if err != nil {
 			return nil, err
@@ -1640,6 +2025,21 @@ func (p *Parser) parsePrimaryExpr() (PrimaryExpr, error) {
 		if err != nil {
 			return nil, err
 		}
+	case TOKEN_UNEXP_CHAR:
+		// The lexer gives up on malformed literals at their first character,
+		// or at the newline inside an interpreted string.
+		switch token.Value {
+		case '\n':
+			return nil, CompileErrorf(token, "Newline in string literal")
+		case '`':
+			return nil, CompileErrorf(token, "Unterminated raw string literal")
+		case '"':
+			// Either unterminated, or with an invalid escape sequence.
+			return nil, CompileErrorf(token, "Invalid string literal")
+		case '\'':
+			return nil, CompileErrorf(token, "Invalid rune literal")
+		}
+		return nil, CompileErrorf(token, "Unexpected token (expected a primary expression): %s", token.Type)
 	default:
 		return nil, CompileErrorf(token, "Unexpected token (expected a primary expression): %s", token.Type)
 	}
@@ -1647,6 +2047,10 @@ func (p *Parser) parsePrimaryExpr() (PrimaryExpr, error) {
 loop:
 	for {
 		token = p.nextToken()
+		if token.Type != TOKEN_LBRACE && token.Type != TOKEN_INDENT && isInferredSizeArray(left) {
+			return nil, ExprErrorf(left, inferredSizeMisuse)
+		}
+
 		switch token.Type {
 		case TOKEN_DOT:
 			// TODO: parse type assertions
@@ -1678,7 +2082,11 @@ loop:
 			if t, ok := p.expect(TOKEN_RPARENTH); !ok {
 				return nil, CompileErrorf(t, "Expected `)`")
 			}
-			left = &FuncCallExpr{expr{token.Pos}, left, args, ellipsis, nil}
+			var caller *FuncDecl
+			if len(p.funcStack) > 0 {
+				caller = p.funcStack[len(p.funcStack)-1]
+			}
+			left = &FuncCallExpr{expr{token.Pos}, left, args, ellipsis, nil, caller}
 		case TOKEN_LBRACKET:
 			var index []Expr
 			exp, err := p.parseEnclosedExpr()
@@ -1727,6 +2135,8 @@ loop:
 				}
 			}
 
+			p.bindLiteralTypeName(left)
+
 			literal, err := p.parseCompoundLit()
 			if err != nil {
 				return nil, err
@@ -1740,26 +2150,52 @@ loop:
 				p.putBack(token)
 				break loop
 			}
+			// A literal might follow the type in the next line. If it doesn't,
+			// the indent ends the statement and has to be put back.
+			skippedIndent = token
+			continue
 		default:
 			p.putBack(token)
+			if skippedIndent != nil {
+				p.putBack(skippedIndent)
+			}
 			break loop
 		}
 		// Something was just loaded.
 		needsMore = false
+		skippedIndent = nil
 	}
 
 	return left, nil
 }
 
+const inferredSizeMisuse = "Invalid use of `[...]`, array length can only be inferred in composite literals"
+
+func isInferredSizeArray(e Expr) bool {
+	if te, ok := e.(*TypeExpr); ok {
+		arr, ok := te.typ.(*ArrayType)
+		return ok && arr.Size == ArraySizeInferred
+	}
+	return false
+}
+
 // Return primary expression, possibly wrapped in an unary operator
 func (p *Parser) parseMaybeUnaryExpr() (Expr, error) {
 	token := p.nextToken()
+	defer p.leave()
+	if err := p.enter(token); err != nil {
+		return nil, err
+	}
+
 	isOp, _ := opSet[token.Type] // FIXME we should create another set with just unary operators
 	if isOp || token.Type == TOKEN_SEND {
 		primaryExpr, err := p.parseMaybeUnaryExpr()
 		if err != nil {
 			return nil, err
 		}
+		if lit, ok := primaryExpr.(*BasicLit); ok && token.Type == TOKEN_MINUS {
+			lit.negated = true
+		}
 		return &UnaryOp{op: token, Right: primaryExpr}, nil
 	} else {
 		p.putBack(token)
@@ -1772,7 +2208,7 @@ var hierarchy [][]TokenType = [][]TokenType{
 	{TOKEN_PLUS, TOKEN_MINUS, TOKEN_PIPE},
 	{TOKEN_SHL, TOKEN_SHR},
 	{TOKEN_LT, TOKEN_GT, TOKEN_EQ_GT, TOKEN_EQ_LT},
-	{TOKEN_EQUALS},
+	{TOKEN_EQUALS, TOKEN_NEQUALS},
 	{TOKEN_OR, TOKEN_AND}}
 
 var opSet map[TokenType]bool = make(map[TokenType]bool)
@@ -2018,27 +2454,40 @@ func typesFromVars(vd DeclChain) []Type {
 	return result
 }
 
-func (p *Parser) parseGenericParams() ([]string, error) {
+// Parses a list of generic params, each one optionally followed by its constraint,
+// e.g. `[T, K Number]`. Constraints of unconstrained params are nil.
+func (p *Parser) parseGenericParams() ([]string, []Type, error) {
 	t, ok := p.expect(TOKEN_LBRACKET)
 	if !ok {
-		return nil, CompileErrorf(t, "Expected `[`")
+		return nil, nil, CompileErrorf(t, "Expected `[`")
 	}
 	genericTypes := []string{}
+	constraints := []Type{}
 
 loop:
 	for {
 		typeName, ok := p.expect(TOKEN_WORD)
 		if !ok {
-			return nil, CompileErrorf(typeName, "Expected generic type name")
+			return nil, nil, CompileErrorf(typeName, "Expected generic type name")
 		}
 
 		name := typeName.Value.(string)
 
+		var constraint Type
+		if next := p.peek().Type; next != TOKEN_COMMA && next != TOKEN_RBRACKET {
+			var err error
+			constraint, err = p.parseConstraint()
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+
 		if !p.parsingGenericInstantiation() {
 			// When parsing a generic instantiation, ignore the params.
 			// We're just re-parsing the code, substituting generic params occurences
 			// with concrete types as we go.
 			genericTypes = append(genericTypes, name)
+			constraints = append(constraints, constraint)
 
 			p.identStack.addObject(&GenericParamTypeDecl{
 				stmt: stmt{expr: expr{typeName.Pos}},
@@ -2051,11 +2500,21 @@ loop:
 		case TOKEN_RBRACKET:
 			break loop
 		default:
-			return nil, CompileErrorf(t, "Unexpected token %s", t)
+			return nil, nil, CompileErrorf(t, "Unexpected token %s", t)
 		}
 	}
 
-	return genericTypes, nil
+	return genericTypes, constraints, nil
+}
+
+// Parses a constraint of a generic param. Besides ordinary interface types it
+// accepts `comparable`, which isn't allowed anywhere else.
+func (p *Parser) parseConstraint() (Type, error) {
+	if t := p.peek(); t.Type == TOKEN_WORD && t.Value.(string) == comparableConstraint {
+		p.nextToken()
+		return p.typeFromWord(comparableConstraint), nil
+	}
+	return p.parseType()
 }
 
 // Parses function header (declaration without the body).
@@ -2075,6 +2534,7 @@ func (p *Parser) parseFuncHeader(genericPossible bool) (*FuncDecl, error) {
 
 	funcName := ""
 	genericTypes := []string{}
+	var genericConstraints []Type
 
 	t := p.nextToken()
 	switch t.Type {
@@ -2085,7 +2545,7 @@ func (p *Parser) parseFuncHeader(genericPossible bool) (*FuncDecl, error) {
 			if !genericPossible {
 				return nil, CompileErrorf(p.peek(), "Unexpected generic function")
 			}
-			genericTypes, err = p.parseGenericParams()
+			genericTypes, genericConstraints, err = p.parseGenericParams()
 			if err != nil {
 				return nil, err
 			}
@@ -2151,7 +2611,8 @@ func (p *Parser) parseFuncHeader(genericPossible bool) (*FuncDecl, error) {
 			Results:  typesFromVars(results),
 			Ellipsis: ellipsis,
 		},
-		GenericParams: genericTypes,
+		GenericParams:      genericTypes,
+		GenericConstraints: genericConstraints,
 	}, nil
 }
 
@@ -2229,6 +2690,7 @@ func (p *Parser) parseFuncBody(fd *FuncDecl) (*FuncDecl, error) {
 	p.funcStack = append(p.funcStack, fd)
 	defer func() { p.funcStack = p.funcStack[:len(p.funcStack)-1] }()
 
+	p.blockScopeOpen = true
 	block, err := p.parseCodeBlock()
 	if err != nil {
 		return nil, err
@@ -2311,6 +2773,56 @@ func (p *Parser) parseReturnStmt() (*ReturnStmt, error) {
 	}
 }
 
+func (p *Parser) parseDeferStmt() (*DeferStmt, error) {
+	tok, ok := p.expect(TOKEN_DEFER)
+	if !ok {
+		return nil, CompileErrorf(tok, "Expected `defer` keyword")
+	}
+
+	if len(p.funcStack) == 0 {
+		return nil, CompileErrorf(tok, "Defer statement used outside a function")
+	}
+
+	exp, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	call, ok := exp.(*FuncCallExpr)
+	if !ok {
+		return nil, ExprErrorf(exp, "Expression in defer must be a function call")
+	}
+
+	if fd, ok := call.Left.(*FuncDecl); ok {
+		fd.Deferred = true
+	}
+
+	return &DeferStmt{stmt: stmt{expr: expr{tok.Pos}}, Call: call}, nil
+}
+
+func (p *Parser) parseGoStmt() (*GoStmt, error) {
+	tok, ok := p.expect(TOKEN_GO)
+	if !ok {
+		return nil, CompileErrorf(tok, "Expected `go` keyword")
+	}
+
+	if len(p.funcStack) == 0 {
+		return nil, CompileErrorf(tok, "Go statement used outside a function")
+	}
+
+	exp, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	call, ok := exp.(*FuncCallExpr)
+	if !ok {
+		return nil, ExprErrorf(exp, "Expression in go must be a function call")
+	}
+
+	return &GoStmt{stmt: stmt{expr: expr{tok.Pos}}, Call: call}, nil
+}
+
 func (p *Parser) parseCompilerMacro() (*compilerMacro, error) {
 	tok := p.nextToken()
 	if tok.Type != TOKEN_WORD || tok.Value.(string) != "__compiler_macro" {
@@ -2331,6 +2843,11 @@ func (p *Parser) parseCompilerMacro() (*compilerMacro, error) {
 	}
 
 	result := &compilerMacro{stmt: stmt{expr: expr{tok.Pos}}, Args: args}
+	for i := 1; i < len(args); i++ {
+		if lit, ok := args[i].(*BasicLit); ok && lit.token.Type == TOKEN_STR {
+			result.goImports = append(result.goImports, lit.value)
+		}
+	}
 
 	if len(p.funcStack) == 0 {
 		return nil, CompileErrorf(tok, "__compiler_macro used outside a function")
@@ -2374,6 +2891,10 @@ func (p *Parser) parseInitOrAssign() (Stmt, error) {
 		return p.parseVarStmt(true)
 	}
 
+	if p.scanForShortVarDecl() {
+		return p.parseShortVarDecl()
+	}
+
 	s, err := p.parseSimpleStmt(false)
 	if err != nil {
 		return nil, err
@@ -2391,6 +2912,15 @@ func (p *Parser) parseInitOrAssign() (Stmt, error) {
 	return s, nil
 }
 
+func unexpectedAfterStmt(next *Token) error {
+	switch next.Type {
+	case TOKEN_INCREMENT, TOKEN_DECREMENT:
+		// Most likely something like `y = x++`.
+		return CompileErrorf(next, "Unexpected %s, it's a statement, not an expression", next.Value)
+	}
+	return CompileErrorf(next, "Unexpected token after a statement")
+}
+
 func (p *Parser) parseSimpleStmt(labelPossible bool) (SimpleStmt, error) {
 	// We make an exception if the next token is TOKEN_COLON, because TOKEN_COLON means
 	// that we're parsing a new label statement, so we don't want any ident lookups
@@ -2422,6 +2952,13 @@ func (p *Parser) parseSimpleStmt(labelPossible bool) (SimpleStmt, error) {
 		}
 
 		return &SendStmt{stmt{expr: expr{firstTok.Pos}}, lhs[0], rhs}, nil
+	case TOKEN_INCREMENT, TOKEN_DECREMENT:
+		if len(lhs) > 1 {
+			return nil, CompileErrorf(firstTok, "More than one expression on the left side of %s", firstTok.Value)
+		}
+
+		p.nextToken()
+		return &IncDecStmt{stmt{expr: expr{firstTok.Pos}}, lhs[0], firstTok}, nil
 	case TOKEN_PLUS_ASSIGN, TOKEN_MINUS_ASSIGN: // TODO: add other ops
 		if len(lhs) > 1 {
 			return nil, CompileErrorf(firstTok, "More than one expression on the left side of assignment")
@@ -2434,7 +2971,7 @@ func (p *Parser) parseSimpleStmt(labelPossible bool) (SimpleStmt, error) {
 			return nil, err
 		}
 		if len(lhs) != len(rhs) && len(rhs) != 1 {
-			return nil, CompileErrorf(t, "Different number of values in assignment (%d and %d)", len(lhs), len(rhs))
+			return nil, CompileErrorf(t, "Assignment mismatch: %d variables but %d values", len(lhs), len(rhs))
 		}
 		return &AssignStmt{stmt{expr: expr{firstTok.Pos}}, lhs, rhs, firstTok}, nil
 	}
@@ -2448,7 +2985,7 @@ func (p *Parser) parseSimpleStmt(labelPossible bool) (SimpleStmt, error) {
 	}
 
 	switch p.peek().Type {
-	// TODO: parse sending to channels, increment/decrement statements, maybe short var declarations, etc
+	// TODO: maybe short var declarations, etc
 	default:
 		return &ExprStmt{stmt{expr: expr{firstTok.Pos}}, lhs[0]}, nil
 	}
@@ -2520,8 +3057,10 @@ func (p *Parser) parseImportStmt() (*ImportStmt, error) {
 		return nil, CompileErrorf(t, "Expected package path")
 	}
 
-	path := t.Value.(string)
-	path = path[1 : len(path)-1]
+	path, err := strconv.Unquote(t.Value.(string))
+	if err != nil {
+		return nil, CompileErrorf(t, "Invalid package path %s", t.Value)
+	}
 	s := strings.Split(path, "/")
 	name := s[len(s)-1]
 
@@ -2675,7 +3214,7 @@ func (p *Parser) parseStmt() (Stmt, error) {
 	for {
 		token := p.nextToken()
 		switch token.Type {
-		case TOKEN_VAR:
+		case TOKEN_VAR, TOKEN_CONST:
 			p.putBack(token)
 			return p.parseVarStmt(true)
 		case TOKEN_IF:
@@ -2705,6 +3244,12 @@ func (p *Parser) parseStmt() (Stmt, error) {
 		case TOKEN_RETURN:
 			p.putBack(token)
 			return p.parseReturnStmt()
+		case TOKEN_DEFER:
+			p.putBack(token)
+			return p.parseDeferStmt()
+		case TOKEN_GO:
+			p.putBack(token)
+			return p.parseGoStmt()
 		case TOKEN_EOF:
 			return nil, nil
 		case TOKEN_STRUCT:
@@ -2725,6 +3270,9 @@ func (p *Parser) parseStmt() (Stmt, error) {
 				return p.parseCompilerMacro()
 			}
 			p.putBack(token)
+			if p.scanForShortVarDecl() {
+				return p.parseShortVarDecl()
+			}
 			stmt, err := p.parseSimpleStmt(true)
 			p.prevLbl, _ = stmt.(*LabelStmt)
 			return stmt, err
@@ -2772,6 +3320,10 @@ func (p *Parser) parseUnindentedBlock() ([]Stmt, error) {
 	for t := p.nextToken(); t.Type != TOKEN_EOF; t = p.nextToken() {
 		p.putBack(t)
 		stmt, err := p.parseStmt()
+		if indentErr := p.lex.IndentErr(); indentErr != nil {
+			// Parse errors are often caused by broken indentation, report it instead.
+			return nil, indentErr
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -2789,6 +3341,10 @@ func (p *Parser) Parse() ([]*TopLevelStmt, error) {
 	for t := p.nextToken(); t.Type != TOKEN_EOF; t = p.nextToken() {
 		p.putBack(t)
 		stmt, err := p.parseStmt()
+		if indentErr := p.lex.IndentErr(); indentErr != nil {
+			// Parse errors are often caused by broken indentation, report it instead.
+			return nil, indentErr
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -2796,6 +3352,11 @@ func (p *Parser) Parse() ([]*TopLevelStmt, error) {
 			// EOF
 			break
 		}
+		switch next := p.peek(); next.Type {
+		case TOKEN_INDENT, TOKEN_SEMICOLON, TOKEN_EOF:
+		default:
+			return nil, unexpectedAfterStmt(next)
+		}
 		result = append(result, &TopLevelStmt{
 			Stmt:          stmt,
 			unboundTypes:  p.unboundTypes,
@@ -77,13 +77,13 @@ func TestPrimaryExpr(t *testing.T) {
 				expr:  expr{5},
 				Left:  &Ident{expr{1}, "test", nil, false},
 				Right: &Ident{expr{6}, "tere", nil, false}},
-			Index: []Expr{&BasicLit{expr{10}, &Token{TOKEN_INT, 10, 123, 1}}}})
+			Index: []Expr{&BasicLit{expr: expr{10}, token: &Token{TOKEN_INT, 10, 123, 1}}}})
 	testPrimaryExpr(t, "dywan[1:5]", &ArrayExpr{
 		expr: expr{6},
 		Left: &Ident{expr{1}, "dywan", nil, false},
 		Index: []Expr{&SliceExpr{expr: expr{7},
-			From: &BasicLit{expr{6}, &Token{TOKEN_INT, 6, 1, 1}},
-			To:   &BasicLit{expr{8}, &Token{TOKEN_INT, 8, 5, 1}},
+			From: &BasicLit{expr: expr{6}, token: &Token{TOKEN_INT, 6, 1, 1}},
+			To:   &BasicLit{expr: expr{8}, token: &Token{TOKEN_INT, 8, 5, 1}},
 		}},
 	})
 	testPrimaryExpr(t, "{1,2}", &CompoundLit{expr: expr{1}})
@@ -202,9 +202,9 @@ func testArgs(t *testing.T, code string, expected []Expr) {
 func TestArgs(t *testing.T) {
 	testArgs(t, "", []Expr{})
 	testArgs(t, ")", []Expr{})
-	testArgs(t, "1,bla", []Expr{&BasicLit{expr{1}, &Token{TOKEN_INT, 0, "1", 1}},
+	testArgs(t, "1,bla", []Expr{&BasicLit{expr: expr{1}, token: &Token{TOKEN_INT, 0, "1", 1}},
 		&Ident{expr{3}, "bla", nil, false}})
-	testArgs(t, "1,bla)", []Expr{&BasicLit{expr{1}, &Token{TOKEN_INT, 0, "1", 1}},
+	testArgs(t, "1,bla)", []Expr{&BasicLit{expr: expr{1}, token: &Token{TOKEN_INT, 0, "1", 1}},
 		&Ident{expr{3}, "bla", nil, false}})
 }
 
@@ -572,6 +572,14 @@ func TestIdentSearch(t *testing.T) {
 		}
 	}
 }`, true},
+		{`func abc(x int) {
+	_ = x
+	var _, y = x, 1
+	_, y = y, x
+}`, true},
+		{`func abc(x int) {
+	_foo = x
+}`, false},
 	}
 	for _, c := range cases {
 		parser := newTestParser(c.code)
@@ -843,6 +851,31 @@ func TestParseReturnStmt(t *testing.T) {
 	validityTest(t, cases)
 }
 
+func TestLabeledContinueTarget(t *testing.T) {
+	parser := newTestParser(`
+outer:
+for var i = 0; i < 10; i += 1 {
+	for var j = 0; j < 10; j += 1 {
+		continue outer
+	}
+	i += 2
+}`)
+
+	block, err := parser.parseUnindentedBlock()
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	outer := block[1].(*ForStmt)
+	inner := outer.Code.Statements[0].(*ForStmt)
+	cont := inner.Code.Statements[0].(*BranchStmt)
+
+	// The continue jumps to the outer loop's repeat statement, not the inner one's.
+	if cont.Branchable != outer {
+		t.Fatalf("Labeled continue refers to %#v instead of the outer loop", cont.Branchable)
+	}
+}
+
 func TestParseVariadicExpand(t *testing.T) {
 	cases := []validityTestCase{
 		{`func a(...int) {}
@@ -1350,3 +1383,60 @@ func TestVarDecl(t *testing.T) {
 		}
 	}
 }
+
+func TestParseStringLiterals(t *testing.T) {
+	cases := []struct {
+		src, value string
+	}{
+		{`"a\tb\\c\"d"`, "a\tb\\c\"d"},
+		{`"\x41\101ą\U0001F600"`, "AAą\U0001F600"},
+		{`"\a\b\f\r\v\n"`, "\a\b\f\r\v\n"},
+		{`"ą"`, "ą"},
+		{"`a\\n\nb`", "a\\n\nb"},
+	}
+
+	for i, c := range cases {
+		parser := newTestParser(c.src)
+		result, err := parser.parsePrimaryExpr()
+		if err != nil {
+			t.Fatalf("Case %d: %s", i, err)
+		}
+		lit, ok := result.(*BasicLit)
+		if !ok || lit.value != c.value || lit.token.Value.(string) != c.src {
+			t.Fatalf("Case %d: Unexpected result: %#v", i, result)
+		}
+	}
+
+	for i, src := range []string{`"\q"`, `"\x4"`, `"\400"`, `"\'"`} {
+		parser := newTestParser(src)
+		_, err := parser.parsePrimaryExpr()
+		if compErr, ok := err.(*CompileError); !ok || compErr.Message != "Invalid string literal" {
+			t.Fatalf("Case %d: Expected an invalid literal error, got %v", i, err)
+		}
+	}
+}
+
+func TestParseNestingDepthLimit(t *testing.T) {
+	cases := []struct {
+		src  string
+		pass bool
+	}{
+		{"-(" + strings.Repeat("-(", 10) + "1" + strings.Repeat(")", 11), true},
+		{"-(" + strings.Repeat("-(", 100) + "1" + strings.Repeat(")", 101), false},
+		{"[]" + strings.Repeat("*", 100) + "int{}", false},
+		{"func() {" + strings.Repeat("if true {", 100) + strings.Repeat("}", 100) + "}", false},
+	}
+
+	for i, c := range cases {
+		parser := newTestParser(c.src)
+		parser.maxDepth = 50
+		_, err := parser.parseExpr()
+		if c.pass && err != nil {
+			t.Fatalf("Case %d: Unexpected error: %s", i, err)
+		}
+		// Errors of enclosing statements wrap the nesting error.
+		if !c.pass && (err == nil || !strings.HasSuffix(err.Error(), "Code too deeply nested")) {
+			t.Fatalf("Case %d: Expected the nesting error, got: %v", i, err)
+		}
+	}
+}
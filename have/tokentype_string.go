@@ -4,9 +4,9 @@ package have
 
 import "fmt"
 
-const _TokenType_name = "TOKEN_EOFTOKEN_INDENTTOKEN_FORTOKEN_WORDTOKEN_ASSIGNTOKEN_EQUALSTOKEN_NEQUALSTOKEN_GTTOKEN_LTTOKEN_EQ_LTTOKEN_EQ_GTTOKEN_NEGATETOKEN_INTTOKEN_FLOATTOKEN_IMAGTOKEN_STRTOKEN_RUNETOKEN_DOTTOKEN_ELLIPSISTOKEN_LPARENTHTOKEN_RPARENTHTOKEN_LBRACKETTOKEN_RBRACKETTOKEN_LBRACETOKEN_RBRACETOKEN_PLUSTOKEN_PLUS_ASSIGNTOKEN_INCREMENTTOKEN_MINUSTOKEN_MINUS_ASSIGNTOKEN_DECREMENTTOKEN_VARTOKEN_IFTOKEN_ELSETOKEN_ELIFTOKEN_SWITCHTOKEN_CASETOKEN_DEFAULTTOKEN_RETURNTOKEN_TRUETOKEN_FALSETOKEN_STRUCTTOKEN_MAPTOKEN_FUNCTOKEN_IMPORTTOKEN_ASTOKEN_TYPETOKEN_INTOKEN_PASSTOKEN_PACKAGETOKEN_BREAKTOKEN_CONTINUETOKEN_FALLTHROUGHTOKEN_GOTOTOKEN_INTERFACETOKEN_NILTOKEN_CHANTOKEN_RANGETOKEN_WHENTOKEN_IMPLEMENTSTOKEN_ISTOKEN_MULTOKEN_DIVTOKEN_MUL_ASSIGNTOKEN_DIV_ASSIGNTOKEN_SHLTOKEN_SHRTOKEN_SENDTOKEN_COMMATOKEN_COLONTOKEN_SEMICOLONTOKEN_AMPTOKEN_PIPETOKEN_PERCENTTOKEN_ANDTOKEN_ORTOKEN_SHARPTOKEN_UNEXP_CHAR"
+const _TokenType_name = "TOKEN_EOFTOKEN_INDENTTOKEN_FORTOKEN_WORDTOKEN_ASSIGNTOKEN_EQUALSTOKEN_NEQUALSTOKEN_GTTOKEN_LTTOKEN_EQ_LTTOKEN_EQ_GTTOKEN_NEGATETOKEN_INTTOKEN_FLOATTOKEN_IMAGTOKEN_STRTOKEN_RUNETOKEN_DOTTOKEN_ELLIPSISTOKEN_LPARENTHTOKEN_RPARENTHTOKEN_LBRACKETTOKEN_RBRACKETTOKEN_LBRACETOKEN_RBRACETOKEN_PLUSTOKEN_PLUS_ASSIGNTOKEN_INCREMENTTOKEN_MINUSTOKEN_MINUS_ASSIGNTOKEN_DECREMENTTOKEN_VARTOKEN_IFTOKEN_ELSETOKEN_ELIFTOKEN_SWITCHTOKEN_CASETOKEN_DEFAULTTOKEN_RETURNTOKEN_TRUETOKEN_FALSETOKEN_STRUCTTOKEN_MAPTOKEN_FUNCTOKEN_IMPORTTOKEN_ASTOKEN_TYPETOKEN_INTOKEN_PASSTOKEN_PACKAGETOKEN_BREAKTOKEN_CONTINUETOKEN_FALLTHROUGHTOKEN_GOTOTOKEN_INTERFACETOKEN_NILTOKEN_CHANTOKEN_RANGETOKEN_WHENTOKEN_IMPLEMENTSTOKEN_ISTOKEN_DEFERTOKEN_GOTOKEN_CONSTTOKEN_MULTOKEN_DIVTOKEN_MUL_ASSIGNTOKEN_DIV_ASSIGNTOKEN_SHLTOKEN_SHRTOKEN_SENDTOKEN_COMMATOKEN_COLONTOKEN_SEMICOLONTOKEN_AMPTOKEN_PIPETOKEN_PERCENTTOKEN_ANDTOKEN_ORTOKEN_SHARPTOKEN_TILDETOKEN_DEFINETOKEN_XORTOKEN_XOR_ASSIGNTOKEN_PERCENT_ASSIGNTOKEN_AMP_ASSIGNTOKEN_PIPE_ASSIGNTOKEN_SHL_ASSIGNTOKEN_SHR_ASSIGNTOKEN_AND_NOTTOKEN_AND_NOT_ASSIGNTOKEN_UNEXP_CHAR"
 
-var _TokenType_index = [...]uint16{0, 9, 21, 30, 40, 52, 64, 77, 85, 93, 104, 115, 127, 136, 147, 157, 166, 176, 185, 199, 213, 227, 241, 255, 267, 279, 289, 306, 321, 332, 350, 365, 374, 382, 392, 402, 414, 424, 437, 449, 459, 470, 482, 491, 501, 513, 521, 531, 539, 549, 562, 573, 587, 604, 614, 629, 638, 648, 659, 669, 685, 693, 702, 711, 727, 743, 752, 761, 771, 782, 793, 808, 817, 827, 840, 849, 857, 868, 884}
+var _TokenType_index = [...]uint16{0, 9, 21, 30, 40, 52, 64, 77, 85, 93, 104, 115, 127, 136, 147, 157, 166, 176, 185, 199, 213, 227, 241, 255, 267, 279, 289, 306, 321, 332, 350, 365, 374, 382, 392, 402, 414, 424, 437, 449, 459, 470, 482, 491, 501, 513, 521, 531, 539, 549, 562, 573, 587, 604, 614, 629, 638, 648, 659, 669, 685, 693, 704, 712, 723, 732, 741, 757, 773, 782, 791, 801, 812, 823, 838, 847, 857, 870, 879, 887, 898, 909, 921, 930, 946, 966, 982, 999, 1015, 1031, 1044, 1064, 1080}
 
 func (i TokenType) String() string {
 	i -= 1
@@ -3,6 +3,8 @@ package have
 
 import (
 	"fmt"
+	"math/big"
+	"sort"
 	"strings"
 )
 
@@ -26,17 +28,403 @@ type TypesContext struct {
 	goNames map[Expr]string
 	// Stores instantiations of generics.
 	instantiations map[InstKey]*Instantiation
+	// Go packages that compiler macros expanded in the currently generated
+	// file need, they're imported by the generated code.
+	goImports map[string]bool
+	// Non-fatal diagnostics, they don't stop the compilation.
+	warnings []*CompileError
+
+	// Opt-in warnings that are reported.
+	enabledWarnings WarningSet
+	// Calls of the builtin recover(), checked after all functions are type checked.
+	recoverCalls []*FuncCallExpr
+	// Declarations of the builtin recover() and panic(), functions that
+	// shadow them are called like any other function.
+	builtinRecover, builtinPanic *FuncDecl
+	// Pointer variables declared without an initializer, and not assigned since.
+	nilVars map[*Variable]bool
+	// Current and maximum depth of type negotiation of nested expressions.
+	depth, maxDepth int
+	// Set while initializers of constants are negotiated. Untyped constants
+	// used there are exact, only the declared constant is checked for overflows.
+	inConstDecl bool
+	// Folded untyped integer constant expressions. Their values don't depend
+	// on types, so each of them is folded once, no matter how deeply nested.
+	foldedInts map[Expr]foldedInt
+	// Type declarations of the package, sorted by name. Used to make
+	// error messages more helpful.
+	typeDecls []*TypeDecl
 }
 
+// Set of opt-in warnings, all of them are disabled by default.
+type WarningSet uint
+
+const (
+	// Using == and != with floating-point operands.
+	WARN_FLOAT_EQUALITY WarningSet = 1 << iota
+	// Calling recover() outside deferred functions.
+	WARN_RECOVER_OUTSIDE_DEFER
+	// Dereferencing pointer variables that are still nil.
+	WARN_NIL_DEREF
+	// Assigning expressions to themselves, e.g. `x = x`.
+	WARN_SELF_ASSIGN
+	// Comparing expressions with themselves, e.g. `x == x`.
+	WARN_SELF_COMPARE
+	// Switch cases that can never be selected, e.g. ones following `case true:`.
+	WARN_DEAD_CASES
+	// Statements that can never be executed and functions with results that
+	// can reach the end of their body without returning.
+	WARN_UNREACHABLE
+)
+
+// Names of the opt-in warnings, as used on the command line.
+var WarningNames = map[string]WarningSet{
+	"float-eq":     WARN_FLOAT_EQUALITY,
+	"recover":      WARN_RECOVER_OUTSIDE_DEFER,
+	"nil-deref":    WARN_NIL_DEREF,
+	"self-assign":  WARN_SELF_ASSIGN,
+	"self-compare": WARN_SELF_COMPARE,
+	"dead-cases":   WARN_DEAD_CASES,
+	"unreachable":  WARN_UNREACHABLE,
+}
+
+func (ws WarningSet) Has(w WarningSet) bool { return ws&w != 0 }
+
+// Parses a comma-separated list of warning names, `all` enables all of them.
+func ParseWarnings(list string) (WarningSet, error) {
+	var result WarningSet
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if name == "all" {
+			for _, w := range WarningNames {
+				result |= w
+			}
+			continue
+		}
+		w, ok := WarningNames[name]
+		if !ok {
+			return 0, fmt.Errorf("Unknown warning: %s", name)
+		}
+		result |= w
+	}
+	return result, nil
+}
+
+// Returns names of the package's types that have a method with the given name.
+func (tc *TypesContext) methodOwners(method string) []string {
+	owners := []string{}
+	for _, decl := range tc.typeDecls {
+		_, ok := decl.Methods[method]
+		if asStruct, isStruct := decl.AliasedType.(*StructType); isStruct && !ok {
+			_, ok = asStruct.Methods[method]
+		}
+		if ok {
+			owners = append(owners, decl.name)
+		}
+	}
+	return owners
+}
+
+// Default limit of how deeply expressions can be nested.
+const DefaultMaxNestingDepth = 10000
+
+// Has to be paired with leave(). Returns an error if expressions are nested
+// too deeply, to fail before the stack overflows.
+func (tc *TypesContext) enter(e Expr) error {
+	tc.depth++
+	if tc.depth > tc.maxDepth {
+		return ExprErrorf(e, "Expression too deeply nested")
+	}
+	return nil
+}
+
+func (tc *TypesContext) leave() { tc.depth-- }
+
 func (tc *TypesContext) SetType(e Expr, typ Type) { tc.types[e] = typ }
 func (tc *TypesContext) GetType(e Expr) Type      { return nonilTyp(tc.types[e]) }
 func (tc *TypesContext) IsTypeSet(e Expr) bool    { _, ok := tc.types[e]; return ok }
 
+// Records a warning. The same expression can be negotiated more than once,
+// so duplicates are dropped.
+func (tc *TypesContext) addWarning(w *CompileError) {
+	for _, prev := range tc.warnings {
+		if prev.Pos == w.Pos && prev.Message == w.Message {
+			return
+		}
+	}
+	tc.warnings = append(tc.warnings, w)
+}
+
+// Warns about recover() calls made outside deferred functions, they always
+// return nil.
+func (tc *TypesContext) checkRecoverCalls() {
+	for _, call := range tc.recoverCalls {
+		if call.caller == nil || !call.caller.Deferred {
+			tc.addWarning(ExprErrorf(call, "recover() has no effect outside a deferred function"))
+		}
+	}
+}
+
+// Control flow facts gathered by checkReachability for a single function.
+type reachability struct {
+	// Loops and switches left by a break, and loops repeated by a continue.
+	broken, continued map[Stmt]bool
+	// Labels that are targets of goto statements.
+	gotoTargets map[*LabelStmt]bool
+}
+
+// Warns about statements that can never be executed, and about functions
+// with results that can reach the end of their body. Bodies that are just
+// `pass` are stubs, they aren't checked.
+func (tc *TypesContext) checkReachability(fd *FuncDecl) {
+	if !tc.enabledWarnings.Has(WARN_UNREACHABLE) || len(fd.compilerMacros) > 0 {
+		return
+	}
+	if stmts := fd.Code.Statements; len(stmts) == 1 {
+		if _, ok := stmts[0].(*PassStmt); ok {
+			return
+		}
+	}
+
+	r := &reachability{broken: map[Stmt]bool{}, continued: map[Stmt]bool{}, gotoTargets: map[*LabelStmt]bool{}}
+	r.findGotoTargets(fd.Code)
+	if tc.blockCompletes(r, fd.Code) && len(fd.typ.Results) > 0 {
+		tc.addWarning(ExprErrorf(fd, "Missing return at the end of the function"))
+	}
+}
+
+func (r *reachability) findGotoTargets(block *CodeBlock) {
+	for _, stmt := range block.Statements {
+		switch stmt := stmt.(type) {
+		case *BranchStmt:
+			if stmt.GotoLabel != nil && stmt.Token.Type == TOKEN_GOTO {
+				r.gotoTargets[stmt.GotoLabel] = true
+			}
+		case *IfStmt:
+			for _, b := range stmt.Branches {
+				r.findGotoTargets(b.Code)
+			}
+		case *SwitchStmt:
+			for _, b := range stmt.Branches {
+				r.findGotoTargets(b.Code)
+			}
+		case *WhenStmt:
+			for _, b := range stmt.Branches {
+				r.findGotoTargets(b.Code)
+			}
+		case *ForStmt:
+			r.findGotoTargets(stmt.Code)
+		case *ForRangeStmt:
+			r.findGotoTargets(stmt.Code)
+		}
+	}
+}
+
+// Tells whether execution can continue past the end of the block, and warns
+// about the first statement of the block that can't be reached.
+func (tc *TypesContext) blockCompletes(r *reachability, block *CodeBlock) bool {
+	reachable, reported := true, false
+	for _, stmt := range block.Statements {
+		if label, ok := stmt.(*LabelStmt); ok && r.gotoTargets[label] {
+			reachable = true
+		}
+		if !reachable && !reported {
+			if _, ok := stmt.(*PassStmt); !ok {
+				tc.addWarning(ExprErrorf(stmt, "Unreachable code"))
+				reported = true
+			}
+		}
+		if !tc.stmtCompletes(r, stmt) {
+			reachable = false
+		}
+	}
+	return reachable
+}
+
+// Tells whether execution can continue after the statement, it's false for
+// terminating statements as defined by the Go spec.
+func (tc *TypesContext) stmtCompletes(r *reachability, stmt Stmt) bool {
+	switch stmt := stmt.(type) {
+	case *ReturnStmt:
+		return false
+	case *BranchStmt:
+		switch stmt.Token.Type {
+		case TOKEN_BREAK:
+			r.broken[stmt.Branchable] = true
+		case TOKEN_CONTINUE:
+			r.continued[stmt.Branchable] = true
+		}
+		return false
+	case *ExprStmt:
+		call, ok := stmt.Expression.(*FuncCallExpr)
+		return !ok || call.fn == nil || call.fn != tc.builtinPanic
+	case *IfStmt:
+		completes := stmt.Branches[len(stmt.Branches)-1].Condition != nil
+		for _, b := range stmt.Branches {
+			if tc.blockCompletes(r, b.Code) {
+				completes = true
+			}
+		}
+		return completes
+	case *SwitchStmt:
+		completes := true
+		for _, b := range stmt.Branches {
+			if b.Values == nil {
+				completes = false
+			}
+		}
+		for _, b := range stmt.Branches {
+			if tc.blockCompletes(r, b.Code) && !endsWithFallthrough(b.Code) {
+				completes = true
+			}
+		}
+		return completes || r.broken[stmt]
+	case *WhenStmt:
+		completes := true
+		for _, b := range stmt.Branches {
+			for _, pred := range b.Predicates {
+				if pred.Kind == WHEN_KIND_DEFAULT {
+					completes = false
+				}
+			}
+		}
+		for _, b := range stmt.Branches {
+			if tc.blockCompletes(r, b.Code) {
+				completes = true
+			}
+		}
+		return completes
+	case *ForStmt:
+		// The post statement runs after the body completes, or after
+		// a continue, including labeled ones from nested loops.
+		if !tc.blockCompletes(r, stmt.Code) && !r.continued[stmt] && stmt.RepeatStmt != nil {
+			tc.addWarning(ExprErrorf(stmt.RepeatStmt, "Unreachable code, the post statement never runs"))
+		}
+		return stmt.Condition != nil || r.broken[stmt]
+	case *ForRangeStmt:
+		tc.blockCompletes(r, stmt.Code)
+		return true
+	}
+	return true
+}
+
+func endsWithFallthrough(block *CodeBlock) bool {
+	if len(block.Statements) == 0 {
+		return false
+	}
+	branch, ok := block.Statements[len(block.Statements)-1].(*BranchStmt)
+	return ok && branch.Token.Type == TOKEN_FALLTHROUGH
+}
+
+// Tracks a pointer variable declared without an initializer, its value
+// is nil until it's assigned to (or its address is taken).
+// It's a lightweight check, it follows the order in which statements are
+// type checked, so it's limited to straight-line code: tracking stops at
+// the first statement that branches (see forgetNilVars).
+func (tc *TypesContext) trackNilVar(v *Variable) {
+	if !tc.enabledWarnings.Has(WARN_NIL_DEREF) || RootType(v.Type).Kind() != KIND_POINTER {
+		return
+	}
+	tc.nilVars[v] = true
+}
+
+func (tc *TypesContext) untrackNilVar(e Expr) {
+	if ident, ok := e.(*Ident); ok {
+		if v, ok := ident.object.(*Variable); ok {
+			delete(tc.nilVars, v)
+		}
+	}
+}
+
+// Stops tracking all variables. Called before statements that branch or
+// can be jumped to, and around function bodies, since past them a variable
+// may or may not have been assigned to.
+func (tc *TypesContext) forgetNilVars() {
+	if len(tc.nilVars) > 0 {
+		tc.nilVars = map[*Variable]bool{}
+	}
+}
+
+func (tc *TypesContext) checkNilDeref(ex *UnaryOp) {
+	ident, ok := ex.Right.(*Ident)
+	if !ok {
+		return
+	}
+	if v, ok := ident.object.(*Variable); ok && tc.nilVars[v] {
+		tc.addWarning(ExprErrorf(ex, "Dereferencing %s, which is nil at this point", ident.name))
+	}
+}
+
+// Warns about assignments like `x = x`, they don't have any effect and are
+// usually typos.
+func (tc *TypesContext) checkSelfAssign(as *AssignStmt) {
+	if !tc.enabledWarnings.Has(WARN_SELF_ASSIGN) || as.Token.Type != TOKEN_ASSIGN || len(as.Lhs) != len(as.Rhs) {
+		return
+	}
+	for i := range as.Lhs {
+		if isSameExpr(as.Lhs[i], as.Rhs[i]) {
+			tc.addWarning(ExprErrorf(as.Lhs[i], "Self-assignment of %s", describeExpr(as.Lhs[i])))
+		}
+	}
+}
+
+// Warns about comparisons like `x == x` or `a > a`, their results are known
+// in advance. Constants are compared on purpose sometimes, and `x != x` is
+// how NaNs are detected, so those are left alone.
+func (tc *TypesContext) checkSelfCompare(ex *BinaryOp, operandType Type) {
+	if !tc.enabledWarnings.Has(WARN_SELF_COMPARE) || isConstExpr(tc, ex.Left) || IsTypeFloatingPoint(RootType(operandType)) {
+		return
+	}
+	if isSameExpr(ex.Left, ex.Right) {
+		tc.addWarning(ExprErrorf(ex, "Comparison of %s with itself using `%s`", describeExpr(ex.Left), ex.op.Value))
+	}
+}
+
+// Tells whether two expressions are structurally the same and evaluating them
+// has no side effects. Only identifiers, selectors, dereferences, indexing and
+// literals are compared, anything else is reported as different.
+func isSameExpr(a, b Expr) bool {
+	switch a := a.(type) {
+	case *Ident:
+		b, ok := b.(*Ident)
+		return ok && a.name == b.name && a.object == b.object && !IsBlank(a)
+	case *DotSelector:
+		b, ok := b.(*DotSelector)
+		return ok && a.Right.name == b.Right.name && isSameExpr(a.Left, b.Left)
+	case *UnaryOp:
+		b, ok := b.(*UnaryOp)
+		return ok && a.op.Type == TOKEN_MUL && b.op.Type == TOKEN_MUL && isSameExpr(a.Right, b.Right)
+	case *ArrayExpr:
+		b, ok := b.(*ArrayExpr)
+		if !ok || len(a.Index) != len(b.Index) || !isSameExpr(a.Left, b.Left) {
+			return false
+		}
+		for i := range a.Index {
+			if !isSameExpr(a.Index[i], b.Index[i]) {
+				return false
+			}
+		}
+		return true
+	case *BasicLit:
+		b, ok := b.(*BasicLit)
+		return ok && a.token.Type == b.token.Type && a.negated == b.negated &&
+			fmt.Sprint(a.token.Value) == fmt.Sprint(b.token.Value)
+	}
+	return false
+}
+
 func NewTypesContext() *TypesContext {
 	return &TypesContext{
 		types:          map[Expr]Type{},
 		goNames:        map[Expr]string{},
 		instantiations: map[InstKey]*Instantiation{},
+		goImports:      map[string]bool{},
+		nilVars:        map[*Variable]bool{},
+		maxDepth:       DefaultMaxNestingDepth,
+		foldedInts:     map[Expr]foldedInt{},
 	}
 }
 
@@ -91,15 +479,22 @@ func RootType(t Type) Type {
 
 // Implements the definition of underlying types from the Go spec.
 func UnderlyingType(t Type) Type {
-	if t.Kind() == KIND_CUSTOM {
+	switch t.Kind() {
+	case KIND_CUSTOM:
 		return t.(*CustomType).Decl.AliasedType
+	case KIND_GENERIC_INST:
+		// Instantiated generic types are named, their underlying type
+		// is the struct with substituted params.
+		if gen, ok := t.(*GenericType); ok && gen.Struct != nil {
+			return gen.Struct
+		}
 	}
 	return t
 }
 
 // Implements the definition of named types from the Go spec.
 func IsNamed(t Type) bool {
-	return t.Kind() == KIND_CUSTOM || t.Kind() == KIND_SIMPLE
+	return t.Kind() == KIND_CUSTOM || t.Kind() == KIND_SIMPLE || t.Kind() == KIND_GENERIC_INST
 }
 
 // Implements the definition of unnamed types from the Go spec.
@@ -113,26 +508,226 @@ func IsInterface(t Type) bool {
 	return RootType(t).Kind() == KIND_INTERFACE
 }
 
+// Implements the definition of type identity from the Go spec. Composite
+// types are compared structurally, so that aliases like byte and uint8 are
+// identical at any depth, e.g. in []byte and []uint8.
 func IsIdentincal(to, what Type) bool {
+	switch to := to.(type) {
+	case *SimpleType:
+		return areAliasedSimpleTypes(to, what)
+	case *ArrayType:
+		what, ok := what.(*ArrayType)
+		return ok && to.Size == what.Size && IsIdentincal(to.Of, what.Of)
+	case *SliceType:
+		what, ok := what.(*SliceType)
+		return ok && IsIdentincal(to.Of, what.Of)
+	case *MapType:
+		what, ok := what.(*MapType)
+		return ok && IsIdentincal(to.By, what.By) && IsIdentincal(to.Of, what.Of)
+	case *PointerType:
+		what, ok := what.(*PointerType)
+		return ok && IsIdentincal(to.To, what.To)
+	case *ChanType:
+		what, ok := what.(*ChanType)
+		return ok && to.Dir == what.Dir && IsIdentincal(to.Of, what.Of)
+	case *TupleType:
+		what, ok := what.(*TupleType)
+		return ok && areIdenticalLists(to.Members, what.Members)
+	case *FuncType:
+		what, ok := what.(*FuncType)
+		return ok && to.Ellipsis == what.Ellipsis &&
+			areIdenticalLists(to.Args, what.Args) && areIdenticalLists(to.Results, what.Results)
+	case *StructType:
+		what, ok := what.(*StructType)
+		if !ok {
+			return false
+		}
+		// Methods don't take part in struct identity.
+		toKeys, whatKeys := to.MemberKeys(), what.MemberKeys()
+		if len(toKeys) != len(whatKeys) {
+			return false
+		}
+		for i, key := range toKeys {
+			if key != whatKeys[i] || to.Embedded[key] != what.Embedded[key] ||
+				!IsIdentincal(to.Members[key], what.Members[key]) {
+				return false
+			}
+		}
+		return true
+	case *IfaceType:
+		what, ok := what.(*IfaceType)
+		if !ok {
+			return false
+		}
+		embedIfaces(to)
+		embedIfaces(what)
+		if len(to.Methods) != len(what.Methods) || len(to.allUnions) != len(what.allUnions) ||
+			to.comparable != what.comparable {
+			return false
+		}
+		for name, method := range to.Methods {
+			other, ok := what.Methods[name]
+			if !ok || !IsIdentincal(method.typ, other.typ) {
+				return false
+			}
+		}
+		for i, union := range to.allUnions {
+			if len(union) != len(what.allUnions[i]) {
+				return false
+			}
+			for j, term := range union {
+				other := what.allUnions[i][j]
+				if term.Tilde != other.Tilde || !IsIdentincal(term.Type, other.Type) {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	// Named types are identical only to themselves.
 	return to.String() == what.String()
 }
 
+// Tells whether both lists have the same length and identical types
+// at each position.
+func areIdenticalLists(a, b []Type) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !IsIdentincal(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Tells whether both types are simple types that only differ by an alias,
+// e.g. rune and int32.
+func areAliasedSimpleTypes(a, b Type) bool {
+	sa, ok := a.(*SimpleType)
+	if !ok {
+		return false
+	}
+	sb, ok := b.(*SimpleType)
+	if !ok {
+		return false
+	}
+	return sa.aliasedID() == sb.aliasedID()
+}
+
+// Tells if nil can be assigned to values of type t.
+func IsNilAssignable(t Type) bool {
+	switch RootType(t).Kind() {
+	case KIND_POINTER, KIND_INTERFACE, KIND_MAP, KIND_SLICE, KIND_CHAN, KIND_FUNC:
+		return true
+	}
+	return false
+}
+
 // Implements the definition of assignability from the Go spec.
 func IsAssignable(to, what Type) bool {
+	if unknown, ok := what.(*UnknownType); ok && unknown.fromNil {
+		return IsNilAssignable(to)
+	}
+
 	if IsInterface(to) {
 		return Implements(to, what)
 	}
 
 	if IsNamed(to) && IsNamed(what) {
-		return to.String() == what.String()
+		return IsIdentincal(to, what)
+	}
+
+	// Bidirectional channels can be assigned to channels of any direction.
+	toChan, ok1 := UnderlyingType(to).(*ChanType)
+	whatChan, ok2 := UnderlyingType(what).(*ChanType)
+	if ok1 && ok2 && whatChan.Dir == CHAN_DIR_BI {
+		return IsIdentincal(toChan.Of, whatChan.Of)
+	}
+
+	return IsIdentincal(UnderlyingType(to), UnderlyingType(what))
+}
+
+// Moves single interface lines of iface's type set to iface.Embedded and
+// merges methods and type sets of the embedded interfaces into iface. It
+// has to wait until type names are bound, so it's called lazily, before
+// the methods or the type set are used.
+func embedIfaces(iface *IfaceType) *IfaceType {
+	if iface.embedsDone {
+		return iface
+	}
+	// Set first, it also stops cycles of embedded interfaces.
+	iface.embedsDone = true
+
+	var typeSet [][]*TypeSetTerm
+	for _, union := range iface.TypeSet {
+		if len(union) == 1 && !union[0].Tilde {
+			if ct, ok := union[0].Type.(*CustomType); !ok || ct.Decl != nil {
+				if embedded, ok := RootType(union[0].Type).(*IfaceType); ok {
+					embedIfaces(embedded)
+					iface.Embedded = append(iface.Embedded, union[0].Type)
+					for name, method := range embedded.Methods {
+						if _, ok := iface.Methods[name]; !ok {
+							iface.Methods[name] = method
+						}
+					}
+					iface.comparable = iface.comparable || embedded.comparable
+					iface.allUnions = append(iface.allUnions, embedded.allUnions...)
+					continue
+				}
+			}
+		}
+		typeSet = append(typeSet, union)
+		iface.allUnions = append(iface.allUnions, union)
 	}
+	iface.TypeSet = typeSet
+	return iface
+}
+
+// Tells whether typeArg can be used as a generic argument for a param
+// constrained by the constraint interface.
+func SatisfiesConstraint(typeArg, constraint Type) bool {
+	iface, ok := RootType(constraint).(*IfaceType)
+	if !ok {
+		return false
+	}
+	embedIfaces(iface)
 
-	return UnderlyingType(to).String() == UnderlyingType(what).String()
+	if iface.comparable && !isRootTypeComparable(RootType(typeArg)) {
+		return false
+	}
+
+	for _, union := range iface.allUnions {
+		found := false
+		for _, term := range union {
+			if term.Tilde {
+				found = RootType(typeArg).String() == RootType(term.Type).String()
+			} else {
+				found = IsIdentincal(term.Type, typeArg)
+			}
+			if found {
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return Implements(iface, typeArg)
 }
 
-// Tells whether value's methods are a subset of iface's methods.
+// Tells whether iface's methods are a subset of value's methods.
 func Implements(iface, value Type) bool {
-	i := RootType(iface).(*IfaceType)
+	return ImplementsErr(iface, value) == nil
+}
+
+// Like Implements, but the error explains which method is missing
+// or has a different signature.
+func ImplementsErr(iface, value Type) error {
+	i := embedIfaces(RootType(iface).(*IfaceType))
+	valueType := value
 
 	ptr := false
 	if value.Kind() == KIND_POINTER {
@@ -146,11 +741,16 @@ func Implements(iface, value Type) bool {
 	case KIND_CUSTOM:
 		valueMethods = value.(*CustomType).Decl.Methods
 	case KIND_INTERFACE:
-		valueMethods = value.(*IfaceType).Methods
+		if ptr {
+			// Pointers to interfaces have no methods.
+			valueMethods = map[string]*FuncDecl{}
+		} else {
+			valueMethods = embedIfaces(value.(*IfaceType)).Methods
+		}
 	case KIND_GENERIC_INST:
 		gen, ok := value.(*GenericType)
 		if !ok {
-			return false
+			return fmt.Errorf("`%s` doesn't implement `%s`", valueType, iface)
 		}
 		valueMethods = gen.Struct.Methods
 	default:
@@ -159,76 +759,544 @@ func Implements(iface, value Type) bool {
 		valueMethods = map[string]*FuncDecl{}
 	}
 
-	for _, imet := range i.Methods {
-		found := false
-		for _, met := range valueMethods {
-			if met.name != imet.name {
-				continue
+	// Sorted, so that the same method is reported every time.
+	names := make([]string, 0, len(i.Methods))
+	for name := range i.Methods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		imet := i.Methods[name]
+		met, ok := valueMethods[imet.name]
+		// Methods promoted through an embedded pointer are in the method
+		// set of the value as well.
+		viaPtr := false
+		if !ok && value.Kind() != KIND_INTERFACE {
+			if st, isStruct := RootType(value).(*StructType); isStruct {
+				if promoted := findPromoted(st, imet.name); len(promoted) == 1 && promoted[0].method != nil {
+					met, viaPtr, ok = promoted[0].method, promoted[0].viaPtr, true
+				}
+			}
+		}
+		if !ok {
+			return fmt.Errorf("`%s` doesn't implement `%s` (missing method %s)", valueType, iface, imet.name)
+		}
+
+		// Method set of a pointer includes methods with value receivers,
+		// but not the other way around.
+		if met.PtrReceiver && !ptr && !viaPtr {
+			return fmt.Errorf("`%s` doesn't implement `%s` (method %s has a pointer receiver)", valueType, iface, imet.name)
+		}
+
+		if met.typ.String() != imet.typ.String() {
+			return fmt.Errorf("`%s` doesn't implement `%s` (wrong type for method %s: have %s, want %s)",
+				valueType, iface, imet.name, met.typ, imet.typ)
+		}
+	}
+
+	return nil
+}
+
+func IsPackage(e TypedExpr) bool {
+	ident, isIdent := e.(*Ident)
+	return isIdent && ident.object != nil && ident.object.ObjectType() == OBJECT_PACKAGE
+}
+
+func IsBlank(e TypedExpr) bool {
+	ident, isIdent := e.(*Ident)
+	return isIdent && ident.name == Blank
+}
+
+// Given an expression, returns a function referred by it or nil otherwise.
+func funcUnderneath(expr Expr) *FuncDecl {
+	if oe, ok := expr.(ObjectExpr); ok {
+		vr, ok := oe.ReferedObject().(*Variable)
+		if !ok {
+			return nil
+		}
+
+		fd, ok := vr.init.(*FuncDecl)
+		if !ok {
+			return nil
+		}
+
+		return fd
+	}
+
+	return nil
+}
+
+func (vs *VarStmt) NegotiateTypes(tc *TypesContext) error {
+	for v := range vs.Reused {
+		delete(tc.nilVars, v)
+	}
+	for _, v := range vs.Vars {
+		tc.inConstDecl = vs.IsConst
+		err := v.NegotiateTypes(tc)
+		tc.inConstDecl = false
+		if err != nil {
+			return err
+		}
+		if vs.IsConst {
+			if err := checkConstDecl(tc, v); err != nil {
+				return err
+			}
+		}
+		v.eachPair(func(vr *Variable, init Expr) {
+			if err == nil {
+				err = checkMapKeys(vs, vr.Type)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Makes sure that every constant is initialized with a constant expression
+// of a basic type, and that integer values fit in their types.
+func checkConstDecl(tc *TypesContext, vd *VarDecl) error {
+	var err error
+	vd.eachPair(func(v *Variable, init Expr) {
+		if err != nil {
+			return
+		}
+		if !isConstExpr(tc, init) {
+			err = ExprErrorf(init, "Const initializer %s is not a constant", describeExpr(init))
+			return
+		}
+		root := RootType(v.Type)
+		if root.Kind() != KIND_SIMPLE {
+			err = ExprErrorf(init, "Invalid constant type %s", v.Type)
+			return
+		}
+		value, foldErr := constIntValue(tc, init)
+		if foldErr != nil {
+			err = foldErr
+		} else if isUntypedConst(init) && v.untyped {
+			// Untyped constants aren't limited by their default type,
+			// they're checked once they're used as values of some type.
+		} else if value != nil && IsTypeIntKind(root) && !intConstFits(value, root.(*SimpleType)) {
+			err = ExprErrorf(init, "Constant %s overflows %s", value, v.Type)
+		}
+	})
+	return err
+}
+
+// Tells whether an expression can be evaluated at compile time: literals,
+// other constants, conversions of constants and operators applied to them.
+func isConstExpr(tc *TypesContext, e Expr) bool {
+	switch e := e.(type) {
+	case *BasicLit:
+		return true
+	case *Ident:
+		v, ok := e.object.(*Variable)
+		return ok && v.isConst
+	case *UnaryOp:
+		switch e.op.Type {
+		case TOKEN_PLUS, TOKEN_MINUS:
+			return isConstExpr(tc, e.Right)
+		}
+	case *BinaryOp:
+		return isConstExpr(tc, e.Left) && isConstExpr(tc, e.Right)
+	case *FuncCallExpr:
+		castType, err := ExprToTypeName(tc, e.Left)
+		return err == nil && castType != nil && RootType(castType).Kind() == KIND_SIMPLE &&
+			len(e.Args) == 1 && isConstExpr(tc, e.Args[0])
+	}
+	return false
+}
+
+// Tells whether a constant expression is untyped, i.e. it consists only
+// of literals and constants declared without a type. Like in Go, shifts
+// take the type of their left operand.
+func isUntypedConst(e Expr) bool {
+	switch e := e.(type) {
+	case *BasicLit:
+		return true
+	case *Ident:
+		v, ok := e.object.(*Variable)
+		return ok && v.isConst && v.untyped && isUntypedConst(v.init)
+	case *UnaryOp:
+		return isUntypedConst(e.Right)
+	case *BinaryOp:
+		if e.op.Type == TOKEN_SHL || e.op.Type == TOKEN_SHR {
+			return isUntypedConst(e.Left)
+		}
+		return isUntypedConst(e.Left) && isUntypedConst(e.Right)
+	}
+	return false
+}
+
+// Folds an integer constant expression. The value is nil if the expression
+// isn't an integer constant or can't be evaluated, e.g. because of a division
+// by zero. Intermediate results that overflow their types are reported,
+// untyped ones are exact.
+func constIntValue(tc *TypesContext, e Expr) (*big.Int, error) {
+	value, _, err := foldInt(tc, e)
+	return value, err
+}
+
+type foldedInt struct {
+	value *big.Int
+	err   error
+}
+
+// Like constIntValue, but also tells whether e is untyped, see isUntypedConst.
+// Untyped results are cached in tc, values returned are never modified.
+func foldInt(tc *TypesContext, e Expr) (value *big.Int, untyped bool, err error) {
+	if folded, ok := tc.foldedInts[e]; ok {
+		return folded.value, true, folded.err
+	}
+
+	switch e := e.(type) {
+	case *BasicLit:
+		if e.token.Type != TOKEN_INT {
+			return nil, false, nil
+		}
+		var ok bool
+		if value, ok = new(big.Int).SetString(e.token.Value.(string), 0); !ok {
+			return nil, false, nil
+		}
+		// The minus of negated literals is folded by their UnaryOp.
+		untyped = true
+	case *Ident:
+		v, isVar := e.object.(*Variable)
+		if !isVar || !v.isConst {
+			return nil, false, nil
+		}
+		value, untyped, err = foldInt(tc, v.init)
+		untyped = untyped && v.untyped
+	case *UnaryOp:
+		right, rightUntyped, err := foldInt(tc, e.Right)
+		if right == nil || err != nil {
+			return nil, false, err
+		}
+		switch e.op.Type {
+		case TOKEN_PLUS:
+			value = right
+		case TOKEN_MINUS:
+			value = new(big.Int).Neg(right)
+		default:
+			return nil, false, nil
+		}
+		untyped = rightUntyped
+	case *BinaryOp:
+		left, leftUntyped, leftErr := foldInt(tc, e.Left)
+		if left == nil || leftErr != nil {
+			return nil, false, leftErr
+		}
+		right, rightUntyped, rightErr := foldInt(tc, e.Right)
+		if right == nil || rightErr != nil {
+			return nil, false, rightErr
+		}
+		// Like in Go, shifts take the type of their left operand.
+		untyped = leftUntyped && (rightUntyped || e.op.IsShiftOp())
+
+		var overflow bool
+		if value, overflow = foldIntOp(e.op.Type, left, right); overflow {
+			if src, ok := exprSource(e); ok {
+				err = ExprErrorf(e, "Constant overflow, `%s` exceeds %d bits", src, maxConstBits)
+			} else {
+				err = ExprErrorf(e, "Constant overflow, the value exceeds %d bits", maxConstBits)
 			}
+			value = nil
+		} else if value == nil {
+			return nil, false, nil
+		}
+	case *FuncCallExpr:
+		castType, err := ExprToTypeName(tc, e.Left)
+		if err != nil || castType == nil || !IsTypeIntKind(RootType(castType)) || len(e.Args) != 1 {
+			return nil, false, nil
+		}
+		if value, _, err = foldInt(tc, e.Args[0]); value == nil || err != nil {
+			return nil, false, err
+		}
+	default:
+		return nil, false, nil
+	}
+
+	if untyped {
+		tc.foldedInts[e] = foldedInt{value, err}
+		return value, true, err
+	}
+	if err == nil && value != nil {
+		err = checkFoldedInt(tc, e, value)
+	}
+	return value, false, err
+}
+
+// Folds a numeric constant expression exactly, including floats, e.g. 2.0 folds
+// to an integral value. Like in Go, operations on two integers are integer
+// operations, isInt tells whether that's the case for the whole expression.
+// Ok is false if e isn't a numeric constant or can't be evaluated.
+func constNumValue(tc *TypesContext, e Expr) (value *big.Rat, isInt, ok bool) {
+	switch e := e.(type) {
+	case *BasicLit:
+		switch e.token.Type {
+		case TOKEN_INT:
+			i, ok := new(big.Int).SetString(e.token.Value.(string), 0)
+			if !ok {
+				return nil, false, false
+			}
+			value, isInt = new(big.Rat).SetInt(i), true
+		case TOKEN_FLOAT:
+			lit := strings.Replace(e.token.Value.(string), "_", "", -1)
+			if value, ok = new(big.Rat).SetString(lit); !ok {
+				return nil, false, false
+			}
+		default:
+			return nil, false, false
+		}
+		// The minus of negated literals is folded by their UnaryOp.
+		return value, isInt, true
+	case *Ident:
+		if v, isVar := e.object.(*Variable); isVar && v.isConst {
+			return constNumValue(tc, v.init)
+		}
+	case *UnaryOp:
+		value, isInt, ok = constNumValue(tc, e.Right)
+		if !ok {
+			return nil, false, false
+		}
+		switch e.op.Type {
+		case TOKEN_PLUS:
+			return value, isInt, true
+		case TOKEN_MINUS:
+			return value.Neg(value), isInt, true
+		}
+	case *BinaryOp:
+		left, leftInt, okLeft := constNumValue(tc, e.Left)
+		right, rightInt, okRight := constNumValue(tc, e.Right)
+		if !okLeft || !okRight {
+			return nil, false, false
+		}
+		if leftInt && rightInt {
+			result, overflow := foldIntOp(e.op.Type, left.Num(), right.Num())
+			if result == nil || overflow {
+				return nil, false, false
+			}
+			return new(big.Rat).SetInt(result), true, true
+		}
+		value = new(big.Rat)
+		switch e.op.Type {
+		case TOKEN_PLUS:
+			return value.Add(left, right), false, true
+		case TOKEN_MINUS:
+			return value.Sub(left, right), false, true
+		case TOKEN_MUL:
+			return value.Mul(left, right), false, true
+		case TOKEN_DIV:
+			if right.Sign() != 0 {
+				return value.Quo(left, right), false, true
+			}
+		}
+	case *FuncCallExpr:
+		castType, err := ExprToTypeName(tc, e.Left)
+		if err != nil || castType == nil || len(e.Args) != 1 || !IsTypeNumeric(RootType(castType)) {
+			return nil, false, false
+		}
+		value, _, ok = constNumValue(tc, e.Args[0])
+		if !ok {
+			return nil, false, false
+		}
+		if IsTypeIntKind(RootType(castType)) {
+			return value, value.IsInt(), value.IsInt()
+		}
+		return value, false, true
+	}
+	return nil, false, false
+}
 
-			if met.PtrReceiver != ptr {
-				continue
-			}
+// Formats a folded constant for error messages, e.g. 1.5 rather than 3/2.
+func describeConst(value *big.Rat) string {
+	if value.IsInt() {
+		return value.RatString()
+	}
+	return new(big.Float).SetRat(value).Text('g', -1)
+}
 
-			if met.typ.String() != imet.typ.String() {
-				continue
+// Folds a boolean constant expression, ok is false if e isn't one. Comparisons
+// of integer constants are folded too.
+func constBoolValue(tc *TypesContext, e Expr) (value, ok bool) {
+	switch e := e.(type) {
+	case *BasicLit:
+		switch e.token.Type {
+		case TOKEN_TRUE:
+			return true, true
+		case TOKEN_FALSE:
+			return false, true
+		}
+	case *Ident:
+		if v, isVar := e.object.(*Variable); isVar && v.isConst {
+			return constBoolValue(tc, v.init)
+		}
+	case *BinaryOp:
+		switch e.op.Type {
+		case TOKEN_AND, TOKEN_OR:
+			left, okLeft := constBoolValue(tc, e.Left)
+			right, okRight := constBoolValue(tc, e.Right)
+			if !okLeft || !okRight {
+				return false, false
 			}
-
-			found = true
-			break
+			if e.op.Type == TOKEN_AND {
+				return left && right, true
+			}
+			return left || right, true
 		}
-
-		if !found {
-			return false
+		if !e.op.IsCompOp() {
+			return false, false
+		}
+		left, errLeft := constIntValue(tc, e.Left)
+		right, errRight := constIntValue(tc, e.Right)
+		if left == nil || right == nil || errLeft != nil || errRight != nil {
+			return false, false
+		}
+		cmp := left.Cmp(right)
+		switch e.op.Type {
+		case TOKEN_EQUALS:
+			return cmp == 0, true
+		case TOKEN_NEQUALS:
+			return cmp != 0, true
+		case TOKEN_LT:
+			return cmp < 0, true
+		case TOKEN_EQ_LT:
+			return cmp <= 0, true
+		case TOKEN_GT:
+			return cmp > 0, true
+		case TOKEN_EQ_GT:
+			return cmp >= 0, true
 		}
 	}
+	return false, false
+}
 
-	return true
+// Reports intermediate results of constant folding that don't fit their types,
+// even if the final value would fit, e.g. in `x * 2 - 100` with x of type int8.
+func checkFoldedInt(tc *TypesContext, e Expr, value *big.Int) error {
+	typ, err := e.(TypedExpr).Type(tc)
+	if err == nil && typ.Known() && IsTypeIntKind(RootType(typ)) &&
+		!intConstFits(value, RootType(typ).(*SimpleType)) {
+		return ExprErrorf(e, "Constant %s overflows %s", value, typ)
+	}
+	return nil
 }
 
-func IsPackage(e TypedExpr) bool {
-	ident, isIdent := e.(*Ident)
-	return isIdent && ident.object.ObjectType() == OBJECT_PACKAGE
+// Like in Go, constants are exact but their size is limited. Larger values
+// are reported as overflows.
+const maxConstBits = 512
+
+// Applies a binary operator to two integer constants, the result is nil
+// if it can't be computed. Overflow is set if the result exceeds maxConstBits.
+func foldIntOp(op TokenType, left, right *big.Int) (result *big.Int, overflow bool) {
+	result = new(big.Int)
+	switch op {
+	case TOKEN_PLUS:
+		result.Add(left, right)
+	case TOKEN_MINUS:
+		result.Sub(left, right)
+	case TOKEN_MUL:
+		result.Mul(left, right)
+	case TOKEN_DIV, TOKEN_PERCENT:
+		if right.Sign() == 0 {
+			return nil, false
+		}
+		if op == TOKEN_DIV {
+			return result.Quo(left, right), false
+		}
+		return result.Rem(left, right), false
+	case TOKEN_AMP:
+		return result.And(left, right), false
+	case TOKEN_PIPE:
+		return result.Or(left, right), false
+	case TOKEN_SHL, TOKEN_SHR:
+		if right.Sign() < 0 {
+			return nil, false
+		}
+		if op == TOKEN_SHR {
+			if !right.IsUint64() || right.Uint64() > maxConstBits {
+				// All bits are shifted out.
+				return result.Rsh(left, maxConstBits+1), false
+			}
+			return result.Rsh(left, uint(right.Uint64())), false
+		}
+		if left.Sign() == 0 {
+			return result, false
+		}
+		if !right.IsUint64() || right.Uint64() > maxConstBits {
+			return nil, true
+		}
+		result.Lsh(left, uint(right.Uint64()))
+	default:
+		return nil, false
+	}
+	return result, result.BitLen() > maxConstBits
 }
 
-func IsBlank(e TypedExpr) bool {
-	ident, isIdent := e.(*Ident)
-	return isIdent && ident.name == Blank
+func (td *ImportStmt) NegotiateTypes(tc *TypesContext) error { return nil }
+
+func (td *TypeDecl) NegotiateTypes(tc *TypesContext) error {
+	return checkMapKeys(td, td.AliasedType)
 }
 
-// Given an expression, returns a function referred by it or nil otherwise.
-func funcUnderneath(expr Expr) *FuncDecl {
-	if oe, ok := expr.(ObjectExpr); ok {
-		vr, ok := oe.ReferedObject().(*Variable)
-		if !ok {
-			return nil
+// Reports the first map type within t whose key type isn't comparable.
+// Named types aren't looked into, they are checked where they're declared.
+func checkMapKeys(at Expr, t Type) error {
+	switch t := t.(type) {
+	case *MapType:
+		if t.By.Known() && !isRootTypeComparable(t.By) {
+			return ExprErrorf(at, "Invalid map key type %s, %s", t.By, notComparableReason(t.By))
 		}
-
-		fd, ok := vr.init.(*FuncDecl)
-		if !ok {
-			return nil
+		return firstErr(checkMapKeys(at, t.By), checkMapKeys(at, t.Of))
+	case *SliceType:
+		return checkMapKeys(at, t.Of)
+	case *ArrayType:
+		return checkMapKeys(at, t.Of)
+	case *PointerType:
+		return checkMapKeys(at, t.To)
+	case *ChanType:
+		return checkMapKeys(at, t.Of)
+	case *FuncType:
+		for _, arg := range append(append([]Type{}, t.Args...), t.Results...) {
+			if err := checkMapKeys(at, arg); err != nil {
+				return err
+			}
+		}
+	case *StructType:
+		for _, key := range t.Keys {
+			if member, ok := t.Members[key]; ok {
+				if err := checkMapKeys(at, member); err != nil {
+					return err
+				}
+			}
 		}
-
-		return fd
 	}
-
 	return nil
 }
 
-func (vs *VarStmt) NegotiateTypes(tc *TypesContext) error {
-	for _, v := range vs.Vars {
-		err := v.NegotiateTypes(tc)
-		if err != nil {
-			return err
+// Explains why a type isn't comparable, for error messages.
+func notComparableReason(t Type) string {
+	switch root := RootType(t).(type) {
+	case *SliceType:
+		return "slices are only comparable with nil"
+	case *MapType:
+		return "maps are only comparable with nil"
+	case *FuncType:
+		return "functions are only comparable with nil"
+	case *ArrayType:
+		return fmt.Sprintf("elements of type %s aren't comparable", root.Of)
+	case *StructType:
+		for _, key := range root.Keys {
+			if member, ok := root.Members[key]; ok && !isRootTypeComparable(member) {
+				return fmt.Sprintf("field %s of type %s isn't comparable", key, member)
+			}
 		}
 	}
-	return nil
+	return "it isn't comparable"
 }
 
-func (td *ImportStmt) NegotiateTypes(tc *TypesContext) error { return nil }
-
-func (td *TypeDecl) NegotiateTypes(tc *TypesContext) error { return nil }
-
 func (bs *BranchStmt) NegotiateTypes(tc *TypesContext) error { return nil }
 
 func (ls *LabelStmt) NegotiateTypes(tc *TypesContext) error { return nil }
@@ -272,8 +1340,33 @@ func (ws *WhenStmt) NegotiateTypes(tc *TypesContext) error {
 }
 
 func (rs *ReturnStmt) NegotiateTypes(tc *TypesContext) error {
-	if rs.Func.Results.countVars() != len(rs.Values) {
-		return ExprErrorf(rs, "Different number of return values")
+	if want := rs.Func.Results.countVars(); want != len(rs.Values) {
+		results := &TupleType{Members: typesFromVars(rs.Func.Results)}
+		if len(rs.Values) == 1 && want > 1 {
+			// `return f()`, with f returning multiple values.
+			if call, ok := rs.Values[0].(*FuncCallExpr); ok {
+				typ, err := call.Type(tc)
+				if err != nil {
+					return err
+				}
+				if typ.Kind() == KIND_TUPLE {
+					return call.ApplyType(tc, results)
+				}
+			}
+		}
+		if len(rs.Values) == 0 {
+			if rs.Func.hasNamedResults() {
+				// Bare return, current values of the named results are returned.
+				return nil
+			}
+			return ExprErrorf(rs, "Missing return values: want %d %s, bare return needs named results",
+				want, results)
+		}
+		problem := "Too many"
+		if len(rs.Values) < want {
+			problem = "Too few"
+		}
+		return ExprErrorf(rs, "%s return values: got %d, want %d %s", problem, len(rs.Values), want, results)
 	}
 
 	i, err := 0, error(nil)
@@ -289,16 +1382,12 @@ func (rs *ReturnStmt) NegotiateTypes(tc *TypesContext) error {
 }
 
 func (ls *SendStmt) NegotiateTypes(tc *TypesContext) error {
-	ltyp, rtyp := Type(&UnknownType{}), Type(&UnknownType{})
+	ltyp := Type(&UnknownType{})
 
 	if err := NegotiateExprType(tc, &ltyp, ls.Lhs.(TypedExpr)); err != nil {
 		return err
 	}
 
-	if err := NegotiateExprType(tc, &rtyp, ls.Rhs.(TypedExpr)); err != nil {
-		return err
-	}
-
 	lroot := RootType(ltyp)
 	if lroot.Kind() != KIND_CHAN {
 		return ExprErrorf(ls.Lhs, "Not a chan used for sending")
@@ -308,16 +1397,54 @@ func (ls *SendStmt) NegotiateTypes(tc *TypesContext) error {
 	if channel.Dir == CHAN_DIR_RECEIVE {
 		return ExprErrorf(ls.Lhs, "Channel is receive-only")
 	}
-	if !IsAssignable(channel.Of, rtyp) {
+
+	// The channel's base type is known at this point, so untyped constants
+	// (e.g. `5` sent to a `chan float64`) can adopt it.
+	rtyp := channel.Of
+	if err := NegotiateExprType(tc, &rtyp, ls.Rhs.(TypedExpr)); err != nil {
+		return err
+	}
+
+	valueTyp, err := ls.Rhs.(TypedExpr).Type(tc)
+	if err != nil {
+		return err
+	}
+	if !IsAssignable(channel.Of, valueTyp) {
 		return ExprErrorf(ls.Rhs, "Send value has to be assignable to channel's base type")
 	}
 
 	return nil
 }
 
+func (ds *DeferStmt) NegotiateTypes(tc *TypesContext) error {
+	if err := (&ExprStmt{ds.stmt, ds.Call}).NegotiateTypes(tc); err != nil {
+		return err
+	}
+
+	// Functions deferred by name, e.g. `defer cleanup()`.
+	if fd := ds.Call.fn; fd != nil {
+		fd.Deferred = true
+	}
+	return nil
+}
+
+func (gs *GoStmt) NegotiateTypes(tc *TypesContext) error {
+	return (&ExprStmt{gs.stmt, gs.Call}).NegotiateTypes(tc)
+}
+
 func (ss *StructStmt) NegotiateTypes(tc *TypesContext) error {
+	if err := checkMapKeys(ss, ss.Struct); err != nil {
+		return err
+	}
+	for _, key := range ss.Struct.Keys {
+		if m, ok := ss.Struct.Methods[key]; ok {
+			if err := checkMapKeys(m, m.typ); err != nil {
+				return err
+			}
+		}
+	}
 	for _, m := range ss.Struct.Methods {
-		if err := m.Code.CheckTypes(tc); err != nil {
+		if err := m.checkBody(tc); err != nil {
 			return err
 		}
 	}
@@ -330,12 +1457,20 @@ func (is *IfaceStmt) NegotiateTypes(tc *TypesContext) error {
 
 // This will overwrite the type pointer by varType.
 func NegotiateExprType(tc *TypesContext, varType *Type, value TypedExpr) error {
+	defer tc.leave()
+	if err := tc.enter(value); err != nil {
+		return err
+	}
+
 	*varType = nonilTyp(*varType)
 
 	valueTyp, err := value.Type(tc)
 	if err != nil {
 		return err
 	}
+	if valueTyp.Kind() == KIND_TUPLE {
+		return ExprErrorf(value, "Multiple-value %s in single-value context", describeExpr(value))
+	}
 	typ := firstKnown(*varType, valueTyp)
 	if typ == nil {
 		// Try guessing. Literals like "1", or "{1, 2}" can be used
@@ -345,7 +1480,8 @@ func NegotiateExprType(tc *TypesContext, varType *Type, value TypedExpr) error {
 		// it would be "int" and "[]int").
 		ok, guessedType := value.GuessType(tc)
 		if !ok || !guessedType.Known() {
-			return ExprErrorf(value, "Too little information to infer types")
+			return ExprErrorf(value, "Too little information to infer the type of %s (declared: %s, value: %s)",
+				describeExpr(value), describeType(*varType), describeType(valueTyp))
 		}
 
 		typ = guessedType
@@ -377,6 +1513,11 @@ func NegotiateExprType(tc *TypesContext, varType *Type, value TypedExpr) error {
 		return value.ApplyType(tc, typ)
 	} else {
 		if !IsAssignable(typ, valueTyp) {
+			if IsInterface(typ) {
+				if err := ImplementsErr(typ, valueTyp); err != nil {
+					return ExprErrorf(value, "Types %s and %s are not assignable, %s", typ, valueTyp, err)
+				}
+			}
 			return ExprErrorf(value, "Types %s and %s are not assignable", typ, valueTyp)
 		}
 		// Run value.ApplyType with value's own type - seems unnecessary,
@@ -386,7 +1527,20 @@ func NegotiateExprType(tc *TypesContext, varType *Type, value TypedExpr) error {
 }
 
 func CheckCondition(tc *TypesContext, expr TypedExpr) error {
+	if recv, ok := expr.(*UnaryOp); ok && recv.op.Type == TOKEN_SEND {
+		// The received value is used as the condition, so the channel must carry bools.
+		if chanTyp, err := recv.Right.(TypedExpr).Type(tc); err == nil {
+			if ch, ok := RootType(chanTyp).(*ChanType); ok && !IsTypeBool(RootType(ch.Of)) {
+				return ExprErrorf(recv.Right, "Non-bool condition, value received from the channel is %s", ch.Of)
+			}
+		}
+	}
+
 	var boolTyp Type = &SimpleType{SIMPLE_TYPE_BOOL}
+	if typ, err := expr.Type(tc); err == nil && typ.Known() && IsTypeBool(RootType(typ)) {
+		// Conditions can be of named bool types as well.
+		boolTyp = typ
+	}
 
 	err := NegotiateExprType(tc, &boolTyp, expr)
 	if err != nil {
@@ -542,9 +1696,57 @@ func (ss *SwitchStmt) NegotiateTypes(tc *TypesContext) error {
 		}
 	}
 
+	if !typeSwitch {
+		tc.checkDeadCases(ss)
+	}
 	return nil
 }
 
+// Warns about cases that can never be selected, because their values are
+// constants that never match the switch expression, or because an earlier
+// case always matches.
+func (tc *TypesContext) checkDeadCases(ss *SwitchStmt) {
+	if !tc.enabledWarnings.Has(WARN_DEAD_CASES) {
+		return
+	}
+
+	// Freeform switches compare their cases with `true`.
+	var subject *big.Int
+	if ss.Value != nil {
+		if es, ok := ss.Value.(*ExprStmt); ok {
+			subject, _ = constIntValue(tc, es.Expression)
+		}
+		if subject == nil {
+			return
+		}
+	}
+
+	alwaysMatched := false
+	for _, b := range ss.Branches {
+		for _, val := range b.Values {
+			if alwaysMatched {
+				tc.addWarning(ExprErrorf(val, "Unreachable case, an earlier case always matches"))
+				continue
+			}
+
+			var matches, known bool
+			if subject != nil {
+				caseValue, _ := constIntValue(tc, val)
+				matches, known = caseValue != nil && caseValue.Cmp(subject) == 0, caseValue != nil
+			} else {
+				matches, known = constBoolValue(tc, val)
+			}
+
+			switch {
+			case known && matches:
+				alwaysMatched = true
+			case known && !matches:
+				tc.addWarning(ExprErrorf(val, "Unreachable case, %s never matches", describeExpr(val)))
+			}
+		}
+	}
+}
+
 func (p *PassStmt) NegotiateTypes(tc *TypesContext) error {
 	return nil
 }
@@ -682,14 +1884,17 @@ func (fs *ForStmt) NegotiateTypes(tc *TypesContext) error {
 func NegotiateTupleUnpackAssign(tc *TypesContext, onlyFuncCalls bool, lhsTypes []*Type, rhs TypedExpr) error {
 	var tuple *TupleType
 
-	switch rhs.(type) {
+	switch call := rhs.(type) {
 	case *FuncCallExpr:
 		rhsType, err := rhs.Type(tc)
 		if err != nil {
 			return err
 		}
+		if call.IsNullResult(tc) {
+			return ExprErrorf(rhs, "Too few values on the right side (%s returns no values)", describeExpr(rhs))
+		}
 		if rhsType.Kind() != KIND_TUPLE {
-			return ExprErrorf(rhs, "Too few values on the right side (function call returns only 1 result)")
+			return ExprErrorf(rhs, "Too few values on the right side (%s returns only 1 value)", describeExpr(rhs))
 		}
 		tuple = rhsType.(*TupleType)
 	default:
@@ -724,10 +1929,16 @@ func NegotiateTupleUnpackAssign(tc *TypesContext, onlyFuncCalls bool, lhsTypes [
 		}
 	}
 
+	if len(lhsTypes) != len(tuple.Members) {
+		return ExprErrorf(rhs, "Assignment mismatch: %d variables but %s returns %d values",
+			len(lhsTypes), describeExpr(rhs), len(tuple.Members))
+	}
+
 	for i, t := range lhsTypes {
 		typ := firstKnown(*t, tuple.Members[i])
 		if typ == nil {
-			return ExprErrorf(rhs, "Too little information to infer types")
+			return ExprErrorf(rhs, "Too little information to infer the type of value #%d of %s (declared: %s, value: %s)",
+				i+1, describeExpr(rhs), describeType(*t), describeType(tuple.Members[i]))
 		}
 
 		if !tuple.Members[i].Known() {
@@ -744,6 +1955,19 @@ func NegotiateTupleUnpackAssign(tc *TypesContext, onlyFuncCalls bool, lhsTypes [
 }
 
 func (as *AssignStmt) NegotiateTypes(tc *TypesContext) error {
+	for _, v := range as.Lhs {
+		tc.untrackNilVar(v)
+	}
+	tc.checkSelfAssign(as)
+
+	for _, v := range as.Lhs {
+		if ident, ok := v.(*Ident); ok {
+			if obj, ok := ident.object.(*Variable); ok && obj.isConst {
+				return ExprErrorf(v, "Cannot assign to %s, it's a constant", ident.name)
+			}
+		}
+	}
+
 	if len(as.Lhs) != len(as.Rhs) {
 		if len(as.Rhs) == 1 {
 			// We might be dealing with tuple unpacking
@@ -823,6 +2047,7 @@ func (vd *VarDecl) NegotiateTypes(tc *TypesContext) error {
 		if err == nil {
 			if init == nil {
 				init = NewBlankExpr()
+				defer tc.trackNilVar(v)
 			}
 			err = NegotiateExprType(tc, &v.Type, init.(TypedExpr))
 		}
@@ -830,6 +2055,29 @@ func (vd *VarDecl) NegotiateTypes(tc *TypesContext) error {
 	return err
 }
 
+func (ids *IncDecStmt) NegotiateTypes(tc *TypesContext) error {
+	if ident, ok := ids.X.(*Ident); ok {
+		if obj, ok := ident.object.(*Variable); ok && obj.isConst {
+			return ExprErrorf(ids.X, "Cannot assign to %s, it's a constant", ident.name)
+		}
+	}
+
+	typ := Type(&UnknownType{})
+	if err := NegotiateExprType(tc, &typ, ids.X.(TypedExpr)); err != nil {
+		return err
+	}
+
+	if !IsTypeNumeric(RootType(typ)) {
+		return ExprErrorf(ids.X, "Invalid operation: %s on %s (non-numeric type %s)",
+			ids.Token.Value, describeExpr(ids.X), typ)
+	}
+
+	if !IsAddressable(tc, ids.X) && !isMapIndex(tc, ids.X) {
+		return ExprErrorf(ids.X, "Cannot assign to %s", describeExpr(ids.X))
+	}
+	return nil
+}
+
 func (es *ExprStmt) NegotiateTypes(tc *TypesContext) error {
 	te := es.Expression.(TypedExpr)
 	typ, err := te.Type(tc)
@@ -869,24 +2117,82 @@ func IsConvertable(tc *TypesContext, what TypedExpr, to Type) bool {
 		return true
 	}
 
-	if UnderlyingType(to).String() == UnderlyingType(wt).String() {
+	// This also covers named pointer types, e.g. `type NodePtr *Node` is
+	// convertible to and from `*Node`.
+	if IsIdentincal(UnderlyingType(to), UnderlyingType(wt)) {
 		return true
 	}
 
+	// Only unnamed pointer types can be converted based on their base types.
 	if to.Kind() == KIND_POINTER && wt.Kind() == KIND_POINTER &&
-		UnderlyingType(wt.(*PointerType).To).String() == UnderlyingType(to.(*PointerType).To).String() {
+		IsIdentincal(UnderlyingType(wt.(*PointerType).To), UnderlyingType(to.(*PointerType).To)) {
+		return true
+	}
+
+	// A slice can be converted to an array or to a pointer to an array,
+	// as long as element types are identical. Only underlying types count,
+	// so named pointer types are fine as well.
+	if slice, ok := RootType(wt).(*SliceType); ok {
+		target := RootType(to)
+		if ptr, ok := target.(*PointerType); ok {
+			target = RootType(ptr.To)
+		}
+		if arr, ok := target.(*ArrayType); ok {
+			return IsIdentincal(arr.Of, slice.Of)
+		}
+	}
+
+	// Arrays of different lengths are different types, even with identical elements.
+	if arrWt, ok := RootType(wt).(*ArrayType); ok {
+		if arrTo, ok := RootType(to).(*ArrayType); ok {
+			return arrWt.Size == arrTo.Size && IsIdentincal(arrWt.Of, arrTo.Of)
+		}
+	}
+
+	// Arrays can't be converted to pointers, their address has to be taken instead.
+	if to.Kind() == KIND_POINTER && RootType(wt).Kind() == KIND_ARRAY {
+		return false
+	}
+
+	// Integer and floating point types can be converted between each other,
+	// and so can complex types.
+	rootWt, rootTo := RootType(wt), RootType(to)
+	isIntOrFloat := func(t Type) bool {
+		return IsTypeIntKind(t) || IsTypeFloatKind(t) || IsTypeSimple(t, SIMPLE_TYPE_RUNE)
+	}
+	if isIntOrFloat(rootWt) && isIntOrFloat(rootTo) {
+		return true
+	}
+	if IsTypeComplexType(rootWt) && IsTypeComplexType(rootTo) {
 		return true
 	}
 
-	// TODO cases:
-	// x's type and T are both integer or floating point types.
-	// x's type and T are both complex types.
-	// x is an integer or a slice of bytes or runes and T is a string type.
-	// x is a string and T is a slice of bytes or runes.
+	// Integers and slices of bytes or runes can be converted to strings,
+	// and strings can be converted back to such slices.
+	if IsTypeString(rootTo) && (IsTypeIntKind(rootWt) || IsTypeSimple(rootWt, SIMPLE_TYPE_RUNE) || isBytesOrRunes(rootWt)) {
+		return true
+	}
+	if IsTypeString(rootWt) && isBytesOrRunes(rootTo) {
+		return true
+	}
 
 	return false
 }
 
+// Tells if t is a slice whose elements are bytes or runes, possibly named.
+func isBytesOrRunes(t Type) bool {
+	slice, ok := t.(*SliceType)
+	if !ok {
+		return false
+	}
+	elem, ok := RootType(slice.Of).(*SimpleType)
+	if !ok {
+		return false
+	}
+	id := elem.aliasedID()
+	return id == SIMPLE_TYPE_UINT8 || id == SIMPLE_TYPE_INT32
+}
+
 // Sometimes it is not immediately obvious if a piece of code is
 // an actual expression or a name of a type.
 // That can happen during during type conversions, for example in
@@ -927,6 +2233,42 @@ func ExprToTypeName(tc *TypesContext, e Expr) (t Type, err error) {
 				return &CustomType{Decl: decl, Name: decl.name, Package: importStmt}, nil
 			}
 		}
+	case *ArrayExpr:
+		// Instantiation of a generic struct, e.g. `Stack[int]`.
+		generic, err := ExprToGeneric(e.Left)
+		if err != nil {
+			return nil, err
+		}
+		gs, ok := generic.(*GenericStruct)
+		if !ok {
+			return nil, nil
+		}
+
+		var params []Type
+		for i, arg := range e.Index {
+			typ, err := ExprToTypeName(tc, arg)
+			if err != nil {
+				return nil, err
+			}
+			if typ == nil {
+				return nil, ExprErrorf(arg, "Generic parameter #%d is not a type", i)
+			}
+			params = append(params, typ)
+		}
+
+		obj, _, errs := gs.Instantiate(tc, params...)
+		if len(errs) > 0 {
+			// TODO: return all errors
+			return nil, errs[0]
+		}
+
+		result := &GenericType{Name: gs.Name(), Params: params, Generic: gs,
+			Struct: obj.(*TypeDecl).AliasedType.(*StructType)}
+		if sel, ok := e.Left.(*DotSelector); ok {
+			result.Package = sel.Left.(*Ident).object.(*ImportStmt)
+		}
+		tc.goNames[e] = result.Struct.Name
+		return result, nil
 	}
 	// No error found, but the expression is not a type.
 	return nil, nil
@@ -975,6 +2317,10 @@ func (ex *FuncCallExpr) inferGeneric(tc *TypesContext) (*Variable, string, error
 		argTypes = append(argTypes, v.Type)
 	})
 
+	if fnType := genericFn.Func.typ; len(ex.Args) != len(fnType.Args) && !fnType.Ellipsis {
+		return nil, "", ex.arityError(fnType, len(ex.Args), nil)
+	}
+
 	gnParams, err := deduceGenericParams(tc, params, argTypes, ex.Args, genericFn.Func.Ellipsis && !ex.Ellipsis)
 	if err != nil {
 		return nil, "", ExprErrorf(ex, err.Error())
@@ -993,6 +2339,19 @@ func (ex *FuncCallExpr) inferGeneric(tc *TypesContext) (*Variable, string, error
 	return obj.(*Variable), goName, nil
 }
 
+// Explains why the expression can be neither a call nor a conversion.
+// Conversions and calls look the same, so for plain identifiers both
+// possibilities are ruled out in the message.
+func (ex *FuncCallExpr) notCallableError(tc *TypesContext, calleeType Type) error {
+	if ident, ok := ex.Left.(*Ident); ok {
+		if typ, err := ident.Type(tc); err == nil {
+			calleeType = typ
+		}
+		return ExprErrorf(ex, "%s is neither a type nor a function, it's a value of type %s", ident.name, calleeType)
+	}
+	return ExprErrorf(ex, "Only functions can be called, not %s", calleeType)
+}
+
 func (ex *FuncCallExpr) getCalleeType(tc *TypesContext) (Type, error) {
 	generic, goName, err := ex.inferGeneric(tc)
 	if err != nil {
@@ -1010,18 +2369,54 @@ func (ex *FuncCallExpr) getCalleeType(tc *TypesContext) (Type, error) {
 			return nil, err
 		}
 		ex.fn = funcUnderneath(ex.Left)
+
+		// Bodies of function literals are checked when their type is applied,
+		// which doesn't happen for literals that are called immediately.
+		if fd, ok := ex.Left.(*FuncDecl); ok && !tc.IsTypeSet(fd) {
+			tc.SetType(fd, calleeType)
+			if err := fd.checkBody(tc); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if tc.enabledWarnings.Has(WARN_RECOVER_OUTSIDE_DEFER) && ex.fn != nil && ex.fn == tc.builtinRecover {
+		ex.addRecoverCall(tc)
 	}
 	calleeType = UnderlyingType(calleeType)
 	return calleeType, nil
 }
 
+// Remembers a call of the builtin recover() for checkRecoverCalls.
+func (ex *FuncCallExpr) addRecoverCall(tc *TypesContext) {
+	for _, call := range tc.recoverCalls {
+		if call == ex {
+			return
+		}
+	}
+	tc.recoverCalls = append(tc.recoverCalls, ex)
+}
+
 // Type check function arguments.
 func (ex *FuncCallExpr) checkArgs(tc *TypesContext, asFunc *FuncType) error {
+	if ex.Ellipsis && !asFunc.Ellipsis {
+		return ExprErrorf(ex, "Can't use `...` in %s, the function isn't variadic", describeExpr(ex))
+	}
+
 	if len(asFunc.Args) != len(ex.Args) || ex.Ellipsis {
 		if asFunc.Ellipsis {
 			// This function has a variadic argument.
 			if len(asFunc.Args) > 1 && len(asFunc.Args)-1 > len(ex.Args) {
-				return ExprErrorf(ex, "Too few arguments, at least %d required", len(asFunc.Args)-1)
+				return ex.arityError(asFunc, len(ex.Args), nil)
+			}
+
+			if ex.Ellipsis && len(ex.Args) != len(asFunc.Args) {
+				if len(ex.Args) < len(asFunc.Args) {
+					// With a spread slice, all of the fixed parameters still need arguments.
+					return ex.arityError(asFunc, len(ex.Args), nil)
+				}
+				// The spread slice has to be the only variadic argument, e.g. f(1, 2, xs...) is invalid.
+				return ExprErrorf(ex.Args[len(asFunc.Args)-1],
+					"Can't mix individual variadic arguments with a spread slice in %s", describeExpr(ex))
 			}
 
 			lastArgIdx := len(asFunc.Args) - 1
@@ -1048,6 +2443,21 @@ func (ex *FuncCallExpr) checkArgs(tc *TypesContext, asFunc *FuncType) error {
 			}
 			return nil
 		} else if len(ex.Args) == 1 {
+			// Results of another call might be spread over the arguments.
+			got, from := 1, Expr(nil)
+			if inner, ok := ex.Args[0].(*FuncCallExpr); ok {
+				innerType, err := inner.Type(tc)
+				if err != nil {
+					return err
+				}
+				if tuple, ok := innerType.(*TupleType); ok {
+					got, from = len(tuple.Members), inner
+				}
+			}
+			if got != len(asFunc.Args) {
+				return ex.arityError(asFunc, got, from)
+			}
+
 			types := make([]*Type, len(asFunc.Args))
 			for i, v := range asFunc.Args {
 				v := v
@@ -1056,7 +2466,7 @@ func (ex *FuncCallExpr) checkArgs(tc *TypesContext, asFunc *FuncType) error {
 
 			return NegotiateTupleUnpackAssign(tc, true, types, ex.Args[0].(TypedExpr))
 		}
-		return ExprErrorf(ex, "Wrong number of arguments: %d instead of %d", len(ex.Args), len(asFunc.Args))
+		return ex.arityError(asFunc, len(ex.Args), nil)
 	} else {
 		for i, arg := range asFunc.Args {
 			if err := NegotiateExprType(tc, &arg, ex.Args[i].(TypedExpr)); err != nil {
@@ -1067,7 +2477,49 @@ func (ex *FuncCallExpr) checkArgs(tc *TypesContext, asFunc *FuncType) error {
 	return nil
 }
 
+// Reports a call with a wrong number of arguments, the wording is the same
+// for all kinds of calls. From is the call whose results are spread over
+// the arguments, if there is one.
+func (ex *FuncCallExpr) arityError(fnType *FuncType, got int, from Expr) error {
+	want := len(fnType.Args)
+	wantStr := fmt.Sprint(want)
+	// A spread slice is the argument of the variadic parameter, so
+	// the number of arguments is fixed then.
+	if fnType.Ellipsis && !ex.Ellipsis {
+		want--
+		wantStr = fmt.Sprintf("at least %d", want)
+	}
+
+	problem := "Too many"
+	if got < want {
+		problem = "Too few"
+	}
+
+	gotStr := fmt.Sprint(got)
+	if from != nil {
+		gotStr += " from " + describeExpr(from)
+	}
+
+	return ExprErrorf(ex, "%s arguments in %s: got %s, want %s (%s)",
+		problem, describeExpr(ex), gotStr, wantStr, fnType)
+}
+
+// Like arityError, but for type conversions, which take exactly one argument.
+func (ex *FuncCallExpr) conversionArityError(castType Type) error {
+	problem := "Too many"
+	if len(ex.Args) < 1 {
+		problem = "Too few"
+	}
+	return ExprErrorf(ex, "%s arguments in conversion to %s: got %d, want 1",
+		problem, castType, len(ex.Args))
+}
+
 func (ex *FuncCallExpr) Type(tc *TypesContext) (Type, error) {
+	defer tc.leave()
+	if err := tc.enter(ex); err != nil {
+		return nil, err
+	}
+
 	if tc.IsTypeSet(ex) {
 		return tc.GetType(ex), nil
 	}
@@ -1079,7 +2531,7 @@ func (ex *FuncCallExpr) Type(tc *TypesContext) (Type, error) {
 
 	if castType != nil {
 		if len(ex.Args) != 1 {
-			return nil, ExprErrorf(ex, "Type casts take only 1 argument")
+			return nil, ex.conversionArityError(castType)
 		}
 		if IsConvertable(tc, ex.Args[0].(TypedExpr), castType) {
 			return castType, nil
@@ -1090,6 +2542,9 @@ func (ex *FuncCallExpr) Type(tc *TypesContext) (Type, error) {
 			return nil, err
 		}
 		if calleeType.Kind() != KIND_FUNC {
+			if calleeType.Known() {
+				return nil, ex.notCallableError(tc, calleeType)
+			}
 			return &UnknownType{}, nil
 		}
 		asFunc := calleeType.(*FuncType)
@@ -1114,6 +2569,11 @@ func (ex *FuncCallExpr) Type(tc *TypesContext) (Type, error) {
 }
 
 func (ex *FuncCallExpr) ApplyType(tc *TypesContext, typ Type) error {
+	defer tc.leave()
+	if err := tc.enter(ex); err != nil {
+		return err
+	}
+
 	castType, err := ExprToTypeName(tc, ex.Left)
 	if err != nil {
 		return err
@@ -1121,13 +2581,37 @@ func (ex *FuncCallExpr) ApplyType(tc *TypesContext, typ Type) error {
 
 	if castType != nil {
 		if len(ex.Args) != 1 {
-			return ExprErrorf(ex, "Type conversion takes exactly one argument")
+			return ex.conversionArityError(castType)
 		}
 		// Just try applying, ignore error - even if it fails if might still be convertible.
-		ex.Args[0].(TypedExpr).ApplyType(tc, castType)
+		arg := ex.Args[0].(TypedExpr)
+		if err := arg.ApplyType(tc, castType); err != nil {
+			rootCast := RootType(castType)
+			// Untyped integer constants can't be converted to integer types
+			// that don't represent them, e.g. `int8(1000)`.
+			if value, _ := constIntValue(tc, arg); value != nil && IsTypeIntKind(rootCast) && isUntypedConst(arg) {
+				return err
+			}
+			// Untyped constants that can't become a string or a slice of bytes
+			// or runes directly might still be convertible from their default
+			// type, e.g. in `[]rune("foo")`. Numeric targets don't get a second
+			// chance, `int(1.5)` isn't valid.
+			if argType, err := arg.Type(tc); err == nil && !argType.Known() &&
+				(IsTypeString(rootCast) || isBytesOrRunes(rootCast)) {
+				if ok, guessed := arg.GuessType(tc); ok {
+					arg.ApplyType(tc, guessed)
+				}
+			}
+		}
 		if !IsConvertable(tc, ex.Args[0].(TypedExpr), castType) {
 			typ, _ := ex.Args[0].(TypedExpr).Type(tc)
-			return ExprErrorf(ex, "Impossible conversion from %s to %s", typ, castType)
+			if !typ.Known() {
+				// Untyped constants, e.g. in `int(true)`, report their default type.
+				if ok, guessed := ex.Args[0].(TypedExpr).GuessType(tc); ok {
+					typ = guessed
+				}
+			}
+			return ExprErrorf(ex, "Impossible conversion from %s to %s%s", typ, castType, conversionHint(ex.Args[0], typ, castType))
 		}
 		if !IsAssignable(typ, castType) {
 			return ExprErrorf(ex, "Cannot assign `%s` to `%s`", castType, typ)
@@ -1140,17 +2624,31 @@ func (ex *FuncCallExpr) ApplyType(tc *TypesContext, typ Type) error {
 			return err
 		}
 		if calleeType.Kind() != KIND_FUNC {
-			return ExprErrorf(ex, "Only functions can be called, not %s", calleeType)
+			return ex.notCallableError(tc, calleeType)
 		}
 		asFunc := calleeType.(*FuncType)
 
 		if typ.Kind() == KIND_TUPLE {
 			tuple := typ.(*TupleType)
-			ptrs := make([]*Type, 0, len(tuple.Members))
-			for i := range tuple.Members {
-				ptrs = append(ptrs, &tuple.Members[i])
+			if len(asFunc.Results) != len(tuple.Members) {
+				return ExprErrorf(ex, "Value count mismatch: %s returns %d values, want %d %s",
+					describeExpr(ex), len(asFunc.Results), len(tuple.Members), tuple)
+			}
+			for i, member := range tuple.Members {
+				if member.Kind() == KIND_UNKNOWN {
+					tuple.Members[i] = asFunc.Results[i]
+				} else if !IsAssignable(member, asFunc.Results[i]) {
+					return ExprErrorf(ex, "Can't assign `%s` to `%s` (value #%d of %s)",
+						asFunc.Results[i], member, i+1, describeExpr(ex))
+				}
 			}
-			return NegotiateTupleUnpackAssign(tc, false, ptrs, ex)
+
+			if err := ex.checkArgs(tc, asFunc); err != nil {
+				return err
+			}
+
+			tc.SetType(ex, tuple)
+			return nil
 		}
 
 		switch {
@@ -1175,6 +2673,11 @@ func (ex *FuncCallExpr) ApplyType(tc *TypesContext, typ Type) error {
 }
 
 func (ex *FuncCallExpr) GuessType(tc *TypesContext) (ok bool, typ Type) {
+	defer tc.leave()
+	if tc.enter(ex) != nil {
+		return false, nil
+	}
+
 	castType, err := ExprToTypeName(tc, ex.Left)
 	if err != nil {
 		return false, nil
@@ -1210,14 +2713,32 @@ func (ex *FuncDecl) ApplyType(tc *TypesContext, typ Type) error {
 	if !IsAssignable(typ, ex.typ) {
 		return ExprErrorf(ex, "Cannot assign `%s` to `%s`", ex.typ, typ)
 	}
-	return ex.Code.CheckTypes(tc)
+	return ex.checkBody(tc)
+}
+
+// Type checks statements of the function's body.
+func (ex *FuncDecl) checkBody(tc *TypesContext) error {
+	tc.forgetNilVars()
+	defer tc.forgetNilVars()
+
+	if err := ex.Code.CheckTypes(tc); err != nil {
+		return err
+	}
+	tc.checkReachability(ex)
+	return nil
 }
+
 func (ex *FuncDecl) GuessType(tc *TypesContext) (ok bool, typ Type) {
 	return false, nil
 }
 
 func (cb *CodeBlock) CheckTypes(tc *TypesContext) error {
 	for _, stmt := range cb.Statements {
+		switch stmt.(type) {
+		case *IfStmt, *SwitchStmt, *WhenStmt, *ForStmt, *ForRangeStmt, *LabelStmt:
+			tc.forgetNilVars()
+		}
+
 		typedStmt := stmt.(ExprToProcess)
 		if err := typedStmt.NegotiateTypes(tc); err != nil {
 			return err
@@ -1243,6 +2764,11 @@ func (ex *TypeExpr) ApplyType(tc *TypesContext, typ Type) error {
 func (ex *TypeExpr) GuessType(tc *TypesContext) (ok bool, typ Type) { return false, nil }
 
 func (ex *TypeAssertion) Type(tc *TypesContext) (Type, error) {
+	defer tc.leave()
+	if err := tc.enter(ex); err != nil {
+		return nil, err
+	}
+
 	if tc.IsTypeSet(ex) {
 		return tc.GetType(ex), nil
 	}
@@ -1281,6 +2807,10 @@ func (ex *TypeAssertion) ApplyType(tc *TypesContext, typ Type) error {
 		return err
 	}
 
+	if teType.Known() && !IsInterface(teType) {
+		return nonInterfaceAssertError(te, teType)
+	}
+
 	if !teType.Known() {
 		err := te.ApplyType(tc, ex.Right.typ)
 		if err != nil {
@@ -1300,6 +2830,12 @@ func (ex *TypeAssertion) ApplyType(tc *TypesContext, typ Type) error {
 }
 func (ex *TypeAssertion) GuessType(tc *TypesContext) (ok bool, typ Type) { return false, nil }
 
+// Only values of interface types can be used on the left of type assertions.
+func nonInterfaceAssertError(src TypedExpr, srcType Type) error {
+	return ExprErrorf(src, "Invalid type assertion: %s (non-interface type %s) on left",
+		describeExpr(src), srcType)
+}
+
 // Check if type assertion is sane.
 func CheckTypeAssert(tc *TypesContext, src TypedExpr, target Type) error {
 	srcType, err := src.Type(tc)
@@ -1308,13 +2844,12 @@ func CheckTypeAssert(tc *TypesContext, src TypedExpr, target Type) error {
 	}
 
 	if !IsInterface(srcType) {
-		return ExprErrorf(src, "Invalid type assertion, non-interface `%s` used as a source", srcType)
+		return nonInterfaceAssertError(src, srcType)
 	}
 
 	if !IsInterface(target) {
-		if !Implements(srcType, target) {
-			return ExprErrorf(src, "Impossible type assertion: `%s` doesn't implement `%s`",
-				target, srcType)
+		if err := ImplementsErr(srcType, target); err != nil {
+			return ExprErrorf(src, "Impossible type assertion: %s", err)
 		}
 	}
 	return nil
@@ -1334,7 +2869,53 @@ func (ex *DotSelector) typeFromPkg() (Type, error) {
 	return typ, err
 }
 
+// Implements the definition of addressability from the Go spec.
+func IsAddressable(tc *TypesContext, e Expr) bool {
+	switch e := e.(type) {
+	case *Ident:
+		return e.object != nil && e.object.ObjectType() == OBJECT_VAR
+	case *UnaryOp:
+		return e.op.Type == TOKEN_MUL
+	case *ArrayExpr:
+		leftType, err := e.Left.(TypedExpr).Type(tc)
+		if err != nil {
+			return false
+		}
+		switch RootType(leftType).Kind() {
+		case KIND_SLICE, KIND_POINTER:
+			return true
+		case KIND_ARRAY:
+			return IsAddressable(tc, e.Left)
+		}
+	case *DotSelector:
+		if IsPackage(e.Left.(TypedExpr)) {
+			return true
+		}
+		leftType, err := e.Left.(TypedExpr).Type(tc)
+		if err != nil {
+			return false
+		}
+		return leftType.Kind() == KIND_POINTER || IsAddressable(tc, e.Left)
+	}
+	return false
+}
+
+// Map index expressions aren't addressable, but can still be assigned to.
+func isMapIndex(tc *TypesContext, e Expr) bool {
+	ae, ok := e.(*ArrayExpr)
+	if !ok {
+		return false
+	}
+	leftType, err := ae.Left.(TypedExpr).Type(tc)
+	return err == nil && RootType(leftType).Kind() == KIND_MAP
+}
+
 func (ex *DotSelector) Type(tc *TypesContext) (Type, error) {
+	defer tc.leave()
+	if err := tc.enter(ex); err != nil {
+		return nil, err
+	}
+
 	if IsPackage(ex.Left.(TypedExpr)) {
 		return ex.typeFromPkg()
 	}
@@ -1344,11 +2925,13 @@ func (ex *DotSelector) Type(tc *TypesContext) (Type, error) {
 		return nil, err
 	}
 
-	if leftType.Kind() == KIND_POINTER {
+	leftIsPtr := leftType.Kind() == KIND_POINTER
+	if leftIsPtr {
 		asPtr := leftType.(*PointerType)
 		leftType = asPtr.To
 	}
 
+	valueType := leftType
 	leftType = RootType(leftType)
 
 	switch leftType.Kind() {
@@ -1358,9 +2941,34 @@ func (ex *DotSelector) Type(tc *TypesContext) (Type, error) {
 		if !ok {
 			method, ok := asStruct.Methods[ex.Right.name]
 			if !ok {
+				promoted := findPromoted(asStruct, ex.Right.name)
+				switch len(promoted) {
+				case 0:
+				case 1:
+					return ex.promotedType(tc, promoted[0], leftIsPtr, valueType)
+				default:
+					paths := make([]string, len(promoted))
+					for i, p := range promoted {
+						paths[i] = p.path
+					}
+					return nil, ExprErrorf(ex.Right, "Ambiguous selector %s: %s",
+						ex.Right.name, strings.Join(paths, " and "))
+				}
+
+				if owners := tc.methodOwners(ex.Right.name); len(owners) > 0 {
+					return nil, ExprErrorf(ex.Right, "No such member: %s (%s is a method of %s, not %s)",
+						ex.Right.name, ex.Right.name, strings.Join(owners, ", "), valueType)
+				}
 				return nil, ExprErrorf(ex.Right, "No such member: %s", ex.Right.name)
 			}
 
+			// The address of the left side is implicitly taken to call
+			// a pointer method, so it has to be addressable.
+			if method.PtrReceiver && !leftIsPtr && !IsAddressable(tc, ex.Left) {
+				return nil, ExprErrorf(ex.Left, "Cannot call pointer method %s on a non-addressable value of type %s",
+					ex.Right.name, valueType)
+			}
+
 			member, err = method.Type(tc)
 			if err != nil {
 				return nil, err
@@ -1368,7 +2976,7 @@ func (ex *DotSelector) Type(tc *TypesContext) (Type, error) {
 		}
 		return member, nil
 	case KIND_INTERFACE:
-		asIface := leftType.(*IfaceType)
+		asIface := embedIfaces(leftType.(*IfaceType))
 		method, ok := asIface.Methods[ex.Right.name]
 		if !ok {
 			return nil, ExprErrorf(ex.Right, "No such member: %s", ex.Right.name)
@@ -1385,6 +2993,97 @@ func (ex *DotSelector) Type(tc *TypesContext) (Type, error) {
 	}
 }
 
+// A member or method promoted from an embedded field.
+type promotedMember struct {
+	// Selector path through the embedded fields, e.g. `Base.x`.
+	path   string
+	member Type
+	method *FuncDecl
+	// True when one of the embedded fields on the path is a pointer.
+	viaPtr bool
+}
+
+// Finds members and methods called `name` promoted from embedded fields
+// of `st`. Like in Go, only the shallowest depth at which the name occurs
+// counts, more than one result means the selector is ambiguous.
+func findPromoted(st *StructType, name string) []promotedMember {
+	type embedding struct {
+		st     *StructType
+		path   string
+		viaPtr bool
+	}
+
+	level := []embedding{{st: st}}
+	// Structs searched at previous depths, guards against cycles through
+	// embedded pointers.
+	seen := map[*StructType]bool{st: true}
+
+	for len(level) > 0 {
+		var found []promotedMember
+		var next []embedding
+
+		for _, e := range level {
+			for _, key := range e.st.Keys {
+				if !e.st.Embedded[key] {
+					continue
+				}
+
+				typ, viaPtr := e.st.Members[key], e.viaPtr
+				if typ.Kind() == KIND_POINTER {
+					typ, viaPtr = typ.(*PointerType).To, true
+				}
+
+				path := key
+				if e.path != "" {
+					path = e.path + "." + key
+				}
+
+				if iface, ok := RootType(typ).(*IfaceType); ok {
+					// Methods of embedded interfaces are promoted too.
+					embedIfaces(iface)
+					if method, ok := iface.Methods[name]; ok {
+						found = append(found, promotedMember{path: path + "." + name, method: method, viaPtr: viaPtr})
+					}
+					continue
+				}
+				embedded, ok := RootType(typ).(*StructType)
+				if !ok {
+					continue
+				}
+
+				if member, ok := embedded.Members[name]; ok {
+					found = append(found, promotedMember{path: path + "." + name, member: member, viaPtr: viaPtr})
+				} else if method, ok := embedded.Methods[name]; ok {
+					found = append(found, promotedMember{path: path + "." + name, method: method, viaPtr: viaPtr})
+				} else if !seen[embedded] {
+					next = append(next, embedding{st: embedded, path: path, viaPtr: viaPtr})
+				}
+			}
+		}
+
+		if len(found) > 0 {
+			return found
+		}
+		for _, e := range next {
+			seen[e.st] = true
+		}
+		level = next
+	}
+	return nil
+}
+
+func (ex *DotSelector) promotedType(tc *TypesContext, p promotedMember, leftIsPtr bool, valueType Type) (Type, error) {
+	if p.method == nil {
+		return p.member, nil
+	}
+
+	if p.method.PtrReceiver && !p.viaPtr && !leftIsPtr && !IsAddressable(tc, ex.Left) {
+		return nil, ExprErrorf(ex.Left, "Cannot call pointer method %s on a non-addressable value of type %s",
+			ex.Right.name, valueType)
+	}
+	return p.method.Type(tc)
+}
+
 func (ex *DotSelector) applyTypeForPkgMemb(typ Type) error {
 	importStmt := ex.Left.(*Ident).object.(*ImportStmt)
 
@@ -1400,8 +3099,7 @@ func (ex *DotSelector) applyTypeForPkgMemb(typ Type) error {
 }
 
 func (ex *DotSelector) ApplyType(tc *TypesContext, typ Type) error {
-	ident, isIdent := ex.Left.(*Ident)
-	if isIdent && ident.object.ObjectType() == OBJECT_PACKAGE {
+	if IsPackage(ex.Left.(TypedExpr)) {
 		return ex.applyTypeForPkgMemb(typ)
 	}
 
@@ -1416,6 +3114,11 @@ func (ex *DotSelector) ApplyType(tc *TypesContext, typ Type) error {
 }
 
 func (ex *DotSelector) GuessType(tc *TypesContext) (ok bool, typ Type) {
+	defer tc.leave()
+	if tc.enter(ex) != nil {
+		return false, nil
+	}
+
 	return false, nil
 }
 
@@ -1450,6 +3153,11 @@ func (ex *ArrayExpr) baseTypesOfContainer(containerType Type) (ok bool, key, val
 }
 
 func (ex *ArrayExpr) Type(tc *TypesContext) (Type, error) {
+	defer tc.leave()
+	if err := tc.enter(ex); err != nil {
+		return nil, err
+	}
+
 	if tc.IsTypeSet(ex) {
 		// Some type was negotiated already.
 		return tc.GetType(ex), nil
@@ -1640,6 +3348,11 @@ func (ex *ArrayExpr) ApplyType(tc *TypesContext, typ Type) error {
 }
 
 func (ex *ArrayExpr) GuessType(tc *TypesContext) (ok bool, typ Type) {
+	defer tc.leave()
+	if tc.enter(ex) != nil {
+		return false, nil
+	}
+
 	ok, typ = ex.Left.(TypedExpr).GuessType(tc)
 	if !ok {
 		return false, &UnknownType{}
@@ -1662,6 +3375,11 @@ func (ex *ArrayExpr) ReferedObject() Object {
 }
 
 func (ex *CompoundLit) Type(tc *TypesContext) (Type, error) {
+	defer tc.leave()
+	if err := tc.enter(ex); err != nil {
+		return nil, err
+	}
+
 	if ex.typ != nil && ex.typ.Known() {
 		return ex.typ, nil
 	}
@@ -1678,10 +3396,27 @@ func (ex *CompoundLit) Type(tc *TypesContext) (Type, error) {
 		return nil, ExprErrorf(ex, "Non-type on the left of complex literal")
 	}
 
+	if arr, ok := typ.(*ArrayType); ok && arr.Size == ArraySizeInferred {
+		if ex.kind == COMPOUND_MAPLIKE {
+			return nil, ExprErrorf(ex, "Keyed elements can't be used to infer the length of %s", typ)
+		}
+		typ = &ArrayType{Of: arr.Of, Size: len(ex.elems)}
+	}
+
 	ex.typ = typ
 	return typ, nil
 }
 
+// Applies the type of a compound literal's element to the element's value.
+// Elements of interface types can hold values of any type implementing
+// the interface, e.g. []interface{}{1, "two", true}.
+func applyElemType(tc *TypesContext, el Expr, typ Type) error {
+	if IsInterface(typ) {
+		return NegotiateExprType(tc, &typ, el.(TypedExpr))
+	}
+	return el.(TypedExpr).ApplyType(tc, typ)
+}
+
 func (ex *CompoundLit) ApplyType(tc *TypesContext, typ Type) error {
 	var apply = false
 
@@ -1696,7 +3431,7 @@ func (ex *CompoundLit) ApplyType(tc *TypesContext, typ Type) error {
 			apply = true
 		case COMPOUND_LISTLIKE:
 			for _, el := range ex.elems {
-				if err := el.(TypedExpr).ApplyType(tc, asSlice.Of); err != nil {
+				if err := applyElemType(tc, el, asSlice.Of); err != nil {
 					return err
 				}
 			}
@@ -1711,7 +3446,7 @@ func (ex *CompoundLit) ApplyType(tc *TypesContext, typ Type) error {
 		case COMPOUND_LISTLIKE:
 			if len(ex.elems) == asArray.Size {
 				for _, el := range ex.elems {
-					if err := el.(TypedExpr).ApplyType(tc, asArray.Of); err != nil {
+					if err := applyElemType(tc, el, asArray.Of); err != nil {
 						return err
 					}
 				}
@@ -1725,13 +3460,16 @@ func (ex *CompoundLit) ApplyType(tc *TypesContext, typ Type) error {
 		case COMPOUND_EMPTY:
 			apply = true
 		case COMPOUND_LISTLIKE:
-			if len(ex.elems) != len(asStruct.Members) {
-				return ExprErrorf(ex, "Type has %d members, but literal has just %d",
-					len(asStruct.Members), len(ex.elems))
+			if keys := asStruct.MemberKeys(); len(ex.elems) < len(keys) {
+				return ExprErrorf(ex, "Type has %d members, but literal has just %d (missing: %s)",
+					len(keys), len(ex.elems), strings.Join(keys[len(ex.elems):], ", "))
+			} else if len(ex.elems) > len(keys) {
+				return ExprErrorf(ex, "Type has %d members, but literal has %d",
+					len(keys), len(ex.elems))
 			}
 
 			for i, el := range ex.elems {
-				if err := el.(TypedExpr).ApplyType(tc, asStruct.GetTypeN(i)); err != nil {
+				if err := applyElemType(tc, el, asStruct.GetTypeN(i)); err != nil {
 					return err
 				}
 			}
@@ -1751,7 +3489,7 @@ func (ex *CompoundLit) ApplyType(tc *TypesContext, typ Type) error {
 				if !ok {
 					return ExprErrorf(elName, "No member named %s", name)
 				}
-				if err := elType.(TypedExpr).ApplyType(tc, memb); err != nil {
+				if err := applyElemType(tc, elType, memb); err != nil {
 					return err
 				}
 			}
@@ -1766,11 +3504,11 @@ func (ex *CompoundLit) ApplyType(tc *TypesContext, typ Type) error {
 		case COMPOUND_MAPLIKE:
 			for i, el := range ex.elems {
 				if i%2 == 0 {
-					if err := el.(TypedExpr).ApplyType(tc, asMap.By); err != nil {
+					if err := applyElemType(tc, el, asMap.By); err != nil {
 						return err
 					}
 				} else {
-					if err := el.(TypedExpr).ApplyType(tc, asMap.Of); err != nil {
+					if err := applyElemType(tc, el, asMap.Of); err != nil {
 						return err
 					}
 				}
@@ -1787,6 +3525,11 @@ func (ex *CompoundLit) ApplyType(tc *TypesContext, typ Type) error {
 }
 
 func (ex *CompoundLit) GuessType(tc *TypesContext) (ok bool, typ Type) {
+	defer tc.leave()
+	if tc.enter(ex) != nil {
+		return false, nil
+	}
+
 	switch ex.kind {
 	case COMPOUND_EMPTY:
 		return false, nil
@@ -1835,15 +3578,25 @@ func (ex *CompoundLit) GuessType(tc *TypesContext) (ok bool, typ Type) {
 }
 
 func (ex *BinaryOp) Type(tc *TypesContext) (Type, error) {
+	defer tc.leave()
+	if err := tc.enter(ex); err != nil {
+		return nil, err
+	}
+
 	if ex.op.IsCompOp() {
 		return &SimpleType{SIMPLE_TYPE_BOOL}, nil
 	}
 
+	if ex.op.IsLogicalOp() && ex.hasMixedBoolOperands(tc) {
+		return &SimpleType{SIMPLE_TYPE_BOOL}, nil
+	}
+
 	leftTyp, err := ex.Left.(TypedExpr).Type(tc)
 	if err != nil {
 		return leftTyp, err
 	}
-	if leftTyp.Known() {
+	if leftTyp.Known() || ex.op.IsShiftOp() {
+		// Shifts have the type of the left operand, the count's type doesn't matter.
 		return leftTyp, nil
 	}
 	return ex.Right.(TypedExpr).Type(tc)
@@ -1853,8 +3606,12 @@ func (ex *BinaryOp) Type(tc *TypesContext) (Type, error) {
 // can be used to check if the common root type is comparable.
 func isRootTypeComparable(t Type) bool {
 	switch t.Kind() {
-	case KIND_CHAN, KIND_POINTER, KIND_SIMPLE, KIND_CUSTOM:
+	case KIND_CHAN, KIND_POINTER, KIND_SIMPLE:
 		return true
+	case KIND_CUSTOM:
+		// Named types are comparable if their underlying types are, e.g. elements
+		// of arrays and struct fields can be named.
+		return isRootTypeComparable(RootType(t))
 	case KIND_ARRAY:
 		return isRootTypeComparable(t.(*ArrayType).Of)
 	case KIND_GENERIC_INST, KIND_STRUCT:
@@ -1912,9 +3669,11 @@ func AreComparable(tc *TypesContext, e1, e2 TypedExpr) bool {
 	case rootT1.String() == rootT2.String():
 		return isRootTypeComparable(rootT1)
 	case IsInterface(t1):
-		return Implements(t1, t2)
+		// Non-interface values have to be comparable themselves, otherwise
+		// the comparison would always panic at runtime.
+		return Implements(t1, t2) && (IsInterface(t2) || isRootTypeComparable(rootT2))
 	case IsInterface(t2):
-		return Implements(t2, t1)
+		return Implements(t2, t1) && (IsInterface(t1) || isRootTypeComparable(rootT1))
 	}
 
 	return false
@@ -1941,6 +3700,22 @@ func firstErr(errors ...error) error {
 	return nil
 }
 
+// Chained comparisons like `a < b < c` aren't allowed, because the result of
+// one of them is a bool and bools can't be ordered. Spell it out for the user.
+func (ex *BinaryOp) checkChainedComparison() error {
+	for _, side := range []Expr{ex.Left, ex.Right} {
+		if comp, ok := side.(*BinaryOp); ok && comp.op.IsCompOp() {
+			result := "comparison"
+			if src, ok := exprSource(comp); ok {
+				result = src
+			}
+			return ExprErrorf(ex, "Invalid operation: operator %v not defined on bool (result of %s)",
+				ex.op.Value, result)
+		}
+	}
+	return nil
+}
+
 func (ex *BinaryOp) applyTypeForComparisonOp(tc *TypesContext, typ Type) error {
 	leftExpr, rightExpr := ex.Left.(TypedExpr), ex.Right.(TypedExpr)
 
@@ -1991,19 +3766,41 @@ func (ex *BinaryOp) applyTypeForComparisonOp(tc *TypesContext, typ Type) error {
 	}
 
 	if ex.op.IsOrderOp() {
+		if err := ex.checkChainedComparison(); err != nil {
+			return err
+		}
 		if !AreOrdered(t1, t2) {
 			return ExprErrorf(ex, "Operands of types %s and %s can't be ordered", t1, t2)
 		}
 	} else {
 		if !AreComparable(tc, leftExpr, rightExpr) {
+			if IsInterface(t1) != IsInterface(t2) {
+				concrete := t1
+				if IsInterface(t1) {
+					concrete = t2
+				}
+				if !isRootTypeComparable(RootType(concrete)) {
+					return ExprErrorf(ex, "Types %s and %s aren't comparable, %s", t1, t2, notComparableReason(concrete))
+				}
+			}
 			return ExprErrorf(ex, "Types %s and %s aren't comparable", t1, t2)
 		}
+
+		if tc.enabledWarnings.Has(WARN_FLOAT_EQUALITY) && IsTypeFloatingPoint(RootType(t1)) && IsTypeFloatingPoint(RootType(t2)) {
+			tc.addWarning(ExprErrorf(ex, "Floating-point values compared with `%s`", ex.op.Value))
+		}
 	}
 
+	tc.checkSelfCompare(ex, t1)
 	return nil
 }
 
 func (ex *BinaryOp) ApplyType(tc *TypesContext, typ Type) error {
+	defer tc.leave()
+	if err := tc.enter(ex); err != nil {
+		return err
+	}
+
 	// TODO: Validate concrete operators and types (logical operators only for bools,
 	// numeric operators for numeric types, no tuple types, etc).
 
@@ -2013,8 +3810,12 @@ func (ex *BinaryOp) ApplyType(tc *TypesContext, typ Type) error {
 	}
 
 	if ex.op.IsLogicalOp() {
-		if !IsBoolAssignable(typ) {
-			return ExprErrorf(ex, "Logical operators return bools, not %s", typ)
+		return ex.applyTypeForLogicalOp(tc, typ)
+	}
+
+	if (ex.op.IsIntegerOp() || ex.op.IsShiftOp()) && typ.Known() {
+		if root := RootType(typ); !IsTypeIntKind(root) && !IsTypeSimple(root, SIMPLE_TYPE_RUNE) {
+			return ExprErrorf(ex, "Operator %s not defined on %s", ex.op.Value, typ)
 		}
 	}
 
@@ -2022,10 +3823,108 @@ func (ex *BinaryOp) ApplyType(tc *TypesContext, typ Type) error {
 	if err := leftExpr.ApplyType(tc, typ); err != nil {
 		return err
 	}
-	return rightExpr.ApplyType(tc, typ)
+	if ex.op.IsShiftOp() {
+		if err := ex.checkShiftCount(tc); err != nil {
+			return err
+		}
+	} else if err := rightExpr.ApplyType(tc, typ); err != nil {
+		return err
+	}
+
+	// Untyped constant expressions are folded, so that values too large
+	// to be represented are reported.
+	if isUntypedConst(ex) {
+		_, err := constIntValue(tc, ex)
+		return err
+	}
+	return nil
+}
+
+// Operands of logical operators can be of different types, as long as
+// they're all based on bool.
+func (ex *BinaryOp) applyTypeForLogicalOp(tc *TypesContext, typ Type) error {
+	if !IsBoolAssignable(typ) {
+		return ExprErrorf(ex, "Logical operators return bools, not %s", typ)
+	}
+	if !IsTypeBool(RootType(typ)) {
+		// E.g. an interface, operands still have to be bools.
+		typ = &SimpleType{SIMPLE_TYPE_BOOL}
+	}
+
+	for _, operand := range []TypedExpr{ex.Left.(TypedExpr), ex.Right.(TypedExpr)} {
+		operandTyp, err := operand.Type(tc)
+		if err != nil {
+			return err
+		}
+		if !operandTyp.Known() {
+			operandTyp = typ
+		} else if !IsTypeBool(RootType(operandTyp)) {
+			return ExprErrorf(ex, "Operator %s not defined on %s", ex.op.Value, operandTyp)
+		}
+		if err := operand.ApplyType(tc, operandTyp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Tells whether both operands have known, but different types. Logical
+// operators with such operands (e.g. of a named bool type and of bool)
+// evaluate to plain bools.
+func (ex *BinaryOp) hasMixedBoolOperands(tc *TypesContext) bool {
+	leftTyp, err := ex.Left.(TypedExpr).Type(tc)
+	if err != nil || !leftTyp.Known() {
+		return false
+	}
+	rightTyp, err := ex.Right.(TypedExpr).Type(tc)
+	if err != nil || !rightTyp.Known() {
+		return false
+	}
+	return !IsIdentincal(leftTyp, rightTyp)
+}
+
+// The count of a shift has to be an unsigned integer, or an untyped constant
+// that is a non-negative integer.
+func (ex *BinaryOp) checkShiftCount(tc *TypesContext) error {
+	count := ex.Right.(TypedExpr)
+
+	// Constant counts like 1.0 are fine, as long as they're integral.
+	value, isInt, isConst := constNumValue(tc, count)
+	if isConst && (!value.IsInt() || value.Sign() < 0) {
+		return ExprErrorf(ex, "Invalid shift count %s, it must be a non-negative integer", describeConst(value))
+	}
+
+	countTyp, err := count.Type(tc)
+	if err != nil {
+		return err
+	}
+	if !countTyp.Known() {
+		if isConst && !isInt {
+			// Floats can't be applied the uint type, they keep their
+			// default type and are converted by Go.
+			var defaultTyp Type = &UnknownType{}
+			return NegotiateExprType(tc, &defaultTyp, count)
+		}
+		// Untyped constants are converted to uint.
+		var uintTyp Type = &SimpleType{SIMPLE_TYPE_UINT}
+		return NegotiateExprType(tc, &uintTyp, count)
+	}
+	if !IsTypeUnsigned(RootType(countTyp)) {
+		return ExprErrorf(ex, "Invalid shift count of type %s, it must be an unsigned integer", countTyp)
+	}
+	return count.ApplyType(tc, countTyp)
 }
 
 func (ex *BinaryOp) GuessType(tc *TypesContext) (ok bool, typ Type) {
+	defer tc.leave()
+	if tc.enter(ex) != nil {
+		return false, nil
+	}
+
+	if ex.op.IsShiftOp() {
+		return ex.Left.(TypedExpr).GuessType(tc)
+	}
+
 	leftOk, leftType := ex.Left.(TypedExpr).GuessType(tc)
 	rightOk, rightType := ex.Right.(TypedExpr).GuessType(tc)
 
@@ -2050,6 +3949,11 @@ func (ex *BinaryOp) GuessType(tc *TypesContext) (ok bool, typ Type) {
 }
 
 func (ex *UnaryOp) Type(tc *TypesContext) (Type, error) {
+	defer tc.leave()
+	if err := tc.enter(ex); err != nil {
+		return nil, err
+	}
+
 	if tc.IsTypeSet(ex) {
 		// Some type was negotiated already.
 		return tc.GetType(ex), nil
@@ -2068,8 +3972,10 @@ func (ex *UnaryOp) Type(tc *TypesContext) (Type, error) {
 			// underlying type is not a pointer
 			return &UnknownType{}, nil
 		}
+		tc.checkNilDeref(ex)
 		return rightType.(*PointerType).To, nil
 	case TOKEN_AMP:
+		tc.untrackNilVar(ex.Right)
 		return &PointerType{To: rightType}, nil
 	case TOKEN_SEND:
 		rootTyp := RootType(rightType)
@@ -2083,6 +3989,11 @@ func (ex *UnaryOp) Type(tc *TypesContext) (Type, error) {
 }
 
 func (ex *UnaryOp) ApplyType(tc *TypesContext, typ Type) error {
+	defer tc.leave()
+	if err := tc.enter(ex); err != nil {
+		return err
+	}
+
 	// TODO: Validate concrete operators and types (logical operators only for bools,
 	// numeric operators for numeric types, no tuple types, etc).
 	// The way it should be implemented is to reuse as much as possible with BinaryOp.
@@ -2091,8 +4002,15 @@ func (ex *UnaryOp) ApplyType(tc *TypesContext, typ Type) error {
 	case TOKEN_PLUS, TOKEN_MINUS, TOKEN_SHR, TOKEN_SHL:
 		return right.ApplyType(tc, typ)
 	case TOKEN_MUL:
+		tc.checkNilDeref(ex)
 		return right.ApplyType(tc, &PointerType{To: typ})
 	case TOKEN_AMP:
+		tc.untrackNilVar(ex.Right)
+		if ident, ok := ex.Right.(*Ident); ok {
+			if obj, ok := ident.object.(*Variable); ok && obj.isConst {
+				return ExprErrorf(ex, "Cannot take the address of constant %s", ident.name)
+			}
+		}
 		typ = UnderlyingType(typ)
 		if typ.Kind() != KIND_POINTER {
 			return ExprErrorf(ex, "Not a pointer type")
@@ -2136,6 +4054,11 @@ func (ex *UnaryOp) ApplyType(tc *TypesContext, typ Type) error {
 }
 
 func (ex *UnaryOp) GuessType(tc *TypesContext) (ok bool, typ Type) {
+	defer tc.leave()
+	if tc.enter(ex) != nil {
+		return false, nil
+	}
+
 	switch right := ex.Right.(TypedExpr); ex.op.Type {
 	case TOKEN_PLUS, TOKEN_MINUS, TOKEN_SHR, TOKEN_SHL:
 		return right.GuessType(tc)
@@ -2188,7 +4111,19 @@ func applyTypeToObject(obj Object, name string, typ Type) error {
 	return nil
 }
 
+// Returns the constant referred by ex if it's untyped, nil otherwise.
+func (ex *Ident) untypedConst() *Variable {
+	if !isUntypedConst(ex) {
+		return nil
+	}
+	return ex.object.(*Variable)
+}
+
 func (ex *Ident) Type(tc *TypesContext) (Type, error) {
+	if ex.untypedConst() != nil {
+		// Like literals, untyped constants get their type from the context.
+		return tc.GetType(ex), nil
+	}
 	typ, err := typeOfObject(ex.object, ex.name)
 	if err != nil {
 		return typ, ExprErrorf(ex, err.Error())
@@ -2197,6 +4132,9 @@ func (ex *Ident) Type(tc *TypesContext) (Type, error) {
 }
 
 func (ex *Ident) ApplyType(tc *TypesContext, typ Type) error {
+	if v := ex.untypedConst(); v != nil {
+		return ex.applyUntypedConst(tc, v, typ)
+	}
 	err := applyTypeToObject(ex.object, ex.name, typ)
 	if err != nil {
 		return ExprErrorf(ex, err.Error())
@@ -2204,7 +4142,50 @@ func (ex *Ident) ApplyType(tc *TypesContext, typ Type) error {
 	return nil
 }
 
+// Untyped constants can be used as values of any type that represents
+// them, e.g. an integer constant can initialize a float64 variable.
+func (ex *Ident) applyUntypedConst(tc *TypesContext, v *Variable, typ Type) error {
+	root, def := RootType(typ), RootType(v.Type)
+
+	// What matters is whether the value is representable in typ, e.g. 2.0
+	// can be an int, even though the constant's default type is float64.
+	value, _, folded := constNumValue(tc, v.init)
+
+	ok := false
+	if root.Kind() == KIND_SIMPLE && def.Kind() == KIND_SIMPLE {
+		switch {
+		case IsTypeIntKind(def) || IsTypeSimple(def, SIMPLE_TYPE_RUNE):
+			ok = IsTypeNumeric(root)
+		case IsTypeFloatKind(def):
+			ok = IsTypeFloatingPoint(root) || (IsTypeIntKind(root) && folded)
+		default:
+			ok = root.(*SimpleType).aliasedID() == def.(*SimpleType).aliasedID()
+		}
+	}
+	if !ok {
+		return ExprErrorf(ex, "Identifier %s is of type %s, can't assign type %s to it", ex.name, v.Type, typ)
+	}
+
+	if IsTypeIntKind(root) && folded && !value.IsInt() {
+		return ExprErrorf(ex, "Constant %s truncated to %s", describeConst(value), typ)
+	}
+	if IsTypeIntKind(root) && !tc.inConstDecl {
+		if _, err := constIntValue(tc, v.init); err != nil {
+			return err
+		}
+		if folded && !intConstFits(value.Num(), root.(*SimpleType)) {
+			return ExprErrorf(ex, "Constant %s overflows %s", value.Num(), typ)
+		}
+	}
+
+	tc.SetType(ex, typ)
+	return nil
+}
+
 func (ex *Ident) GuessType(tc *TypesContext) (ok bool, typ Type) {
+	if v := ex.untypedConst(); v != nil {
+		return true, v.Type
+	}
 	return false, nil
 }
 
@@ -2213,16 +4194,18 @@ func (ex *Ident) ReferedObject() Object {
 }
 
 func (ex *NilExpr) Type(tc *TypesContext) (Type, error) {
+	if !tc.IsTypeSet(ex) {
+		return &UnknownType{fromNil: true}, nil
+	}
 	return tc.GetType(ex), nil
 }
 
 func (ex *NilExpr) ApplyType(tc *TypesContext, typ Type) error {
-	switch RootType(typ).Kind() {
-	case KIND_POINTER, KIND_INTERFACE, KIND_MAP, KIND_SLICE, KIND_FUNC:
-		tc.SetType(ex, typ)
-		return nil
+	if !IsNilAssignable(typ) {
+		return ExprErrorf(ex, "Type %s can't be set to nil", typ)
 	}
-	return ExprErrorf(ex, "Type %s can't be set to nil", typ)
+	tc.SetType(ex, typ)
+	return nil
 }
 
 func (ex *NilExpr) GuessType(tc *TypesContext) (ok bool, typ Type) {
@@ -2237,7 +4220,7 @@ func (ex *BasicLit) ApplyType(tc *TypesContext, typ Type) error {
 	actualType := RootType(typ)
 
 	if actualType.Kind() != KIND_SIMPLE {
-		return ExprErrorf(ex, "Can't use this literal for type %s", typ)
+		return ExprErrorf(ex, "Can't use %s as %s", ex.describe(), typ)
 	}
 
 	switch {
@@ -2255,10 +4238,79 @@ func (ex *BasicLit) ApplyType(tc *TypesContext, typ Type) error {
 	case (ex.token.Type == TOKEN_TRUE || ex.token.Type == TOKEN_FALSE) &&
 		actualType.(*SimpleType).ID == SIMPLE_TYPE_BOOL:
 
+		if ex.token.Type == TOKEN_INT {
+			value, ok := new(big.Int).SetString(ex.token.Value.(string), 0)
+			if !ok {
+				return ExprErrorf(ex, "Invalid integer literal %s", ex.token.Value)
+			}
+			lit := ex.token.Value.(string)
+			if ex.negated {
+				value.Neg(value)
+				lit = "-" + lit
+			}
+			if !intConstFits(value, actualType.(*SimpleType)) {
+				return ExprErrorf(ex, "Constant %s overflows %s", lit, typ)
+			}
+		}
+
 		tc.SetType(ex, typ)
 		return nil
 	}
-	return ExprErrorf(ex, "Can't use this literal for type %s", typ)
+	return ExprErrorf(ex, "Can't use %s as %s", ex.describe(), typ)
+}
+
+// Describes the kind of the literal for error messages, e.g. "a string literal".
+func (ex *BasicLit) describe() string {
+	switch ex.token.Type {
+	case TOKEN_STR:
+		return "a string literal"
+	case TOKEN_INT:
+		return "an int literal"
+	case TOKEN_FLOAT:
+		return "a float literal"
+	case TOKEN_IMAG:
+		return "an imaginary literal"
+	case TOKEN_RUNE:
+		return "a rune literal"
+	case TOKEN_TRUE, TOKEN_FALSE:
+		return "a bool literal"
+	}
+	return "this literal"
+}
+
+// Tells whether an integer constant can be represented by a simple type.
+// Floating-point and complex types are assumed to fit all integers.
+func intConstFits(value *big.Int, t *SimpleType) bool {
+	var bits uint
+	signed := true
+
+	switch t.aliasedID() {
+	case SIMPLE_TYPE_INT8:
+		bits = 8
+	case SIMPLE_TYPE_INT16:
+		bits = 16
+	case SIMPLE_TYPE_INT32:
+		bits = 32
+	case SIMPLE_TYPE_INT, SIMPLE_TYPE_INT64:
+		bits = 64
+	case SIMPLE_TYPE_UINT8:
+		bits, signed = 8, false
+	case SIMPLE_TYPE_UINT16:
+		bits, signed = 16, false
+	case SIMPLE_TYPE_UINT32:
+		bits, signed = 32, false
+	case SIMPLE_TYPE_UINT, SIMPLE_TYPE_UINT64, SIMPLE_TYPE_UINTPTR:
+		bits, signed = 64, false
+	default:
+		return true
+	}
+
+	if signed {
+		limit := new(big.Int).Lsh(big.NewInt(1), bits-1)
+		return value.Cmp(new(big.Int).Neg(limit)) >= 0 && value.Cmp(limit) < 0
+	}
+	limit := new(big.Int).Lsh(big.NewInt(1), bits)
+	return value.Sign() >= 0 && value.Cmp(limit) < 0
 }
 
 func (ex *BasicLit) GuessType(tc *TypesContext) (ok bool, typ Type) {
@@ -2344,6 +4396,12 @@ func deduceGenericParams(tc *TypesContext, params []string, decls []Type, uses [
 				}
 			}
 
+			// Arguments of named types can be passed as parameters of unnamed types
+			// with the same underlying type (e.g. a named map type to delete()).
+			if decl.Kind() != KIND_GENERIC_PARAM && IsUnnamed(decl) && use.Kind() == KIND_CUSTOM {
+				use = UnderlyingType(use)
+			}
+
 			declSubts := []Type{}
 			mapSubtype(decl, func(t Type) bool {
 				declSubts = append(declSubts, t)
@@ -2386,7 +4444,11 @@ func deduceGenericParams(tc *TypesContext, params []string, decls []Type, uses [
 
 	// Check if all is known. If not, we'll need to another round with GuessTypes.
 	if len(reqs) != len(params) {
-		return nil, fmt.Errorf("Not all parameters were guessed")
+		for _, p := range params {
+			if _, ok := reqs[p]; !ok {
+				return nil, fmt.Errorf("Cannot infer generic param %s, specify it explicitly", p)
+			}
+		}
 	}
 
 	result := make([]Type, 0, len(params))
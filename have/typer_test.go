@@ -155,6 +155,64 @@ var a map[string]string = b`,
 			false,
 			"",
 		},
+		{`type Counts map[string]int
+var a = Counts{"a": 1}`,
+			true,
+			"Counts",
+		},
+		{`type Counts map[string]int
+func f() int {
+	var x = Counts{"a": 1}
+	x["b"] = x["a"] + 1
+	var n, ok = x["c"]
+	delete(x, "a")
+	for var k, v range x {
+		print(k, v, n, ok)
+	}
+	return len(x)
+}
+var a = f()`,
+			true,
+			"int",
+		},
+		{`type Counts map[string]int
+func f() {
+	var x = Counts{"a": "b"}
+}
+var a = 1`,
+			false,
+			"",
+		},
+		{`type Counts map[string]int
+func keys[K, V](m map[K]V) []K {
+	var result []K
+	for var k range m {
+		result = append(result, k)
+	}
+	return result
+}
+var a = keys(Counts{"a": 1})`,
+			true,
+			"[]string",
+		},
+		{`type grid map[[2]int]string
+var a grid = {{1, 2}: "aaa"}`,
+			true,
+			"grid",
+		},
+		{`var a map[interface{}]int = {1: 1, "a": 2}`,
+			true,
+			"map[interface{}]int",
+		},
+		{`type bad map[[]int]string
+var a = 1`,
+			false,
+			"",
+		},
+		{`var a map[map[int]int]int`,
+			false,
+			"",
+		},
 		{`var b, c, d = 2, 30, 40
 var a int = b * c + d + 10`,
 			true,
@@ -170,6 +228,14 @@ var y = b.x`,
 			true,
 			"int",
 		},
+		{`func f() int {
+	var b = struct { x int }
+	return b.x
+}
+var y = f()`,
+			true,
+			"int",
+		},
 		{`var b = struct {
 	c struct {
 		d string
@@ -402,6 +468,26 @@ var a = f(L{}...)`,
 var a = f("a", []int{}...)`,
 			true,
 			"int"},
+		{`func f(nums ...int) int { return 7 }
+var xs []int
+var a = f(xs...)`,
+			true,
+			"int"},
+		{`func f(nums ...int) int { return 7 }
+var xs []int
+var a = f(1, 2, xs...)`,
+			false,
+			""},
+		{`func f(b string, nums ...int) int { return 7 }
+var xs []int
+var a = f(xs...)`,
+			false,
+			""},
+		{`func f(nums []int) int { return 7 }
+var xs []int
+var a = f(xs...)`,
+			false,
+			""},
 	})
 }
 
@@ -705,6 +791,52 @@ var z = y`,
 			true,
 			"B",
 		},
+		{`
+func a() (int, int) {
+	pass
+}
+var x, y, z int
+x, y, z = a()
+var w = x`,
+			false,
+			"",
+		},
+		{`
+func a() (int, int, int) {
+	pass
+}
+var x, y = a()
+var z = x`,
+			false,
+			"",
+		},
+		{`
+func a() (int, int) {
+	pass
+}
+var x interface{} = a()
+var z = x`,
+			false,
+			"",
+		},
+		{`
+func a() (int, int) {
+	pass
+}
+var x = a()
+var z = x`,
+			false,
+			"",
+		},
+		{`
+func a() int {
+	pass
+}
+var x interface{} = a()
+var z = x`,
+			true,
+			"interface{}",
+		},
 	})
 }
 
@@ -743,6 +875,27 @@ var a = Abc{y: 7}`,
 			"Abc",
 		},
 		{`
+struct Abc {
+	func m() {
+		pass
+	}
+	x int
+	y string
+}
+var a = Abc{7, "a"}`,
+			true,
+			"Abc",
+		},
+		{`
+struct Abc {
+	x int
+	y string
+}
+var a = Abc{7}`,
+			false,
+			"",
+		},
+		{`
 struct Abc {
 	func x(z int) {
 		z = 3
@@ -803,6 +956,86 @@ var d = c
 			true,
 			"string",
 		},
+		{`
+struct Base {
+	x int
+}
+struct Abc {
+	Base
+	y string
+}
+var a Abc
+var b = a.x
+`,
+			true,
+			"int",
+		},
+		{`
+struct Base {
+	x int
+	func get() int {
+		return self.x
+	}
+}
+struct Abc {
+	*Base
+}
+var a Abc
+var b = a.get()
+`,
+			true,
+			"int",
+		},
+		{`
+struct Base {
+	x int
+	func *set(x int) {
+		self.x = x
+	}
+}
+struct Abc {
+	Base
+}
+var a Abc
+var b = a.set
+`,
+			true,
+			"func(int)",
+		},
+		{`
+struct Base {
+	x int
+}
+struct Mid {
+	Base
+}
+struct Abc {
+	Mid
+	x string
+}
+var a Abc
+var b = a.x
+`,
+			true,
+			"string",
+		},
+		{`
+struct A {
+	x int
+}
+struct B {
+	x int
+}
+struct Abc {
+	A
+	B
+}
+var a Abc
+var b = a.x
+`,
+			false,
+			"",
+		},
 	})
 }
 
@@ -977,1671 +1210,4758 @@ func p(value interface{}) int { pass }
 var x = p("aaa")`,
 			true,
 			"int"},
-	})
-}
-
-func TestTypesInterfaceMethods(t *testing.T) {
-	testVarTypes(t, []typeTestCase{
 		{`
-interface A {
-       func x() int
+interface Incer {
+	func Inc()
 }
-var a A
-var b = a.x()
-`,
-			true,
-			"int",
-		},
-	})
+struct Counter {
+	n int
+	func Inc() {
+		pass
+	}
 }
-
-func TestTypesSendExpr(t *testing.T) {
-	testVarTypes(t, []typeTestCase{
-		{`
-var x chan int
-x <- 1
-var y = x`,
-			true,
-			"chan int",
-		},
-		{`
-var x chan int
-x <- "bla"
-var y = x`,
-			false,
-			"",
-		},
-		{`
-var x chan<- int
-x <- 5
-var y = x`,
+struct Abc {
+	Counter
+}
+var a Incer = Abc{}
+var b = a
+`,
 			true,
-			"chan<- int",
+			"Incer",
 		},
 		{`
-var x <-chan int
-x <- 5
-var y = x`,
-			false,
-			"",
-		},
-	})
+interface Incer {
+	func Inc()
 }
-
-func TestTypesReturnStmt(t *testing.T) {
-	testVarTypes(t, []typeTestCase{
-		{`
-func a() int {
-	return 7
+struct Base {
+	x int
+	func *Inc() {
+		self.x = self.x + 1
+	}
 }
-var x = a()
+struct D {
+	Base
+}
+var d D
+var a Incer = &d
+var b = a
 `,
 			true,
-			"int",
+			"Incer",
 		},
 		{`
-func a() string {
-	return 7
+interface Incer {
+	func Inc()
 }
-var x = a()
+struct Base {
+	x int
+	func *Inc() {
+		self.x = self.x + 1
+	}
+}
+struct D {
+	*Base
+}
+var a Incer = D{}
+var b = a
 `,
-			false,
-			"",
+			true,
+			"Incer",
 		},
 		{`
-func a() (int, int) {
-	return 1
+interface Incer {
+	func Inc()
 }
-var x = a()
+struct Base {
+	x int
+	func *Inc() {
+		self.x = self.x + 1
+	}
+}
+struct D {
+	Base
+}
+var a Incer = D{}
 `,
 			false,
 			"",
 		},
 		{`
-struct A {
-	x int
+interface Reader {
+	func Read() int
 }
-func a() *A {
-	return &{1}
+struct Abc {
+	Reader
 }
-var x = a()
+var a Abc
+var r Reader = a
+var b = a.Read()
 `,
 			true,
-			"*A",
+			"int",
 		},
 	})
 }
 
-func TestTypesTmp(t *testing.T) {
+func TestTypesPointerMethodAddressability(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
 		{`
-type B []int
-func a() (int, []int) {
-	return 1, {}
+struct T {
+	x int
+	func *Mutate() {
+		self.x = 1
+	}
 }
-var x int, y B
-x, y = a()
-var z = y`,
-			true,
-			"B",
-		},
-	})
+func getVal() T {
+	return T{}
+}
+func f() {
+	getVal().Mutate()
+}
+var a = 1`,
+			false,
+			"",
+		},
+		{`
+struct T {
+	x int
+	func *Mutate() {
+		self.x = 1
+	}
+}
+func getPtr() *T {
+	return &T{}
+}
+func f() {
+	getPtr().Mutate()
+	var v T
+	v.Mutate()
+	var arr [2]T
+	arr[0].Mutate()
+}
+var a = 1`,
+			true,
+			"int",
+		},
+	})
 }
 
-func TestTypesTypeAssertion(t *testing.T) {
+func TestTypesInterfaceMethods(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
 		{`
-interface A {
-	func x()
+interface Named {
+	Stringer
+	func Name() string
 }
-struct B {
-	func x() {
-		pass
+interface Stringer {
+	func String() string
+}
+struct S {
+	func String() string {
+		return "s"
+	}
+	func Name() string {
+		return "n"
 	}
 }
-var x A
-var y = x.(B)`,
+var n Named = S{}
+var s Stringer = n
+var x = n.String()`,
 			true,
-			"B",
+			"string",
 		},
 		{`
-interface A {
-	func x()
+interface Named {
+	Stringer
 }
-struct B {
-	func xx() {
-		pass
+interface Stringer {
+	func String() string
+}
+struct S {
+	func Name() string {
+		return "n"
 	}
 }
-var x A
-var y = x.(B)`,
-			false, // B doesn't implement A
+var n Named = S{} // S doesn't have the embedded String method`,
+			false,
 			"",
 		},
 		{`
-struct B {
-	func x() {
-		pass
-	}
+interface A {
+       func x() int
 }
-var x B
-var y = x.(B)`,
-			false, // non-interface on left
+var a A
+var b = a.x()
+`,
+			true,
+			"int",
+		},
+		{`
+interface Counter {
+	func Count() int
+}
+func f(c Counter) int {
+	n := c.Count()
+	return n
+}
+var c Counter
+var a = f(c)`,
+			true,
+			"int",
+		},
+		{`
+interface Counter {
+	func Count() int
+}
+var c Counter
+var a string = c.Count()`,
+			false,
 			"",
 		},
 		{`
-interface A {
-	func x()
+interface Reader {
+	func Read(buf []byte) (int, error)
 }
-struct B {
-	func x() {
-		pass
+func f(r Reader) int {
+	var buf []byte
+	n, err := r.Read(buf)
+	if err != nil {
+		return 0
 	}
+	return n
 }
-var x A
-var y, z = x.(B)
-var final = z`,
+var r Reader
+var a = f(r)`,
 			true,
-			"bool",
+			"int",
+		},
+		{`
+interface Reader {
+	func Read(buf []byte) (int, error)
+}
+func f(r Reader) error {
+	var buf []byte
+	var n, err = r.Read(buf)
+	return err
+}
+var r Reader
+var a = f(r)`,
+			true,
+			"error",
+		},
+		{`
+interface Reader {
+	func Read(buf []byte) (int, error)
+}
+func f(r Reader) int {
+	var buf []byte
+	n := r.Read(buf)
+	return n
+}
+var r Reader
+var a = f(r)`,
+			false, // Read returns two values
+			"",
 		},
 	})
 }
 
-func TestTypesSwitch(t *testing.T) {
+func TestTypesInterfaceCompoundLitElems(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
 		{`
-var a = 7
-switch a {
-case 1:
-	pass
-default:
-	pass
+var x = []interface{}{1, "two", true}`,
+			true,
+			"[]interface{}",
+		},
+		{`
+var x = map[string]interface{}{"a": 1, "b": 2.5, "c": nil}`,
+			true,
+			"map[string]interface{}",
+		},
+		{`
+struct E {
+	code int
+	func Error() string {
+		return "e"
+	}
 }
-var c = true
-`,
+var x = []error{E{code: 1}, E{}, nil}`,
 			true,
-			"bool",
+			"[]error",
 		},
 		{`
-var a = 7
-switch a {
-case "bla":
-	pass
+struct E {
+	code int
+	func Error() string {
+		return "e"
+	}
 }
-var c = true
-`,
+var x = []error{E{code: 1}, 5}`,
 			false,
 			"",
 		},
 		{`
-var a = 7
-switch a {
-case 1, 2, 3:
-	pass
+struct F { code int }
+var x = []error{F{code: 1}}`,
+			false,
+			"",
+		},
+		{`
+interface Stringer {
+	func String() string
 }
-var c = true
-`,
+struct T {
+	x int
+	func *String() string {
+		return "t"
+	}
+}
+func f() []Stringer {
+	var a, b T
+	return []Stringer{&a, &b}
+}
+var x = f()`,
 			true,
-			"bool",
+			"[]Stringer",
 		},
 		{`
-var a = 7
-switch a {
-case 1, 4.5, 3:
-	pass
+interface Stringer {
+	func String() string
 }
-var c = true
-`,
+struct T {
+	x int
+	func String() string {
+		return "t"
+	}
+}
+func f() []Stringer {
+	var a, b T
+	return []Stringer{&a, &b}
+}
+var x = f()`,
+			true,
+			"[]Stringer",
+		},
+		{`
+interface Stringer {
+	func String() string
+}
+struct T {
+	x int
+	func *String() string {
+		return "t"
+	}
+}
+func f() []Stringer {
+	var a, b T
+	return []Stringer{a, &b}
+}
+var x = f()`,
 			false,
 			"",
 		},
 		{`
-switch {
-case 1 == 2:
-	pass
+interface Stringer {
+	func String() string
 }
-var c = true
-`,
+struct T {
+	x int
+}
+func f() []Stringer {
+	var a, b T
+	return []Stringer{&a, &b}
+}
+var x = f()`,
+			false,
+			"",
+		},
+	})
+}
+
+func TestTypesSendExpr(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+var x chan int
+x <- 1
+var y = x`,
 			true,
-			"bool",
+			"chan int",
 		},
 		{`
-switch {
-case 1 == 2, true:
-	pass
-}
-var c = true
-`,
+var x chan int
+x <- "bla"
+var y = x`,
 			false,
 			"",
 		},
 		{`
-switch {
-case "bla":
-	pass
-}
-var c = true
-`,
+var x chan<- int
+x <- 5
+var y = x`,
+			true,
+			"chan<- int",
+		},
+		{`
+var x <-chan int
+x <- 5
+var y = x`,
 			false,
 			"",
 		},
 		{`
-switch {
-case true:
-	var c int = "not_an_int"
-}
-var c = true
-`,
+var x chan float64
+x <- 5
+var y = x`,
+			true,
+			"chan float64",
+		},
+		{`
+var x chan float64
+var i int
+x <- i // Only untyped constants adopt the channel's type
+var y = x`,
 			false,
 			"",
 		},
 		{`
-switch var x = 7; x {
-case 5:
-	x = 8
-}
-var c = true
-`,
+struct S { ch chan int }
+var s S
+s.ch <- 1
+var y = s.ch`,
 			true,
-			"bool",
+			"chan int",
 		},
 		{`
-var x int
-switch x = 7; x {
-case 5:
-	x = 8
+struct S { ch chan int }
+var s *S
+s.ch <- "a"
+var y = s.ch`,
+			false,
+			"",
+		},
+		{`
+struct S { ch int }
+var s S
+s.ch <- 1
+var y = s.ch`,
+			false,
+			"",
+		},
+		{`
+interface I {
+	func f()
 }
-var c = true
-`,
+struct S {
+	func f() {
+	}
+}
+var x chan I
+var s S
+x <- s
+var y = x`,
 			true,
-			"bool",
+			"chan I",
 		},
 	})
 }
 
-func TestTypesTypeSwitch(t *testing.T) {
+func TestTypesDeferStmt(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
 		{`
-var bla interface {}
-switch bla.(type) {
-case int:
-	pass
+func f() {
+	defer func() {
+		var x int = "a" // Bodies of deferred literals are checked
+	}()
 }
-var y = true`, true, "bool"},
+var x = 1`,
+			false,
+			"",
+		},
 		{`
-var bla interface {
-	func a()
-}
-struct x {
-	func a() {
-		pass
-	}
+func f() int {
+	defer 1
+	return 1
 }
-switch bla.(type) {
-case x: // Error: impossible assertion, x doesn't implement the interface
+var x = 1`,
+			false,
+			"",
+		},
+		{`
+func g(a int) {
 	pass
 }
-var y = true`, true, "bool"},
-		{`
-var bla interface {
-	func a()
+func f() {
+	defer g("a")
 }
-struct x {
+var x = 1`,
+			false,
+			"",
+		},
+		{`
+func g(a int) {
 	pass
 }
-switch bla.(type) {
-case x: // Error: impossible assertion, x doesn't implement the interface
-	pass
+func f() {
+	defer g(1)
 }
-var y = true`, false, ""},
-		{`
-var bla int
-switch bla.(type) { // Error: non-interface used for type switch
-case int:
-	pass
+var x = 1`,
+			true,
+			"int",
+		},
+	})
 }
-var y = true`, false, ""},
+
+func TestTypesGoAndDeferSpreadArgs(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
 		{`
-var bla interface {}
-switch var x = bla.(type) {
-case int:
+func f(a int, b string) {
 	pass
 }
-var y = true`, true, "bool"},
-		{`
-var bla interface{}
-switch var x = bla.(int) { // "int" instead of "type"
-case int:
-	pass
+func g() (int, string) {
+	return 1, "a"
 }
-var y = true`, false, ""},
+func h() {
+	go f(g())
+	defer f(g())
+}
+var x = 1`,
+			true,
+			"int",
+		},
 		{`
-var bla interface{}
-switch var x = bla.(type) {
-case "ble": // Error: not a type name
+func f(a int, b string, c int) {
 	pass
 }
-var y = true`, false, ""},
-		{`
-var bla interface {}
-switch var x = bla.(type) {
-case int:
-	var z int = x
+func g() (int, string) {
+	return 1, "a"
 }
-var y = true`, true, "bool"},
+func h() {
+	go f(g())
+}
+var x = 1`,
+			false,
+			"",
+		},
 		{`
-var bla interface {
+func f(a int) {
 	pass
 }
-switch var x = bla.(type) {
-case int:
-	var z string = x // Error: string and int are not assignable
-}
-var y = true`, false, ""},
-		{`
-var bla = 123
-var bla interface {}
-switch var x = bla.(type) {
-case int:
-	var z int = x
-case string:
-	var z string = x
+func g() (int, string) {
+	return 1, "a"
 }
-var y = true`, true, "bool"},
-	})
+func h() {
+	defer f(g())
 }
-
-func TestTypesRecvExpr(t *testing.T) {
-	testVarTypes(t, []typeTestCase{
-		{`
-var a chan int
-var b = <-a`,
-			true,
-			"int",
-		},
-		{`
-var a <-chan int
-var b = <-a`,
-			true,
-			"int",
-		},
-		{`
-var a chan<- int
-var b = <-a`,
+var x = 1`,
 			false,
 			"",
 		},
 		{`
-var a string
-var b = <-a`,
+func f(a string, b int) {
+	pass
+}
+func g() (int, string) {
+	return 1, "a"
+}
+func h() {
+	go f(g())
+}
+var x = 1`,
 			false,
 			"",
 		},
 		{`
-type Ch chan int
-var a Ch
-var b = <-a`,
-			true,
-			"int",
-		},
-		{`
-var a chan int
-var b, c = <-a
-var d = c`,
-			true,
-			"bool",
-		},
-		{`
-var a chan int
-var b, c = <-a
-var d = b`,
-			true,
-			"int",
-		},
-	})
+func h() {
+	go 1
 }
-
-func TestTypesRunes(t *testing.T) {
-	testVarTypes(t, []typeTestCase{
-		{`
-var a rune = 'a'
-`,
-			true,
-			"rune",
-		},
-		{`
-var a rune = 100
-`,
-			true,
-			"rune",
-		},
-		{`
-var a = 'a'
-`,
-			true,
-			"rune",
+var x = 1`,
+			false,
+			"",
 		},
 	})
 }
 
-func TestTypesBlankIdent(t *testing.T) {
+func TestTypesReturnStmt(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
 		{`
-var _ = 1
-`,
-			true,
-			"int",
-		},
-		{`
-var _ = 1
-_ = 2
-var _ = 3
+func a() int {
+	return 7
+}
+var x = a()
 `,
 			true,
 			"int",
 		},
 		{`
-var _ = 1
-var a int = _
+func a() string {
+	return 7
+}
+var x = a()
 `,
 			false,
 			"",
 		},
 		{`
-func a() (int, string) {
-	return 1, "a"
-}
-var _, _ = a()
-var placeholder = 1
-`,
-			true,
-			"int",
-		},
-		{`
-func a() (int, string) {
-	return 1, "a"
+func a() (int, int) {
+	return 1
 }
-var s string
-_, s = a()
-var placeholder = 1
+var x = a()
 `,
-			true,
-			"int",
+			false,
+			"",
 		},
 		{`
-var a int
-for _, a range {1, 2, 3} {
-	pass
+struct A {
+	x int
 }
-var placeholder = 1
-`,
-			true,
-			"int",
-		},
-		{`
-for var _, a range {1, 2, 3} {
-	pass
+func a() *A {
+	return &{1}
 }
-var placeholder = 1
+var x = a()
 `,
 			true,
-			"int",
+			"*A",
 		},
 		{`
-var a string
-for _, a range {1, 2, 3} {
-	pass
+type B []int
+func a() (int, []int) {
+	return 1, {}
 }
-var placeholder = 1
-`,
-			false,
-			"",
-		},
-		{`
-if true { // check in a block
-	_ = 1
+func b() (int, B) {
+	return a()
 }
-var placeholder = 1
-`,
+var x, y = b()
+var z = y`,
 			true,
-			"int",
+			"B",
 		},
 		{`
 func a() (int, string) {
 	return 1, "a"
 }
-if var _, s = a(); s == "a" {
-	pass
+func b() (int, string, bool) {
+	return a()
 }
-var placeholder = 1
-`,
-			true,
-			"int",
+var x, y, z = b()`,
+			false,
+			"",
 		},
 		{`
-func a() (int, string) {
-	return 1, "a"
+func a() (int, int) {
+	return 1, 2
 }
-var s string
-if _, s = a(); s == "a" {
-	pass
+func b() (int, string) {
+	return a()
 }
-var placeholder = 1
-`,
-			true,
-			"int",
+var x, y = b()`,
+			false,
+			"",
 		},
 	})
 }
 
-func TestTypesNumberLiterals(t *testing.T) {
+func TestTypesTmp(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
-		{`var b = 1e10`,
+		{`
+type B []int
+func a() (int, []int) {
+	return 1, {}
+}
+var x int, y B
+x, y = a()
+var z = y`,
 			true,
-			"float64",
-		},
-		{`var b = 0.5`,
-			true,
-			"float64",
-		},
-		{`var b float32 = 0.5`,
-			true,
-			"float32",
-		},
-		{`var b = 50`,
-			true,
-			"int",
-		},
-		{`var b float32 = 50`,
-			true,
-			"float32",
-		},
-		{`var b = 50i`,
-			true,
-			"complex128",
+			"B",
 		},
 	})
 }
 
-func TestTypesOrdered(t *testing.T) {
+func TestTypesTypeAssertion(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
-		{`var a, b int
-var c = a < b`,
+		{`
+interface A {
+	func x()
+}
+struct B {
+	func x() {
+		pass
+	}
+}
+var x A
+var y = x.(B)`,
 			true,
-			"bool",
+			"B",
 		},
-		{`var a, b int8
-var c = a < b`,
-			true,
-			"bool",
+		{`
+interface A {
+	func x()
+}
+struct B {
+	func xx() {
+		pass
+	}
+}
+var x A
+var y = x.(B)`,
+			false, // B doesn't implement A
+			"",
 		},
-		{`var a, b byte
-var c = a < b`,
-			true,
-			"bool",
+		{`
+struct B {
+	func x() {
+		pass
+	}
+}
+var x B
+var y = x.(B)`,
+			false, // non-interface on left
+			"",
 		},
-		{`var a, b rune
-var c = a < b`,
+		{`
+interface A {
+	func x()
+}
+struct B {
+	func x() {
+		pass
+	}
+}
+var x A
+var y, z = x.(B)
+var final = z`,
 			true,
 			"bool",
 		},
-		{`var a, b string
-var c = a < b`,
+		{`
+var v interface{} = 5
+var a = v.(int) == 5`,
 			true,
 			"bool",
 		},
-		{`var a, b float64
-var c = a < b`,
-			true,
-			"bool",
+		{`
+var v interface{} = 5
+var a = v.(int) == "a"`,
+			false,
+			"",
 		},
 		{`
-type t int
-var a, b t
-var c = a < b`,
+struct S { l int }
+var v interface{}
+var o S
+var a = v.(S) == o`,
 			true,
 			"bool",
 		},
-		{`var a, b bool
-var c = a < b`,
-			false,
-			"",
-		},
 		{`
-type t bool
-var a, b t
-var c = a < b`,
+struct S { l []int }
+var v interface{}
+var o S
+var a = v.(S) == o`,
 			false,
 			"",
 		},
 	})
 }
 
-func TestTypesComparability(t *testing.T) {
+func TestTypesSwitch(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
-		{`var a, b bool
-var c = a == b`,
-			true,
-			"bool",
-		},
-		{`var a, b int
-var c = a == b`,
-			true,
-			"bool",
-		},
-		{`var a, b *int
-var c = a == b`,
-			true,
-			"bool",
-		},
-		{`var a, b chan int
-var c = a == b`,
-			true,
-			"bool",
-		},
-		{`var a, b interface{}
-var c = a == b`,
-			true,
-			"bool",
-		},
 		{`
-interface I{ func f() }
-struct S { func f() { pass } }
-var a I, b S	
-var c = a == b`,
+var a = 7
+switch a {
+case 1:
+	pass
+default:
+	pass
+}
+var c = true
+`,
 			true,
 			"bool",
 		},
 		{`
-interface I{ func f() }
-struct S{}// S doesn't implement I, so S and I aren't comparable
-var a I, b S	
-var c = a == b`,
+var a = 7
+switch a {
+case "bla":
+	pass
+}
+var c = true
+`,
 			false,
 			"",
 		},
 		{`
-struct S{ x int }
-var a, b S
-var c = a == b`,
+var a = 7
+switch a {
+case 1, 2, 3:
+	pass
+}
+var c = true
+`,
 			true,
 			"bool",
 		},
 		{`
-struct S{ x []int } // []int aren't comparable, so S isn't comparable
-var a, b S
-var c = a == b`,
+var a = 7
+switch a {
+case 1, 4.5, 3:
+	pass
+}
+var c = true
+`,
 			false,
 			"",
 		},
 		{`
-var a, b [1]int
-var c = a == b`,
+switch {
+case 1 == 2:
+	pass
+}
+var c = true
+`,
 			true,
 			"bool",
 		},
 		{`
-var a, b [1][]int // slices aren't comparable, so arrays of them aren't too
-var c = a == b`,
+switch {
+case 1 == 2, true:
+	pass
+}
+var c = true
+`,
 			false,
-			"bool",
+			"",
 		},
-		{`var x, y func()
-var y = x == y // Functions aren't comparable`,
+		{`
+switch {
+case "bla":
+	pass
+}
+var c = true
+`,
 			false,
 			"",
 		},
-		{`var x map[string]int
-var y = x == nil // Special case, can compare to nil`,
-			true,
-			"bool",
+		{`
+switch {
+case true:
+	var c int = "not_an_int"
+}
+var c = true
+`,
+			false,
+			"",
 		},
-		{`var x []int
-var y = x == nil // Special case, can compare to nil`,
+		{`
+switch var x = 7; x {
+case 5:
+	x = 8
+}
+var c = true
+`,
 			true,
 			"bool",
 		},
-		{`var x func()
-var y = x == nil // Special case, can compare to nil`,
+		{`
+var x int
+switch x = 7; x {
+case 5:
+	x = 8
+}
+var c = true
+`,
 			true,
 			"bool",
 		},
 	})
 }
 
-func TestTypesNil(t *testing.T) {
+func TestTypesTypeSwitch(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
-		{`var a *int = nil`,
-			true,
-			"*int",
-		},
 		{`
-interface A {
-	func x()
+var bla interface {}
+switch bla.(type) {
+case int:
+	pass
 }
-var a A = nil`,
-			true,
-			"A",
-		},
+var y = true`, true, "bool"},
 		{`
-interface A {
-	func x()
+var bla interface {
+	func a()
 }
-var a = A(nil)`,
-			true,
-			"A",
-		},
+struct x {
+	func a() {
+		pass
+	}
+}
+switch bla.(type) {
+case x: // Error: impossible assertion, x doesn't implement the interface
+	pass
+}
+var y = true`, true, "bool"},
 		{`
-var a interface {
-	func x()
-} = nil`,
+var bla interface {
+	func a()
+}
+struct x {
+	pass
+}
+switch bla.(type) {
+case x: // Error: impossible assertion, x doesn't implement the interface
+	pass
+}
+var y = true`, false, ""},
+		{`
+var bla int
+switch bla.(type) { // Error: non-interface used for type switch
+case int:
+	pass
+}
+var y = true`, false, ""},
+		{`
+var bla interface {}
+switch var x = bla.(type) {
+case int:
+	pass
+}
+var y = true`, true, "bool"},
+		{`
+var bla interface{}
+switch var x = bla.(int) { // "int" instead of "type"
+case int:
+	pass
+}
+var y = true`, false, ""},
+		{`
+var bla interface{}
+switch var x = bla.(type) {
+case "ble": // Error: not a type name
+	pass
+}
+var y = true`, false, ""},
+		{`
+var bla interface {}
+switch var x = bla.(type) {
+case int:
+	var z int = x
+}
+var y = true`, true, "bool"},
+		{`
+var bla interface {
+	pass
+}
+switch var x = bla.(type) {
+case int:
+	var z string = x // Error: string and int are not assignable
+}
+var y = true`, false, ""},
+		{`
+var bla = 123
+var bla interface {}
+switch var x = bla.(type) {
+case int:
+	var z int = x
+case string:
+	var z string = x
+}
+var y = true`, true, "bool"},
+	})
+}
+
+func TestTypesRecvExpr(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+var a chan int
+var b = <-a`,
 			true,
-			"interface{x()}",
+			"int",
 		},
-		{`var a int = nil`,
-			false,
-			"",
+		{`
+var a <-chan int
+var b = <-a`,
+			true,
+			"int",
 		},
-		{`var a string = nil`,
+		{`
+var a chan<- int
+var b = <-a`,
 			false,
 			"",
 		},
 		{`
-struct A {
-	x int
-}
-var a A = nil`,
+var a string
+var b = <-a`,
 			false,
 			"",
 		},
-		{`var a *int = nil
-var b = a == nil`,
+		{`
+type Ch chan int
+var a Ch
+var b = <-a`,
+			true,
+			"int",
+		},
+		{`
+var a chan int
+var b, c = <-a
+var d = c`,
 			true,
 			"bool",
 		},
+		{`
+var a chan int
+var b, c = <-a
+var d = b`,
+			true,
+			"int",
+		},
 	})
 }
 
-func TestTypesCompareLiterals(t *testing.T) {
+func TestTypesRunes(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
-		{`var x []int
-var y = x == {1, 2, 3} // slices aren't comparable`,
-			false,
-			"",
+		{`
+var a rune = 'a'
+`,
+			true,
+			"rune",
 		},
-		{`var x []int
-var y = x == {1, "bla", 3}`,
-			false,
-			"",
+		{`
+var a = '\n'
+`,
+			true,
+			"rune",
 		},
-		{`var x []int
-var y = x == nil // as a special case, slices/maps/functions can be compared to nil`,
+		{`
+var a rune = 100
+`,
 			true,
-			"bool",
+			"rune",
 		},
-		{`var x []int
-var y = nil == x`,
+		{`
+var a = 'a'
+`,
 			true,
-			"bool",
+			"rune",
 		},
-		{`var y = nil == nil`,
-			false,
-			"",
+		{`
+var r rune = 65
+var a = r
+`,
+			true,
+			"rune",
 		},
-		{`var x map[string]int
-var y = x == {"a": 1, "b": 2, "c": 3} // maps aren't comparable`,
-			false,
-			"",
+		{`
+var a = rune('A')
+`,
+			true,
+			"rune",
 		},
-		{`var x map[string]int
-var y = x == {1, 2, 3}`,
+		{`
+var r rune = 'A'
+var a = int32(r)
+`,
+			true,
+			"int32",
+		},
+		{`
+var r rune = 'A'
+var a int32 = r
+`,
+			true,
+			"int32",
+		},
+		{`
+var b byte = 1
+var a uint8 = b
+`,
+			true,
+			"uint8",
+		},
+		{`
+var r rune = 'A'
+var a int64 = r
+`,
 			false,
 			"",
 		},
 	})
 }
 
-func TestTypesIndices(t *testing.T) {
+func TestTypesMultilineExprs(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
-		{`var x []int
-var y = x[0]`,
+		{`
+func f(a, b int) int {
+	return a
+}
+var x = f(1,
+	2)`,
 			true,
 			"int",
 		},
-		{`var x [7]int
-var y = x[0]`,
+		{`
+func f(a, b int) int {
+	return a
+}
+var x = f(
+	1,
+	2,
+)`,
 			true,
 			"int",
 		},
-		{`var x [7]int
-var y = 5 == x[0]`,
+		{`
+var x = []int{1,
+	2,
+	3}`,
 			true,
-			"bool",
+			"[]int",
 		},
-		{`var y = 5 == {1,2,3,4}[0]`,
+		{`
+var a = [2]int{1, 2}
+var x = a[
+	1]`,
 			true,
-			"bool",
+			"int",
 		},
-		{`var y = "lala"[0]`,
+	})
+}
+
+func TestTypesShortVarDecl(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+func f() int {
+	if x := 3; x > 1 {
+		return x
+	}
+	return 0
+}
+var a = f()`,
 			true,
-			"byte",
+			"int",
 		},
-		{`var x = &([3]int{0,1,2})
-var y = x[0]`,
+		{`
+func g() (int, string) {
+	return 1, "a"
+}
+func f() string {
+	a, b := g()
+	return b
+}
+var a = f()`,
 			true,
-			"int",
+			"string",
 		},
-		{`var x = &([]int{0,1,2})
-var y = x[0]`,
+		{`
+func f() string {
+	a, b := 1, "x"
+	return a
+}
+var a = f()`,
 			false,
 			"",
 		},
-		{`var x map[string]int
-var y = x["bla"]`,
+	})
+}
+
+func TestTypesBlankIdent(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+var _ = 1
+`,
 			true,
 			"int",
 		},
-		{`var x map[string]int
-var y = x[5]`,
-			false,
-			"",
-		},
-		{`var x []int
-var y, z = x[0]
-var a = y`,
-			false,
+		{`
+var _ = 1
+_ = 2
+var _ = 3
+`,
+			true,
+			"int",
+		},
+		{`
+var _ = 1
+var a int = _
+`,
+			false,
 			"",
 		},
-		{`var x map[string]int
-var y, z = x["a"]
-var a = y`,
+		{`
+func a() (int, string) {
+	return 1, "a"
+}
+var _, _ = a()
+var placeholder = 1
+`,
 			true,
 			"int",
 		},
-		{`var x map[string]int
-var y, z = x["a"]
-var a = z`,
+		{`
+func a() (int, string) {
+	return 1, "a"
+}
+var s string
+_, s = a()
+var placeholder = 1
+`,
+			true,
+			"int",
+		},
+		{`
+func a() (int, string) {
+	return 1, "a"
+}
+func f() string {
+	_, b := a()
+	return b
+}
+var b = f()
+`,
+			true,
+			"string",
+		},
+		{`
+func a() (int, string, bool) {
+	return 1, "a", true
+}
+func f() bool {
+	_, _, c := a()
+	_, _, _ = a()
+	return c
+}
+var c = f()
+`,
 			true,
 			"bool",
 		},
-		{`var x map[string]float32
-var y int, z bool
-y, z = x["a"]
-var a = y`,
+		{`
+func a() (int, string) {
+	return 1, "a"
+}
+var s int
+_, s = a() // the blank doesn't hide mismatches of other targets
+var placeholder = 1
+`,
 			false,
 			"",
 		},
-		{`var x map[string]int
-func f(a int, b bool) int:
+		{`
+var a int
+for _, a range {1, 2, 3} {
 	pass
-var a = f(x["b"])`,
-			false,
-			"",
-		},
-		{`var x map[string]int
-var y int, z bool 
-y, z = x["a"]
-var a = y`,
+}
+var placeholder = 1
+`,
 			true,
 			"int",
 		},
-		{`var x map[string]int
-var y int, z bool
-y, z = x["a"]
-var a = z`,
+		{`
+for var _, a range {1, 2, 3} {
+	pass
+}
+var placeholder = 1
+`,
 			true,
-			"bool",
+			"int",
 		},
-		{`var x map[string]int
-var y, z int
-y, z = x["a"]
-var a = z`,
+		{`
+var a string
+for _, a range {1, 2, 3} {
+	pass
+}
+var placeholder = 1
+`,
 			false,
 			"",
 		},
-		{`var x []int
-var y = x[1:5]`,
-			true,
-			"[]int",
-		},
-		{`var x [7]int
-var y = x[1:5]`,
+		{`
+if true { // check in a block
+	_ = 1
+}
+var placeholder = 1
+`,
 			true,
-			"[]int",
+			"int",
 		},
-		{`var x string
-var y = x[1:5]`,
+		{`
+func a() (int, string) {
+	return 1, "a"
+}
+if var _, s = a(); s == "a" {
+	pass
+}
+var placeholder = 1
+`,
 			true,
-			"[]byte",
+			"int",
 		},
-		{`var x *[7]int
-var y = x[1:5]`,
+		{`
+func a() (int, string) {
+	return 1, "a"
+}
+var s string
+if _, s = a(); s == "a" {
+	pass
+}
+var placeholder = 1
+`,
 			true,
-			"[]int",
-		},
-		{`var x *[]int
-var y = x[1:5]`,
-			false,
-			"",
-		},
-		{`var x int
-var y = x[1:5]`,
-			false,
-			"",
+			"int",
 		},
 	})
 }
 
-func TestTypesGenericFunc(t *testing.T) {
+func TestTypesNumberLiterals(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
-		{`
-func a[T]() int { // Something very simple for start
-	return 1
-}
-var x = a[float32]()`,
+		{`var b = 1e10`,
 			true,
-			"int",
+			"float64",
 		},
-		{`
-func a[T]() T {
-	return 1
-}
-var x = a[float32]()`,
+		{`var b = 0.5`,
+			true,
+			"float64",
+		},
+		{`var b float32 = 0.5`,
 			true,
 			"float32",
 		},
-		{`
-func a[T](x T) T {
-	return 1 + x
-}
-var x = a[float32](4)`,
+		{`var b = 50`,
+			true,
+			"int",
+		},
+		{`var b float32 = 50`,
 			true,
 			"float32",
 		},
-		{`
-func a[T](x T) T { // Trying to add string literal "aaa" to float32
-	return "aaa" + x
-}
-var x = a[float32](4)`,
+		{`var b = 50i`,
+			true,
+			"complex128",
+		},
+		{`var b = .5`, true, "float64"},
+		{`var b = 0xFF`, true, "int"},
+		{`var b = 0o17`, true, "int"},
+		{`var b = 0b1010`, true, "int"},
+		{`var b uint8 = 0xFF`, true, "uint8"},
+		{`var b int8 = 0xFF`, false, ""},
+		{`var b uint8 = 0x100`, false, ""},
+		{`var b int8 = -128`, true, "int8"},
+		{`var b int8 = -129`, false, ""},
+		{`var b uint = -1`, false, ""},
+		{`var b uint8 = -1`, false, ""},
+		{`var b uint8 = 255`, true, "uint8"},
+		{`var b uint8 = 256`, false, ""},
+		{`var b uint16 = 65535`, true, "uint16"},
+		{`var b uint64 = 18446744073709551615`, true, "uint64"},
+		{`var b int64 = 18446744073709551615`, false, ""},
+		{`
+var a uint8 = 200
+var b = a + 255`,
+			true,
+			"uint8",
+		},
+		{`
+var a uint8 = 200
+var b = a + 256`,
 			false,
 			"",
 		},
 		{`
-func a[T, K](x T, y K) T {
-	return x + y
-}
-var x = a[float32, float32](4, 5)`,
+var a [0xFF]int
+var b [255]int = a`,
 			true,
-			"float32",
+			"[255]int",
 		},
 		{`
-func a[T, K](x T, y K) T {
-	return x + y // Error, can't add float32 and string
+var a [0b1010]int
+var b [10]int = a`,
+			true,
+			"[10]int",
+		},
+	})
 }
-var x = a[float32, string](4, "s")`,
+
+func TestTypesIntegerOperators(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`var a = 10 % 3`, true, "int"},
+		{`var a = 10.0 % 3.0`, false, ""},
+		{`
+var f float64 = 1
+var a = f % 2`,
 			false,
 			"",
 		},
 		{`
-func a[T](x T) T { // a[T] used in a[T]
-	return x + a[T](10)
-}
-var x = a[float32](4)`,
+var i = 7
+var a = i & 2 | 1`,
 			true,
-			"float32",
+			"int",
 		},
 		{`
-func a[T](x T) T {
-	return x
-}
-var x = a[float32]`,
-			true,
-			"func(float32) float32",
+var f = 7.5
+var a = f & 2`,
+			false,
+			"",
 		},
-		{`
-func a[T](x T) T {
-	return x
+	})
 }
-var x func(float32)float32 = a[float32]`,
-			true,
-			"func(float32) float32",
-		},
+
+func TestTypesBareReturn(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
 		{`
-func a[T](x T) T {
+func f() (x int, err error) {
+	x = 1
+	return
+}
+func g() int {
+	x, _ := f()
 	return x
 }
-var x = a(1.2)`,
+var a = g()`,
 			true,
-			"float64",
+			"int",
 		},
 		{`
-func a[T](x ...T) T {
-	return x[0]
+func f() (x int) {
+	if x > 0 {
+		return 2
+	}
+	return
 }
-var x = a(1.2, 2.0)`,
+var a = f()`,
 			true,
-			"float64",
+			"int",
 		},
 		{`
-func a[T](x ...T) T {
-	return x[0]
+func f() int {
+	return
 }
-var x = a(1.2, "b") // "b" can't be used as a float64 literal`,
+var a = f()`,
 			false,
 			"",
 		},
 	})
 }
 
-func TestTypesGenericTypes(t *testing.T) {
+func TestTypesReceiveConditions(t *testing.T) {
 	testVarTypes(t, []typeTestCase{
 		{`
-struct A[T] {
-	func x() T {
+func f(done chan bool) int {
+	if <-done {
 		return 1
 	}
+	return 0
 }
-var a A[int]
-var x = a.x()`,
+var c chan bool
+var a = f(c)`,
 			true,
 			"int",
 		},
 		{`
-struct A[T] {
-	func x() T {
-		return "a"
+type Flag bool
+func f(done <-chan Flag) int {
+	for <-done {
+		return 1
 	}
+	return 0
 }
-struct B[T] {
-	func y() T {
-		var a A[T]
-		return a.x()
-	}
-}
-var b B[string]
-var x = b.y()`,
+var c <-chan Flag
+var a = f(c)`,
 			true,
-			"string",
+			"int",
 		},
 		{`
-struct A[T] {
-	func x() T {
-		return "a"
-	}
-}
-struct B[T] {
-	func y(a A[T]) T {
-		return a.x()
+func f(done chan int) int {
+	if <-done {
+		return 1
 	}
+	return 0
 }
-var a A[string], b B[string]
-var x = b.y(a)`,
-			true,
-			"string",
+var c chan int
+var a = f(c)`,
+			false,
+			"",
 		},
 		{`
-struct A[T] {
-	func x() T {
-		return 11.2
+func f(done chan string) int {
+	for <-done {
+		return 1
 	}
+	return 0
 }
-func x[T](a A[T]) T {
-	return a.x()
+var c chan string
+var a = f(c)`,
+			false,
+			"",
+		},
+	})
 }
-var a A[float32]
-var x = x(a)`,
+
+func TestTypesNamedBoolOperands(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+type Flag bool
+var flag Flag
+var ok bool
+var a = flag && ok`,
 			true,
-			"float32",
+			"bool",
 		},
 		{`
-struct A[T] {
-	func x() T {
-		return 11
+type Flag bool
+var flag Flag
+var a = flag || true`,
+			true,
+			"Flag",
+		},
+		{`
+type Flag bool
+func f(flag Flag, ok bool) int {
+	if flag && ok {
+		return 1
 	}
+	if flag {
+		return 2
+	}
+	return 0
 }
-interface I {
-	func x() float32
-}
-var a A[float32]
-var i I = a
-var x = i`,
+var a = f(true, false)`,
 			true,
-			"I",
+			"int",
 		},
 		{`
-struct A[T] {
-	func x() T {
-		return 11
+type Num int
+var n Num
+var ok bool
+var a = ok && n`,
+			false,
+			"",
+		},
+		{`
+type Num int
+func f(n Num, ok bool) {
+	if n && ok {
+		pass
 	}
 }
-interface I {
-	func x() float32
-}
-var a A[int]
-var i I = a // Error: x() returns int, not float32
-var x = i`,
+var a = 1`,
 			false,
-			"I",
+			"",
 		},
 	})
 }
 
-func TestTypesSimple(t *testing.T) {
-	var cases = []struct {
-		code       string
-		shouldPass bool
-		typ        string
-	}{
-		{`var a int = 1`,
+func TestTypesShiftCounts(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+var x = 1
+var a = x << 3`,
 			true,
 			"int",
 		},
-		{`var a *int = &1`,
+		{`
+var x int8 = 1
+var s uint = 2
+var a = x >> s`,
 			true,
-			"*int",
+			"int8",
 		},
-		{`var a int = *&1`,
+		{`var a = 1 << (2 + 1)`, true, "int"},
+		{`
+var x = 1
+var a = x << -1`,
+			false,
+			"",
+		},
+		{`
+var x = 1
+var a = x << 1.5`,
+			false,
+			"",
+		},
+		{`
+var x = 1
+var a = x << 1.0`,
 			true,
 			"int",
 		},
-		{`var a = &*&1`,
+		{`
+var x = 1
+var a = x << 2.0 * 1.5`,
 			true,
-			"*int",
+			"int",
 		},
-		{`var a *int = *1`,
+		{`
+var x = 1
+var a = x << -1.0`,
 			false,
 			"",
 		},
-		{`var a = &1`,
-			true,
-			"*int",
-		},
-		{`var a string = "reksio"`,
-			true,
-			"string",
+		{`
+var x = 1
+var s = 2
+var a = x << s`,
+			false,
+			"",
 		},
-		{`var a bool = true`,
-			true,
-			"bool",
+		{`
+var x = 1.5
+var a = x << 2`,
+			false,
+			"",
 		},
-		{`var a bool = false`,
+	})
+}
+
+func TestTypesConstConversion(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+type Weekday int
+const (
+	Sunday Weekday = iota
+	Monday
+)
+var a = Monday`,
 			true,
-			"bool",
+			"Weekday",
 		},
-		{`var a = true`,
+		{`
+const x = int64(5)
+var a = x`,
 			true,
-			"bool",
+			"int64",
 		},
-		{`var a = "blabla"`,
+		{`
+const x = int64(5)
+const y = x * 2
+var a = y`,
 			true,
-			"string",
+			"int64",
 		},
-		{`var a = 123`,
+		{`
+const x = int8(100)
+const y = x + 27
+var a = y`,
 			true,
-			"int",
-		},
-		{`var a string = 1`,
-			false,
-			"", // whatever, shouldn't pass anwyay
+			"int8",
 		},
-		{`var a int = "123"`,
+		{`
+const x = int8(100)
+const y = x * 2
+var a = y`,
 			false,
-			"", // whatever, shouldn't pass anwyay
+			"",
 		},
-		{`var a bool = 0`,
+		{`
+const x = int64(5)
+var y int32 = 1
+const z = x + y
+var a = z`,
 			false,
-			"", // whatever, shouldn't pass anwyay
-		},
-		{
-			`var a []int = {1, 2, 3}`,
-			true,
-			"[]int",
-		},
-		{
-			`var a [3]int = {1, 2, 3}`,
-			true,
-			"[3]int",
+			"",
 		},
-		{
-			`var a [2]int = {1, 2, 3}`,
-			false,
+		{`
+const x = int8(100)
+const y = 1 + x * 2 - 100
+var a = y`,
+			false, // x * 2 overflows int8, even though the result would fit
 			"",
 		},
-		{
-			`var a []int = {1, "2", 3}`,
-			false,
+		{`
+const x = int64(1) << 40
+const y = 1 + x * x - x
+var a = y`,
+			false, // x * x overflows int64
 			"",
 		},
-		{
-			`var a []int = {}`,
+		{`
+const x = int64(1) << 40
+const y = 1 + x * 2 - x
+var a = y`,
 			true,
-			"[]int",
+			"int64",
 		},
-		{
-			`var a [][]int = {{1}, {1,2}, {}}`,
+		{`
+const c = 5
+var a float64 = c`,
 			true,
-			"[][]int",
-		},
-		{
-			`var a [][]int = {{1}, {1,2}, {"1"}}`,
-			false,
-			"",
+			"float64",
 		},
-		{
-			`var a = {1, 2, 3}`,
+		{`
+const c = 5
+var a = c`,
 			true,
-			"[]int",
+			"int",
 		},
-		{
-			`var a = {"bla", "2", "3"}`,
+		{`
+const big = 1 << 100
+const small = big >> 98
+var a = small`,
 			true,
-			"[]string",
+			"int",
 		},
-		{
-			`var a = {"bla", "2", 3}`,
+		{`
+const big = 1 << 100
+var a = big`,
+			false, // The default type int can't represent big
+			"",
+		},
+		{`
+const c = 300
+var a int8 = c`,
 			false,
 			"",
 		},
-		{
-			`var a = {{"bla", "2"}, {"3"}}`,
-			true,
-			"[][]string",
+		{`
+const c = 5
+var a string = c`,
+			false,
+			"",
 		},
-		{
-			`var a = {{"bla", "2"}, {3}}`,
+		{`
+const c = 1.5
+var a int = c`,
 			false,
 			"",
 		},
-		{
-			`var a map[int]string = {1: "a", 2: "b"}`,
-			true,
-			"map[int]string",
+		{`
+const c int = 5
+var a float64 = c`,
+			false, // Typed constants aren't converted implicitly
+			"",
 		},
-		{
-			`var a = {1: "a", 2: "b"}`,
+		{`
+const c = 100 * 2 / 4
+var a int8 = c`,
 			true,
-			"map[int]string",
+			"int8",
 		},
-		{
-			`var a = {1: {"a"}, 2: {"b", "c"}}`,
+		{`
+var a = int8(1000)`,
+			false,
+			"",
+		},
+		{`
+const c = 2.0
+var a int = c`,
 			true,
-			"map[int][]string",
+			"int",
 		},
-		{
-			`var a map[int]string = {1: "a", "2": "b"}`,
+		{`
+const c = 2.5
+var a int = c`,
 			false,
 			"",
 		},
-		{
-			`var a map[int]string = {1: "a", 2: 3}`,
+		{`
+const c = 1.5 * 2
+var a int8 = c`,
+			true,
+			"int8",
+		},
+		{`
+const c = 1e3
+var a int8 = c`,
 			false,
 			"",
 		},
-		{
-			`var a int = 2 + 2`,
+		{`
+const c = -200 + 100
+var a int8 = c`,
 			true,
-			"int",
+			"int8",
 		},
-		{
-			`var a = 2 + 2`,
+		{`
+const big = 1 << 511
+const a = 1 + (big >> 600) + (0 << 5000) + (-big >> 5000)`,
 			true,
 			"int",
 		},
-		{
-			`var a int = 2 + {1}`,
-			false,
+	})
+}
+
+func TestTypesOrdered(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`var a, b int
+var c = a < b`,
+			true,
+			"bool",
+		},
+		{`var a, b int8
+var c = a < b`,
+			true,
+			"bool",
+		},
+		{`var a, b byte
+var c = a < b`,
+			true,
+			"bool",
+		},
+		{`var a, b rune
+var c = a < b`,
+			true,
+			"bool",
+		},
+		{`var a, b string
+var c = a < b`,
+			true,
+			"bool",
+		},
+		{`var a, b float64
+var c = a < b`,
+			true,
+			"bool",
+		},
+		{`
+type t int
+var a, b t
+var c = a < b`,
+			true,
+			"bool",
+		},
+		{`var a, b bool
+var c = a < b`,
+			false,
+			"",
+		},
+		{`
+type t bool
+var a, b t
+var c = a < b`,
+			false,
+			"",
+		},
+		{`var a, b uint8
+var c = a > b`,
+			true,
+			"bool",
+		},
+		{`var a, b float32
+var c = a >= b`,
+			true,
+			"bool",
+		},
+		{`var a, b uint64
+var c = a <= b`,
+			true,
+			"bool",
+		},
+		{`var a, b complex128
+var c = a < b`,
+			false,
+			"",
+		},
+		{`var a, b []int
+var c = a < b`,
+			false,
+			"",
+		},
+		{`
+struct s { x int }
+var a, b s
+var c = a < b`,
+			false,
+			"",
+		},
+	})
+}
+
+func TestTypesComparability(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`var a, b bool
+var c = a == b`,
+			true,
+			"bool",
+		},
+		{`var a, b int
+var c = a == b`,
+			true,
+			"bool",
+		},
+		{`var a, b *int
+var c = a == b`,
+			true,
+			"bool",
+		},
+		{`var a, b chan int
+var c = a == b`,
+			true,
+			"bool",
+		},
+		{`var a, b interface{}
+var c = a == b`,
+			true,
+			"bool",
+		},
+		{`struct S { v []int }
+var i interface{}
+var c = i == S{}`,
+			false,
+			"",
+		},
+		{`struct S { v int }
+var i interface{}
+var c = S{} == i`,
+			true,
+			"bool",
+		},
+		{`var i interface{}
+var s []int
+var c = s != i`,
+			false,
+			"",
+		},
+		{`struct S { v []int }
+var i interface{}
+func f() {
+	switch i {
+	case S{}:
+		pass
+	}
+}
+var c = 1`,
+			false,
+			"",
+		},
+		{`
+interface I{ func f() }
+struct S { func f() { pass } }
+var a I, b S	
+var c = a == b`,
+			true,
+			"bool",
+		},
+		{`
+interface I{ func f() }
+struct S{}// S doesn't implement I, so S and I aren't comparable
+var a I, b S	
+var c = a == b`,
+			false,
+			"",
+		},
+		{`
+struct S{ x int }
+var a, b S
+var c = a == b`,
+			true,
+			"bool",
+		},
+		{`
+struct S{ x []int } // []int aren't comparable, so S isn't comparable
+var a, b S
+var c = a == b`,
+			false,
+			"",
+		},
+		{`
+var a, b [1]int
+var c = a == b`,
+			true,
+			"bool",
+		},
+		{`
+var a, b [1][]int // slices aren't comparable, so arrays of them aren't too
+var c = a == b`,
+			false,
+			"bool",
+		},
+		{`var x, y func()
+var y = x == y // Functions aren't comparable`,
+			false,
+			"",
+		},
+		{`var x map[string]int
+var y = x == nil // Special case, can compare to nil`,
+			true,
+			"bool",
+		},
+		{`var x []int
+var y = x == nil // Special case, can compare to nil`,
+			true,
+			"bool",
+		},
+		{`var x func()
+var y = x == nil // Special case, can compare to nil`,
+			true,
+			"bool",
+		},
+		{`
+struct Point { x, y int }
+var a, b [2]Point
+var c = a == b`,
+			true,
+			"bool",
+		},
+		{`
+struct S { l []int }
+var a, b [2]S
+var c = a == b`,
+			false,
+			"",
+		},
+		{`
+struct P { x int }
+struct S { p [3]P }
+var a, b [2]S
+var c = a == b`,
+			true,
+			"bool",
+		},
+		{`
+type M map[string]int
+struct S { m M }
+var a, b S
+var c = a == b`,
+			false,
+			"",
+		},
+	})
+}
+
+func TestTypesNil(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`var a *int = nil`,
+			true,
+			"*int",
+		},
+		{`
+interface A {
+	func x()
+}
+var a A = nil`,
+			true,
+			"A",
+		},
+		{`
+interface A {
+	func x()
+}
+var a = A(nil)`,
+			true,
+			"A",
+		},
+		{`
+var a interface {
+	func x()
+} = nil`,
+			true,
+			"interface{x()}",
+		},
+		{`var a map[string]int = nil`,
+			true,
+			"map[string]int",
+		},
+		{`var a []int = nil`,
+			true,
+			"[]int",
+		},
+		{`var a chan int = nil`,
+			true,
+			"chan int",
+		},
+		{`var a func(int) bool = nil`,
+			true,
+			"func(int) bool",
+		},
+		{`
+type SendChan chan<- int
+var a = SendChan(nil)`,
+			true,
+			"SendChan",
+		},
+		{`var a int = nil`,
+			false,
+			"",
+		},
+		{`var a string = nil`,
+			false,
+			"",
+		},
+		{`
+struct A {
+	x int
+}
+var a A = nil`,
+			false,
+			"",
+		},
+		{`var a *int = nil
+var b = a == nil`,
+			true,
+			"bool",
+		},
+		{`
+var a, b error
+var c = a == b`,
+			true,
+			"bool",
+		},
+		{`
+interface I { func f() }
+var a, b I
+var c = a != b`,
+			true,
+			"bool",
+		},
+		{`
+interface I { func f() }
+interface J { func g() }
+var a I, b J
+var c = a == b // Neither interface implements the other`,
+			false,
+			"",
+		},
+		{`
+interface I { func f() }
+interface J {
+	func f()
+	func g()
+}
+var a I, b J
+var c = a == b // J implements I`,
+			true,
+			"bool",
+		},
+	})
+}
+
+func TestIsAssignableNil(t *testing.T) {
+	nilType := &UnknownType{fromNil: true}
+	for _, to := range []Type{
+		&PointerType{To: &SimpleType{SIMPLE_TYPE_INT}},
+		&IfaceType{},
+		&MapType{By: &SimpleType{SIMPLE_TYPE_STRING}, Of: &SimpleType{SIMPLE_TYPE_INT}},
+		&SliceType{Of: &SimpleType{SIMPLE_TYPE_INT}},
+		&ChanType{Of: &SimpleType{SIMPLE_TYPE_INT}},
+		&FuncType{},
+	} {
+		if !IsAssignable(to, nilType) {
+			t.Fatalf("nil wasn't assignable to %s", to)
+		}
+	}
+	for _, to := range []Type{
+		&SimpleType{SIMPLE_TYPE_INT},
+		&SimpleType{SIMPLE_TYPE_STRING},
+		&ArrayType{Of: &SimpleType{SIMPLE_TYPE_INT}, Size: 2},
+		&StructType{},
+	} {
+		if IsAssignable(to, nilType) {
+			t.Fatalf("nil was assignable to %s", to)
+		}
+	}
+}
+
+func TestTypesCompareLiterals(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`var x []int
+var y = x == {1, 2, 3} // slices aren't comparable`,
+			false,
+			"",
+		},
+		{`var x []int
+var y = x == {1, "bla", 3}`,
+			false,
+			"",
+		},
+		{`var x []int
+var y = x == nil // as a special case, slices/maps/functions can be compared to nil`,
+			true,
+			"bool",
+		},
+		{`var x []int
+var y = nil == x`,
+			true,
+			"bool",
+		},
+		{`var y = nil == nil`,
+			false,
+			"",
+		},
+		{`var x map[string]int
+var y = x == {"a": 1, "b": 2, "c": 3} // maps aren't comparable`,
+			false,
+			"",
+		},
+		{`var x map[string]int
+var y = x == {1, 2, 3}`,
+			false,
+			"",
+		},
+	})
+}
+
+func TestTypesIndices(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`var x []int
+var y = x[0]`,
+			true,
+			"int",
+		},
+		{`var x [7]int
+var y = x[0]`,
+			true,
+			"int",
+		},
+		{`var x [7]int
+var y = 5 == x[0]`,
+			true,
+			"bool",
+		},
+		{`var y = 5 == {1,2,3,4}[0]`,
+			true,
+			"bool",
+		},
+		{`var y = "lala"[0]`,
+			true,
+			"byte",
+		},
+		{`var x = &([3]int{0,1,2})
+var y = x[0]`,
+			true,
+			"int",
+		},
+		{`var x = &([]int{0,1,2})
+var y = x[0]`,
+			false,
+			"",
+		},
+		{`var x map[string]int
+var y = x["bla"]`,
+			true,
+			"int",
+		},
+		{`var x map[string]int
+var y = x[5]`,
+			false,
+			"",
+		},
+		{`var x []int
+var y, z = x[0]
+var a = y`,
+			false,
+			"",
+		},
+		{`var x map[string]int
+var y, z = x["a"]
+var a = y`,
+			true,
+			"int",
+		},
+		{`var x map[string]int
+var y, z = x["a"]
+var a = z`,
+			true,
+			"bool",
+		},
+		{`var x map[string]float32
+var y int, z bool
+y, z = x["a"]
+var a = y`,
+			false,
+			"",
+		},
+		{`var x map[string]int
+func f(a int, b bool) int:
+	pass
+var a = f(x["b"])`,
+			false,
+			"",
+		},
+		{`var x map[string]int
+var y int, z bool 
+y, z = x["a"]
+var a = y`,
+			true,
+			"int",
+		},
+		{`var x map[string]int
+var y int, z bool
+y, z = x["a"]
+var a = z`,
+			true,
+			"bool",
+		},
+		{`var x map[string]int
+var y, z int
+y, z = x["a"]
+var a = z`,
+			false,
+			"",
+		},
+		{`var x []int
+var y = x[1:5]`,
+			true,
+			"[]int",
+		},
+		{`var x [7]int
+var y = x[1:5]`,
+			true,
+			"[]int",
+		},
+		{`var x string
+var y = x[1:5]`,
+			true,
+			"[]byte",
+		},
+		{`var x *[7]int
+var y = x[1:5]`,
+			true,
+			"[]int",
+		},
+		{`var x *[]int
+var y = x[1:5]`,
+			false,
+			"",
+		},
+		{`var x int
+var y = x[1:5]`,
+			false,
+			"",
+		},
+		{`struct Item {
+	vals [][]float32
+	func Vals() [][]float32 {
+		return self.vals
+	}
+}
+struct Row {
+	Field Item
+}
+var data []Row
+var y = data[0].Field.Vals()[1]`,
+			true,
+			"[]float32",
+		},
+		{`struct Item {
+	vals [][]float32
+	func Vals() [][]float32 {
+		return self.vals
+	}
+}
+struct Row {
+	Field *Item
+}
+var data map[string][]*Row
+var y = data["a"][2].Field.Vals()[1][0] + 1`,
+			true,
+			"float32",
+		},
+		{`struct Item {
+	vals []string
+	func Vals() []string {
+		return self.vals
+	}
+}
+struct Row {
+	Field Item
+}
+var data []Row
+var y = data[0].Field.Vals()["a"]`,
+			false,
+			"",
+		},
+		{`struct Item {
+	vals []string
+	func Vals() []string {
+		return self.vals
+	}
+}
+struct Row {
+	Field Item
+}
+var data []Row
+var y = data[0].Field.Vals()[0][1].Bla`,
+			false,
+			"",
+		},
+	})
+}
+
+func TestTypesGenericFunc(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+func a[T]() int { // Something very simple for start
+	return 1
+}
+var x = a[float32]()`,
+			true,
+			"int",
+		},
+		{`
+func a[T]() T {
+	return 1
+}
+var x = a[float32]()`,
+			true,
+			"float32",
+		},
+		{`
+func a[T](x T) T {
+	return 1 + x
+}
+var x = a[float32](4)`,
+			true,
+			"float32",
+		},
+		{`
+func a[T](x T) T { // Trying to add string literal "aaa" to float32
+	return "aaa" + x
+}
+var x = a[float32](4)`,
+			false,
+			"",
+		},
+		{`
+func a[T, K](x T, y K) T {
+	return x + y
+}
+var x = a[float32, float32](4, 5)`,
+			true,
+			"float32",
+		},
+		{`
+func a[T, K](x T, y K) T {
+	return x + y // Error, can't add float32 and string
+}
+var x = a[float32, string](4, "s")`,
+			false,
+			"",
+		},
+		{`
+func a[T](x T) T { // a[T] used in a[T]
+	return x + a[T](10)
+}
+var x = a[float32](4)`,
+			true,
+			"float32",
+		},
+		{`
+func a[T](x T) T {
+	return x
+}
+var x = a[float32]`,
+			true,
+			"func(float32) float32",
+		},
+		{`
+func a[T](x T) T {
+	return x
+}
+var x func(float32)float32 = a[float32]`,
+			true,
+			"func(float32) float32",
+		},
+		{`
+func a[T](x T) T {
+	return x
+}
+var x = a(1.2)`,
+			true,
+			"float64",
+		},
+		{`
+func a[T](x ...T) T {
+	return x[0]
+}
+var x = a(1.2, 2.0)`,
+			true,
+			"float64",
+		},
+		{`
+func a[T](x ...T) T {
+	return x[0]
+}
+var x = a(1.2, "b") // "b" can't be used as a float64 literal`,
+			false,
+			"",
+		},
+		{`
+func a[T](x T) T {
+	return x
+}
+var x = a[int]("s") // Explicit type argument doesn't match the value`,
+			false,
+			"",
+		},
+		{`
+func a[T](x T) T {
+	return x
+}
+var s string
+var x = a[int](s)`,
+			false,
+			"",
+		},
+		{`
+func a[T](x T) T {
+	return x
+}
+var x = a[int, string](1) // Too many type arguments`,
+			false,
+			"",
+		},
+		{`
+func id[T](x T) T {
+	return x
+}
+var s string
+var x = id(s)`,
+			true,
+			"string",
+		},
+		{`
+func Map[T, U](xs []T, f func(T) U) []U {
+	var res []U
+	for var i, x range xs {
+		res[i] = f(x)
+	}
+	return res
+}
+func toStr(x int) string {
+	return "a"
+}
+var x = Map([]int{1, 2, 3}, toStr)`,
+			true,
+			"[]string",
+		},
+		{`
+func Map[T, U](xs []T, f func(T) U) []U {
+	var res []U
+	for var i, x range xs {
+		res[i] = f(x)
+	}
+	return res
+}
+func First[T](xs []T) T {
+	return xs[0]
+}
+func toStr(x int) string {
+	return "a"
+}
+var xs []int
+var x = First(Map(xs, toStr))`,
+			true,
+			"string",
+		},
+		{`
+func id[T](x T) T {
+	return x
+}
+var x = id(id(1.5))`,
+			true,
+			"float64",
+		},
+		{`
+func id[T](x T) T {
+	return x
+}
+func First[T](xs []T) T {
+	return xs[0]
+}
+var x = First(id(1)) // id(1) isn't a slice`,
+			false,
+			"",
+		},
+		{`
+func zero[T]() T {
+	var x T
+	return x
+}
+var x = zero() // T appears only in the result`,
+			false,
+			"",
+		},
+		{`
+func zero[T]() T {
+	var x T
+	return x
+}
+var x = zero[int]()`,
+			true,
+			"int",
+		},
+	})
+}
+
+func TestTypesGenericTypes(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+struct A[T] {
+	func x() T {
+		return 1
+	}
+}
+var a A[int]
+var x = a.x()`,
+			true,
+			"int",
+		},
+		{`
+struct A[T] {
+	func x() T {
+		return "a"
+	}
+}
+struct B[T] {
+	func y() T {
+		var a A[T]
+		return a.x()
+	}
+}
+var b B[string]
+var x = b.y()`,
+			true,
+			"string",
+		},
+		{`
+struct A[T] {
+	func x() T {
+		return "a"
+	}
+}
+struct B[T] {
+	func y(a A[T]) T {
+		return a.x()
+	}
+}
+var a A[string], b B[string]
+var x = b.y(a)`,
+			true,
+			"string",
+		},
+		{`
+struct A[T] {
+	func x() T {
+		return 11.2
+	}
+}
+func x[T](a A[T]) T {
+	return a.x()
+}
+var a A[float32]
+var x = x(a)`,
+			true,
+			"float32",
+		},
+		{`
+struct A[T] {
+	func x() T {
+		return 11
+	}
+}
+interface I {
+	func x() float32
+}
+var a A[float32]
+var i I = a
+var x = i`,
+			true,
+			"I",
+		},
+		{`
+struct A[T] {
+	func x() T {
+		return 11
+	}
+}
+interface I {
+	func x() float32
+}
+var a A[int]
+var i I = a // Error: x() returns int, not float32
+var x = i`,
+			false,
+			"I",
+		},
+		{`
+struct Stack[T] {
+	items []T
+}
+var s Stack[int]
+var x = s.items`,
+			true,
+			"[]int",
+		},
+		{`
+struct Stack[T] {
+	items []T
+	func top() T {
+		return self.items[0]
+	}
+}
+var s Stack[string]
+var x = s.top()`,
+			true,
+			"string",
+		},
+		{`
+struct Stack[T] {
+	items []T
+}
+var s Stack[int]
+var x []string = s.items // Error: items is []int`,
+			false,
+			"",
+		},
+		{`
+struct Stack[T] {
+	items []T
+	func *push(x T) {
+		self.items[0] = x
+	}
+	func pop() T {
+		return self.items[0]
+	}
+}
+var s Stack[int], v int
+s.push(v)
+var x = s.pop()`,
+			true,
+			"int",
+		},
+		{`
+struct Stack[T] {
+	items []T
+	func *push(x T) {
+		self.items[0] = x
+	}
+}
+var s Stack[int], v string
+s.push(v) // Error: push takes int
+var x = s`,
+			false,
+			"",
+		},
+		{`
+struct Stack[T] {
+	items []T
+	func *push(x T) {
+		var y T = "a" // Error when T is int
+		self.items[0] = x
+	}
+}
+var s Stack[int]
+var x = s`,
+			false,
+			"",
+		},
+	})
+}
+
+func TestTypesGenericConstraints(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+interface Small {
+	~int | ~int8
+	~int8 | ~uint8
+}
+func id[T Small](a T) T {
+	return a
+}
+var a int8
+var x = id(a)`,
+			true,
+			"int8",
+		},
+		{`
+interface Small {
+	~int | ~int8
+	~int8 | ~uint8
+}
+func id[T Small](a T) T {
+	return a
+}
+var a int
+var x = id(a) // Lines of a type set are intersected`,
+			false,
+			"",
+		},
+		{`
+interface Number {
+	~int | ~float64
+}
+interface MyNumber {
+	Number
+}
+func sum[T MyNumber](a, b T) T {
+	return a + b
+}
+var x = sum[string]("a", "b") // Type set of the embedded interface applies`,
+			false,
+			"",
+		},
+		{`
+interface Number {
+	~int | ~float64
+}
+interface MyNumber {
+	Number
+}
+func sum[T MyNumber](a, b T) T {
+	return a + b
+}
+var a, b float64
+var x = sum(a, b)`,
+			true,
+			"float64",
+		},
+		{`
+interface Number {
+	~int | ~float64
+}
+func sum[T Number](a, b T) T {
+	return a + b
+}
+var x = sum[int](1, 2)`,
+			true,
+			"int",
+		},
+		{`
+interface Number {
+	~int | ~float64
+}
+func sum[T Number](a, b T) T {
+	return a + b
+}
+var x = sum[string]("a", "b") // string doesn't satisfy Number`,
+			false,
+			"",
+		},
+		{`
+interface Number {
+	~int | ~float64
+}
+func sum[T Number](a, b T) T {
+	return a + b
+}
+var a, b float64
+var x = sum(a, b)`,
+			true,
+			"float64",
+		},
+		{`
+interface Number {
+	~int | ~float64
+}
+type MyInt int
+func sum[T Number](a, b T) T {
+	return a + b
+}
+var a, b MyInt
+var x = sum(a, b)`,
+			true,
+			"MyInt",
+		},
+		{`
+interface Integer {
+	int | int64
+}
+type MyInt int
+func id[T Integer](a T) T {
+	return a
+}
+var a MyInt
+var x = id(a) // No ~, so only int and int64 are allowed`,
+			false,
+			"",
+		},
+		{`
+interface Number {
+	~int | ~float64
+}
+struct Box[T Number] {
+	val T
+}
+var b Box[float64]
+var x = b.val`,
+			true,
+			"float64",
+		},
+		{`
+interface Number {
+	~int | ~float64
+}
+struct Box[T Number] {
+	val T
+}
+var b Box[string]
+var x = b.val`,
+			false,
+			"",
+		},
+		{`
+func set[K comparable](k K) map[K]bool {
+	return map[K]bool{k: true}
+}
+var x = set[string]("a")`,
+			true,
+			"map[string]bool",
+		},
+		{`
+func set[K comparable](k K) map[K]bool {
+	return map[K]bool{k: true}
+}
+var s string
+var x = set(s)`,
+			true,
+			"map[string]bool",
+		},
+		{`
+func set[K comparable](k K) map[K]bool {
+	return map[K]bool{k: true}
+}
+var s []int
+var x = set(s) // Slices aren't comparable`,
+			false,
+			"",
+		},
+		{`
+struct Pair {
+	a, b int
+}
+func eq[T comparable](a, b T) bool {
+	return a == b
+}
+var p Pair
+var x = eq(p, p)`,
+			true,
+			"bool",
+		},
+		{`
+var y any = 1
+var x = y`,
+			true,
+			"any",
+		},
+		{`
+var y any = "a"
+var x any = y`,
+			true,
+			"any",
+		},
+		{`
+func id[T any](x T) T {
+	return x
+}
+var x = id[[]int](nil)`,
+			true,
+			"[]int",
+		},
+		{`var x comparable // Only allowed as a constraint`,
+			false,
+			"",
+		},
+		{`var x []comparable`,
+			false,
+			"",
+		},
+	})
+}
+
+func TestTypesSimple(t *testing.T) {
+	var cases = []struct {
+		code       string
+		shouldPass bool
+		typ        string
+	}{
+		{`var a int = 1`,
+			true,
+			"int",
+		},
+		{`var a *int = &1`,
+			true,
+			"*int",
+		},
+		{`var a int = *&1`,
+			true,
+			"int",
+		},
+		{`var a = &*&1`,
+			true,
+			"*int",
+		},
+		{`var a *int = *1`,
+			false,
+			"",
+		},
+		{`var a = &1`,
+			true,
+			"*int",
+		},
+		{`var a string = "reksio"`,
+			true,
+			"string",
+		},
+		{`var a bool = true`,
+			true,
+			"bool",
+		},
+		{`var a bool = false`,
+			true,
+			"bool",
+		},
+		{`var a = true`,
+			true,
+			"bool",
+		},
+		{`var a = "blabla"`,
+			true,
+			"string",
+		},
+		{`var a = 123`,
+			true,
+			"int",
+		},
+		{`var a string = 1`,
+			false,
+			"", // whatever, shouldn't pass anwyay
+		},
+		{`var a int = "123"`,
+			false,
+			"", // whatever, shouldn't pass anwyay
+		},
+		{`var a bool = 0`,
+			false,
+			"", // whatever, shouldn't pass anwyay
+		},
+		{
+			`var a []int = {1, 2, 3}`,
+			true,
+			"[]int",
+		},
+		{
+			`var a [3]int = {1, 2, 3}`,
+			true,
+			"[3]int",
+		},
+		{
+			`var a [2]int = {1, 2, 3}`,
+			false,
+			"",
+		},
+		{
+			`var a [3]int = [...]int{1, 2, 3}`,
+			true,
+			"[3]int",
+		},
+		{
+			`var a [4]int = [...]int{1, 2, 3}`,
+			false,
+			"",
+		},
+		{
+			`var a = [...]string{"a", "b"}`,
+			true,
+			"[2]string",
+		},
+		{
+			`var a = [...][2]int{{1, 2}, {3, 4}, {5, 6}}`,
+			true,
+			"[3][2]int",
+		},
+		{
+			`var a = []float64{1, 2, 3}`,
+			true,
+			"[]float64",
+		},
+		{
+			`var a = []float64{1, 2.5}`,
+			true,
+			"[]float64",
+		},
+		{
+			`var a = []byte{65, 66}`,
+			true,
+			"[]byte",
+		},
+		{
+			`var a = []byte{65, 256}`,
+			false,
+			"",
+		},
+		{
+			`var a = []int{1, 2.5}`,
+			false,
+			"",
+		},
+		{
+			`var a []int = {1, "2", 3}`,
+			false,
+			"",
+		},
+		{
+			`var a []int = {}`,
+			true,
+			"[]int",
+		},
+		{
+			`var a [][]int = {{1}, {1,2}, {}}`,
+			true,
+			"[][]int",
+		},
+		{
+			`var a [][]int = {{1}, {1,2}, {"1"}}`,
+			false,
+			"",
+		},
+		{
+			`var a = {1, 2, 3}`,
+			true,
+			"[]int",
+		},
+		{
+			`var a = {"bla", "2", "3"}`,
+			true,
+			"[]string",
+		},
+		{
+			`var a = {"bla", "2", 3}`,
+			false,
+			"",
+		},
+		{
+			`var a = {{"bla", "2"}, {"3"}}`,
+			true,
+			"[][]string",
+		},
+		{
+			`var a = {{"bla", "2"}, {3}}`,
+			false,
+			"",
+		},
+		{
+			`var a map[int]string = {1: "a", 2: "b"}`,
+			true,
+			"map[int]string",
+		},
+		{
+			`var a = {1: "a", 2: "b"}`,
+			true,
+			"map[int]string",
+		},
+		{
+			`var a = {1: {"a"}, 2: {"b", "c"}}`,
+			true,
+			"map[int][]string",
+		},
+		{
+			`var a map[int]string = {1: "a", "2": "b"}`,
+			false,
+			"",
+		},
+		{
+			`var a map[int]string = {1: "a", 2: 3}`,
+			false,
+			"",
+		},
+		{
+			`var a int = 2 + 2`,
+			true,
+			"int",
+		},
+		{
+			`var a = 2 + 2`,
+			true,
+			"int",
+		},
+		{
+			`var a int = 2 + {1}`,
+			false,
+			"",
+		},
+		{
+			`var a = 2 + {1}`,
+			false,
+			"",
+		},
+		{
+			`var a int = +2`,
+			true,
+			"int",
+		},
+		{
+			`var a = +2`,
+			true,
+			"int",
+		},
+	}
+
+	for i, c := range cases {
+		if *justCase >= 0 && i != *justCase {
+			continue
+		}
+		parser := newTestParser(c.code)
+		result, err := parser.parseVarStmt(true)
+		if err != nil {
+			t.Fail()
+			fmt.Printf("Case %d: Failed parsing: %s\n", i, err)
+		}
+		ctx := NewTypesContext()
+		err = result.Vars[0].NegotiateTypes(ctx)
+
+		if (err == nil) != c.shouldPass {
+			t.Fail()
+			fmt.Printf("Case %d: Bad code accepted or good code parsed with an error for '%s'\nError: %s\n",
+				i, c.code, err)
+			continue
+		}
+
+		if err == nil {
+			firstDecl := result.Vars[0]
+
+			firstVar, firstInit := firstDecl.Vars[0], Expr(nil)
+			if len(firstDecl.Inits) > 0 {
+				firstInit = firstDecl.Inits[0]
+			}
+
+			fit, err := firstInit.(TypedExpr).Type(ctx)
+			if firstVar.Type.String() != c.typ || fit.String() != c.typ || err != nil {
+				t.Fail()
+				fmt.Printf("Case %d: Bad type: %s, %s, %s\n", i, c.typ, firstVar.Type.String(),
+					fit.String())
+				fmt.Printf("Code:\n%s\n", c.code)
+			}
+		}
+	}
+}
+
+func TestGenericFuncDeduction(t *testing.T) {
+	cases := []struct {
+		code, want, err string
+	}{
+		{`
+var x int
+func f[T](arg T) T {
+	pass
+}
+f(x)`,
+			"f[int]",
+			"",
+		},
+		{`
+func f[T](arg T) T {
+	pass
+}
+f(1)`,
+			"f[int]",
+			"",
+		},
+		{`
+var x int
+func f[T](a1, a2 T) T {
+	pass
+}
+f(x, 1)`,
+			"f[int]",
+			"",
+		},
+		{`
+var x float32
+func f[T](a1, a2 T) T {
+	pass
+}
+f(x, 1)`,
+			"f[float32]",
+			"",
+		},
+		{`
+var x float32
+func f[T](a1, a2 T) T {
+	pass
+}
+f(x, "aaa")`,
+			"f[float32]",
+			"Can't use a string literal as float32",
+		},
+		{`
+var x float32
+func f[T](a1, a2 T) T {
+	pass
+}
+f("aaa", "a")`,
+			"f[string]",
+			"",
+		},
+		{`
+var x int
+func f[T](arg *T) T {
+	pass
+}
+f(&x)`,
+			"f[int]",
+			"",
+		},
+		{`
+var x map[string]float32
+func f[T, K](arg map[T]K) T {
+	pass
+}
+f(x)`,
+			"f[string, float32]",
+			"",
+		},
+		{`
+var x []float32
+func f[T](arg []T) T {
+	pass
+}
+f(x)`,
+			"f[float32]",
+			"",
+		},
+		{`
+var x map[*int][]float32
+func f[T, K](arg map[T]K) T {
+	pass
+}
+f(x)`,
+			"f[*int, []float32]",
+			"",
+		},
+		{`
+var x map[*int][]float32
+func f[T, K](arg map[*T][]K) T {
+	pass
+}
+f(x)`,
+			"f[int, float32]",
+			"",
+		},
+		{`
+var x func(int)int
+func f[T](arg func(T)T) T {
+	pass
+}
+f(x)`,
+			"f[int]",
+			"",
+		},
+		{`
+var x int
+var y string
+func f[T](a1, a2 T) T {
+	pass
+}
+f(x, y)`,
+			"",
+			"T can't be both int and string",
+		},
+		{`
+func f[T](a1, a2 T) T {
+	pass
+}
+f(1, "aaa")`,
+			"",
+			"T can't be both int and string",
+		},
+	}
+
+	for i, c := range cases {
+		if *justCase >= 0 && i != *justCase {
+			continue
+		}
+
+		pkg, _, errs := processFileAsPkg(strings.TrimSpace(c.code))
+
+		var err error
+		if len(errs) > 0 {
+			err = errs[0]
+		}
+
+		tc := pkg.tc
+
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Fatalf("Case %d: Didn't return error containing `%s`, but `%s`", i, c.err, err)
+			} else {
+				continue
+			}
+		}
+
+		if len(tc.instantiations) != 1 {
+			t.Fatalf("Case %d: Unexpected number of instantiations: %d", i, len(tc.instantiations))
+		}
+
+		for k := range tc.instantiations {
+			if string(k) != c.want {
+				t.Fatalf("Case %d: Deduced wrong arguments: %s instead of %s", i, k, c.want)
+			}
+		}
+	}
+}
+
+func TestTypesExprStmt(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+func f() {
+    pass
+}
+f()
+var placeholder int = 0`,
+			true,
+			"int",
+		},
+		{`
+func f[T]() {
+    pass
+}
+f[int]()
+var placeholder int = 0`,
+			true,
+			"int",
+		},
+		{`
+func f[T](a T) {
+    pass
+}
+f(1)
+var placeholder int = 0`,
+			true,
+			"int",
+		},
+		{`
+if true {
+	1 + 1 // Error: expression evaluated but not used (it's only checked for blocks ATM)
+}
+var placeholder int = 0`,
+			false,
+			"",
+		},
+	})
+}
+
+func TestTypesWhenStmt(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+func f[T]() {
+	when int {
+	is int:
+		pass
+	}
+}
+f[int]()
+var placeholder int = 0`,
+			true,
+			"int",
+		},
+		{`
+func f[T]() {
+	when int {
+	implements int: // Error: not an interface: int
+		pass
+	}
+}
+f[int]()
+var placeholder int = 0`,
+			false,
+			"",
+		},
+		{`
+func f[T]() {
+	when T {
+	implements interface{}:
+		pass
+	}
+}
+f[int]()
+var placeholder int = 0`,
+			true,
+			"int",
+		},
+		{`
+func f[T]() {
+	when T {
+	is int:
+		var x int = "test" // Fail, "test" can't be int
+	}
+}
+f[int]()
+var placeholder int = 0`,
+			false,
+			"",
+		},
+		{`
+func f[T]() {
+	when T {
+	is int:
+		var x int = "test" // "test" can't be int, but this branch isn't typechecked
+	}
+}
+f[string]()
+var placeholder int = 0`,
+			true,
+			"int",
+		},
+		{`
+func f[T, K]() {
+	when K, T, int {
+	implements interface{}, is string, float32:
+		pass
+	}
+}
+f[int, string]()
+var placeholder int = 0`,
+			true,
+			"int",
+		},
+	})
+}
+
+/*
+func TestTypesLateIdentLookup(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+var a A
+struct A:
+	pass
+var b = a
+`,
+			true,
+			"A",
+		},
+	})
+}
+*/
+
+func TestTypesConversionsInReturn(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+func trunc(v float64) int {
+	return int(v)
+}
+var a = trunc(1.5)`,
+			true,
+			"int",
+		},
+		{`
+func widen(v int) (float64, bool) {
+	return float64(v), true
+}
+var a, b = widen(1)
+var c = a`,
+			true,
+			"float64",
+		},
+		{`
+func trunc(v float64) int {
+	return float32(v)
+}
+var a = trunc(1.5)`,
+			false,
+			"",
+		},
+		{`
+func parse(v string) int {
+	return int(v)
+}
+var a = parse("1")`,
+			false,
+			"",
+		},
+	})
+}
+
+func TestTypesUnnamedCompositeAssignability(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+var a []struct{X int}
+var b []struct{X int} = a`,
+			true,
+			"[]struct {X int}",
+		},
+		{`
+var a map[string]struct{X []int}
+var b map[string]struct{X []int} = a`,
+			true,
+			"map[string]struct {X []int}",
+		},
+		{`
+var a [2]struct{X int; Y string}
+var b [2]struct{X int; Y string} = a`,
+			true,
+			"[2]struct {X int; Y string}",
+		},
+		{`
+var a []struct{X int}
+var b []struct{Y int} = a`,
+			false,
+			"",
+		},
+		{`
+var a []struct{X int}
+var b []struct{X string} = a`,
+			false,
+			"",
+		},
+		{`
+var a []byte
+var b []uint8 = a`,
+			true,
+			"[]uint8",
+		},
+		{`
+var a map[rune][]byte
+var b map[int32][]uint8 = a`,
+			true,
+			"map[int32][]uint8",
+		},
+		{`
+var a func([]rune) *byte
+var b func([]int32) *uint8 = a`,
+			true,
+			"func([]int32) *uint8",
+		},
+		{`
+var a []struct{X []byte}
+var b []struct{X []uint8} = a`,
+			true,
+			"[]struct {X []uint8}",
+		},
+		{`
+var a []byte
+var b []int8 = a`,
+			false,
+			"",
+		},
+	})
+}
+
+func TestTypesBoolConversions(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`var a = bool(true)`, true, "bool"},
+		{`var a = int(true)`, false, ""},
+		{`var a = bool(1)`, false, ""},
+		{`
+var b = true
+var a = int(b)`,
+			false,
 			"",
 		},
-		{
-			`var a = 2 + {1}`,
+		{`
+var i = 1
+var a = bool(i)`,
 			false,
 			"",
 		},
-		{
-			`var a int = +2`,
+	})
+}
+
+func TestTypesCallOrConversion(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+type blah int
+var a = blah(123)`,
+			true,
+			"blah",
+		},
+		{`
+func blah(x int) string {
+	return "a"
+}
+var a = blah(123)`,
+			true,
+			"string",
+		},
+		{`var a = blah(123)`, false, ""},
+		{`
+var blah = 1
+var a = blah(123)`,
+			false,
+			"",
+		},
+	})
+}
+
+func TestTypesChanConversions(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+type IntChan chan int
+var c chan int
+var a = IntChan(c)`,
+			true,
+			"IntChan",
+		},
+		{`
+type IntChan chan int
+var c IntChan
+var a = ((chan int)(c))`,
+			true,
+			"chan int",
+		},
+		{`
+type IntChan chan int
+var c chan int
+var a IntChan = c`,
+			true,
+			"IntChan",
+		},
+		{`
+type IntChan chan int
+var c IntChan
+var a = ((chan string)(c))`,
+			false,
+			"",
+		},
+		{`
+type IntChan chan int
+type OtherChan chan int
+var c IntChan
+var a = OtherChan(c)`,
+			true,
+			"OtherChan",
+		},
+		{`
+type IntChan chan int
+type OtherChan chan int
+var c IntChan
+var a OtherChan = c`,
+			false,
+			"",
+		},
+		{`
+var c chan int
+var a <-chan int = c
+var b = a`,
+			true,
+			"<-chan int",
+		},
+		{`
+var c <-chan int
+var a chan int = c`,
+			false,
+			"",
+		},
+		{`
+type RecvChan <-chan int
+var c chan int
+var a RecvChan = c
+var b = a`,
+			true,
+			"RecvChan",
+		},
+		{`
+type RecvChan <-chan int
+var c <-chan int
+var r RecvChan = c
+var a <-chan int = r`,
+			true,
+			"<-chan int",
+		},
+		{`
+type RecvChan <-chan int
+var c chan<- int
+var a RecvChan = c`,
+			false,
+			"",
+		},
+		{`
+type RecvChan <-chan int
+type BiChan chan int
+var c BiChan
+var a RecvChan = c`,
+			false,
+			"",
+		},
+	})
+}
+
+func TestTypesConversions(t *testing.T) {
+	testVarTypes(t, []typeTestCase{
+		{`
+struct Node { x int }
+type NodePtr *Node
+var n *Node
+var a = NodePtr(n)`,
+			true,
+			"NodePtr",
+		},
+		{`
+struct Node { x int }
+type NodePtr *Node
+var n NodePtr
+var a = ((*Node)(n))`,
+			true,
+			"*Node",
+		},
+		{`
+struct Node { x int }
+struct Other { x int }
+type NodePtr *Node
+var n NodePtr
+var a = ((*Other)(n)) // Named pointer types don't use the pointer base type rule`,
+			false,
+			"",
+		},
+		{`
+struct Node { x int }
+struct Other { y string }
+var n *Node
+var a = ((*Other)(n))`,
+			false,
+			"",
+		},
+		{`
+var arr [3]int
+var a = ((*[3]int)(arr))`,
+			false,
+			"",
+		},
+		{`
+var b []byte
+var a = string(b)`,
+			true,
+			"string",
+		},
+		{`
+var a = []rune("foo")`,
+			true,
+			"[]rune",
+		},
+		{`
+var s string
+var a = []byte(s)`,
+			true,
+			"[]byte",
+		},
+		{`
+var a = string(65)`,
+			true,
+			"string",
+		},
+		{`
+type letter rune
+type word string
+var l []letter
+var a = word(l)`,
+			true,
+			"word",
+		},
+		{`
+var a = []int("foo")`,
+			false,
+			"",
+		},
+		{`
+var f float64
+var a = string(f)`,
+			false,
+			"",
+		},
+		{`
+var a = int(1.5)`,
+			false,
+			"",
+		},
+		{`
+struct A { x []byte }
+struct B { x []uint8 }
+var a A
+var b = B(a)`,
+			true,
+			"B",
+		},
+		{`
+struct A { x map[rune]byte }
+struct B { x map[int32]uint8 }
+var a *A
+var b = ((*B)(a))`,
+			true,
+			"*B",
+		},
+		{`
+struct A { x []byte }
+struct B { x []int8 }
+var a A
+var b = B(a)`,
+			false,
+			"",
+		},
+		{`
+var i int
+var a = float64(i)`,
+			true,
+			"float64",
+		},
+		{`
+var f float32
+var a = int(f)`,
+			true,
+			"int",
+		},
+		{`
+var c complex128
+var a = complex64(c)`,
+			true,
+			"complex64",
+		},
+		{`
+var c complex128
+var a = float64(c)`,
+			false,
+			"",
+		},
+		{`
+var f float64
+var a = complex128(f)`,
+			false,
+			"",
+		},
+		{`
+var bytes []byte
+var a = int(bytes[0])`,
+			true,
+			"int",
+		},
+		{`
+var str string
+var a = rune(str[0])`,
+			true,
+			"rune",
+		},
+		{`
+var arr [3]int
+var i = 1
+var a = float64(arr[i])`,
+			true,
+			"float64",
+		},
+		{`
+var m map[string]uint8
+var a = int64(m["x"])`,
+			true,
+			"int64",
+		},
+		{`
+var arr [3]string
+var a = int(arr[1])`,
+			false,
+			"",
+		},
+		{`
+var arr4 [4]int
+var a = [3]int(arr4)`,
+			false,
+			"",
+		},
+		{`
+var arr3 [3]int
+var a = [3]int(arr3)`,
+			true,
+			"[3]int",
+		},
+		{`
+type Triple [3]int
+var arr3 [3]int
+var a = Triple(arr3)`,
+			true,
+			"Triple",
+		},
+		{`
+type Triple [3]int
+var arr4 [4]int
+var a = Triple(arr4)`,
+			false,
+			"",
+		},
+		{`
+struct Stack[T] {
+	items []T
+}
+var a Stack[int]
+var x Stack[int] = a`,
+			true,
+			"Stack[int]",
+		},
+		{`
+struct Stack[T] {
+	items []T
+}
+var a Stack[int]
+var x Stack[string] = a`,
+			false,
+			"",
+		},
+		{`
+struct Stack[T] {
+	items []T
+}
+var a Stack[int]
+var x = Stack[string](a)`,
+			false,
+			"",
+		},
+		{`
+struct Stack[T] {
+	items []T
+}
+struct IntStack {
+	items []int
+}
+var a IntStack
+var x = Stack[int](a)`,
+			true,
+			"Stack[int]",
+		},
+		{`
+struct Stack[T] {
+	items []T
+}
+struct IntStack {
+	items []int
+}
+var a Stack[int]
+var x = IntStack(a) // Same underlying type`,
+			true,
+			"IntStack",
+		},
+		{`
+struct A { X int }
+struct B { X int }
+var b B
+var x = A(b)`,
+			true,
+			"A",
+		},
+		{`
+struct A {
+	X int
+	Y string
+}
+struct B {
+	func f() {
+		pass
+	}
+	X int
+	Y string
+}
+var a A
+var x = B(a) // Methods don't matter`,
+			true,
+			"B",
+		},
+		{`
+struct A { X int }
+struct B { Y int }
+var b B
+var x = A(b) // Different field names`,
+			false,
+			"",
+		},
+		{`
+struct A {
+	X int
+	Y int
+}
+struct B {
+	Y int
+	X int
+}
+var b B
+var x = A(b) // Different field order`,
+			false,
+			"",
+		},
+		{`
+var arr [3]int
+var a = &arr`,
+			true,
+			"*[3]int",
+		},
+		{`
+var xs []int
+var a = [3]int(xs)`,
+			true,
+			"[3]int",
+		},
+		{`
+var xs []int
+var a = ((*[3]int)(xs))`,
+			true,
+			"*[3]int",
+		},
+		{`
+var xs []int
+var a = [3]string(xs) // Element types don't match`,
+			false,
+			"",
+		},
+		{`
+var xs []int
+var a = ((*[3]int64)(xs))`,
+			false,
+			"",
+		},
+		{`
+type Ints []int
+var xs Ints
+var a = [2]int(xs)`,
 			true,
-			"int",
+			"[2]int",
 		},
-		{
-			`var a = +2`,
+		{`
+type Arr3Ptr *[3]int
+var xs []int
+var a = Arr3Ptr(xs)`,
 			true,
-			"int",
+			"Arr3Ptr",
 		},
-	}
+		{`
+type Arr3Ptr *[3]string
+var xs []int
+var a = Arr3Ptr(xs) // Element types don't match`,
+			false,
+			"",
+		},
+	})
+}
+
+type warningTestCase struct {
+	code string
+	// Tells whether the warning is enabled.
+	warnMode bool
+	warnings int
+}
 
+// Checks how many warnings are reported for each case, `enable` turns the
+// tested warning on for cases with warnMode set.
+func testWarnings(t *testing.T, cases []warningTestCase, enable func(tc *TypesContext)) {
 	for i, c := range cases {
 		if *justCase >= 0 && i != *justCase {
 			continue
 		}
-		parser := newTestParser(c.code)
-		result, err := parser.parseVarStmt(true)
-		if err != nil {
-			t.Fail()
-			fmt.Printf("Case %d: Failed parsing: %s\n", i, err)
+
+		pkg := NewPackage("main", NewFile("main.go", "package main\n"+c.code))
+		if c.warnMode {
+			enable(pkg.tc)
 		}
-		ctx := NewTypesContext()
-		err = result.Vars[0].NegotiateTypes(ctx)
 
-		if (err == nil) != c.shouldPass {
-			t.Fail()
-			fmt.Printf("Case %d: Bad code accepted or good code parsed with an error for '%s'\nError: %s\n",
-				i, c.code, err)
-			continue
+		if errs := pkg.ParseAndCheck(); len(errs) > 0 {
+			t.Fatalf("Case %d: Unexpected error: %s", i, errs[0])
 		}
 
-		if err == nil {
-			firstDecl := result.Vars[0]
+		if len(pkg.Warnings()) != c.warnings {
+			t.Fatalf("Case %d: Got %d warnings instead of %d: %v", i, len(pkg.Warnings()), c.warnings, pkg.Warnings())
+		}
+	}
+}
 
-			firstVar, firstInit := firstDecl.Vars[0], Expr(nil)
-			if len(firstDecl.Inits) > 0 {
-				firstInit = firstDecl.Inits[0]
-			}
+func TestParseWarnings(t *testing.T) {
+	ws, err := ParseWarnings("float-eq, dead-cases")
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+	if !ws.Has(WARN_FLOAT_EQUALITY) || !ws.Has(WARN_DEAD_CASES) || ws.Has(WARN_NIL_DEREF) {
+		t.Fatalf("Wrong set of warnings: %b", ws)
+	}
 
-			fit, err := firstInit.(TypedExpr).Type(ctx)
-			if firstVar.Type.String() != c.typ || fit.String() != c.typ || err != nil {
-				t.Fail()
-				fmt.Printf("Case %d: Bad type: %s, %s, %s\n", i, c.typ, firstVar.Type.String(),
-					fit.String())
-				fmt.Printf("Code:\n%s\n", c.code)
-			}
-		}
+	ws, err = ParseWarnings("all")
+	if err != nil || !ws.Has(WARN_SELF_ASSIGN) || !ws.Has(WARN_RECOVER_OUTSIDE_DEFER) {
+		t.Fatalf("Not all warnings enabled: %b, %v", ws, err)
+	}
+
+	if _, err := ParseWarnings("float-eq,nope"); err == nil {
+		t.Fatalf("Unknown warning accepted")
 	}
 }
 
-func TestGenericFuncDeduction(t *testing.T) {
-	cases := []struct {
-		code, want, err string
-	}{
-		{`
-var x int
-func f[T](arg T) T {
-	pass
+func TestTypesFloatEqualityWarning(t *testing.T) {
+	testWarnings(t, []warningTestCase{
+		{`var a, b float64
+var c = a == b`,
+			true,
+			1,
+		},
+		{`var a, b float64
+var c = a == b`,
+			false,
+			0,
+		},
+		{`var a, b complex64
+var c = a != b`,
+			true,
+			1,
+		},
+		{`var a, b float32
+var c = a < b // Ordering is fine`,
+			true,
+			0,
+		},
+		{`var a, b int
+var c = a == b`,
+			true,
+			0,
+		},
+	}, func(tc *TypesContext) { tc.enabledWarnings |= WARN_FLOAT_EQUALITY })
 }
-f(x)`,
-			"f[int]",
-			"",
+
+func TestTypesRecoverWarning(t *testing.T) {
+	testWarnings(t, []warningTestCase{
+		{`
+func f() {
+	recover()
+}`,
+			true,
+			1,
 		},
 		{`
-func f[T](arg T) T {
-	pass
-}
-f(1)`,
-			"f[int]",
-			"",
+func f() {
+	recover()
+}`,
+			false,
+			0,
 		},
 		{`
-var x int
-func f[T](a1, a2 T) T {
-	pass
-}
-f(x, 1)`,
-			"f[int]",
-			"",
+func f() {
+	defer func() {
+		recover()
+	}()
+}`,
+			true,
+			0,
 		},
 		{`
-var x float32
-func f[T](a1, a2 T) T {
-	pass
+func handler() {
+	recover()
 }
-f(x, 1)`,
-			"f[float32]",
-			"",
+func f() {
+	defer handler()
+}`,
+			true,
+			0,
 		},
 		{`
-var x float32
-func f[T](a1, a2 T) T {
-	pass
-}
-f(x, "aaa")`,
-			"f[float32]",
-			"Can't use this literal for type float32",
+func f() {
+	defer func() {
+		var g = func() {
+			recover() // Not called directly by the deferred function
+		}
+		g()
+	}()
+}`,
+			true,
+			1,
 		},
 		{`
-var x float32
-func f[T](a1, a2 T) T {
-	pass
-}
-f("aaa", "a")`,
-			"f[string]",
-			"",
+func f() {
+	defer recover()
+}`,
+			true,
+			1,
 		},
 		{`
-var x int
-func f[T](arg *T) T {
-	pass
+func f() {
+	func recover() interface{} {
+		return nil
+	}
+	recover() // Shadows the builtin
+}`,
+			true,
+			0,
+		},
+	}, func(tc *TypesContext) { tc.enabledWarnings |= WARN_RECOVER_OUTSIDE_DEFER })
 }
-f(&x)`,
-			"f[int]",
-			"",
+
+func TestTypesUnreachableWarning(t *testing.T) {
+	testWarnings(t, []warningTestCase{
+		{`
+func f() int {
+	return 1
+	var x = 2
+}`,
+			true,
+			1,
 		},
 		{`
-var x map[string]float32
-func f[T, K](arg map[T]K) T {
-	pass
-}
-f(x)`,
-			"f[string, float32]",
-			"",
+func f() int {
+	return 1
+	var x = 2
+}`,
+			false,
+			0,
 		},
 		{`
-var x []float32
-func f[T](arg []T) T {
+func f() {
+	outer:
+	for var i = 0; i < 10; i += 1 {
+		for var j = 0; j < 10; j += 1 {
+			if j > i {
+				continue outer
+			}
+		}
+		return
+	}
+}`,
+			true,
+			0,
+		},
+		{`
+func f() {
+	for var i = 0; i < 10; i += 1 {
+		for var j = 0; j < 10; j += 1 {
+			if j > i {
+				continue
+			}
+		}
+		return
+	}
+}`,
+			true,
+			1,
+		},
+		{`
+func f(x int) int {
+	if x > 0 {
+		return 1
+	}
+}`,
+			true,
+			1,
+		},
+		{`
+func f(x int) int {
+	if x > 0 {
+		return 1
+	} else {
+		panic("negative")
+	}
+}`,
+			true,
+			0,
+		},
+		{`
+func f(x int) int {
+	for ;; {
+		if x > 0 {
+			return x
+		}
+	}
+}`,
+			true,
+			0,
+		},
+		{`
+func f(x int) int {
+	for ;; {
+		if x > 0 {
+			break
+		}
+	}
+}`,
+			true,
+			1,
+		},
+		{`
+func f(x int) int {
+	switch x {
+	case 1:
+		return 1
+	default:
+		return 0
+	}
+}`,
+			true,
+			0,
+		},
+		{`
+func f() int {
 	pass
+}`,
+			true,
+			0,
+		},
+	}, func(tc *TypesContext) { tc.enabledWarnings |= WARN_UNREACHABLE })
 }
-f(x)`,
-			"f[float32]",
-			"",
+
+func TestTypesNilDerefWarning(t *testing.T) {
+	testWarnings(t, []warningTestCase{
+		{`
+func f() {
+	var p *int
+	x := *p
+}`,
+			true,
+			1,
+		},
+		{`
+func f() {
+	var p *int
+	x := *p
+}`,
+			false,
+			0,
+		},
+		{`
+func f() {
+	var p *int
+	var i = 1
+	p = &i
+	x := *p
+}`,
+			true,
+			0,
+		},
+		{`
+func f() {
+	var p *int = nil
+	var q *int
+	var r = &q
+	x := *p + **r
+}`,
+			true,
+			0,
+		},
+		{`
+func f() {
+	var i int
+	var p = &i
+	x := *p
+}`,
+			true,
+			0,
+		},
+		{`
+func f() {
+	var p *int
+	if p != nil {
+		x := *p
+	}
+}`,
+			true,
+			0,
+		},
+		{`
+func f(b bool) {
+	var p *int
+	var i int
+	if b {
+		p = &i
+	}
+	x := *p
+}`,
+			true,
+			0,
+		},
+		{`
+func f() {
+	var p *int
+	var g = func() {
+		x := *p
+	}
+	var i int
+	p = &i
+	g()
+}`,
+			true,
+			0,
 		},
 		{`
-var x map[*int][]float32
-func f[T, K](arg map[T]K) T {
-	pass
+func f(b bool) {
+	if b {
+		var p *int
+		x := *p
+	}
+}`,
+			true,
+			1,
+		},
+	}, func(tc *TypesContext) { tc.enabledWarnings |= WARN_NIL_DEREF })
 }
-f(x)`,
-			"f[*int, []float32]",
-			"",
+
+func TestTypesErrorfBuiltin(t *testing.T) {
+	cases := []struct {
+		code    string
+		builtin bool
+		pass    bool
+	}{
+		{`
+func f(x int) error {
+	return errorf("bad value %d of %s", x, "f")
+}`,
+			true,
+			true,
 		},
 		{`
-var x map[*int][]float32
-func f[T, K](arg map[*T][]K) T {
-	pass
-}
-f(x)`,
-			"f[int, float32]",
-			"",
+func f() {
+	var err = errorf("no args")
+	print(err.Error())
+}`,
+			true,
+			true,
 		},
 		{`
-var x func(int)int
-func f[T](arg func(T)T) T {
-	pass
-}
-f(x)`,
-			"f[int]",
-			"",
+func f() error {
+	return errorf(1)
+}`,
+			true,
+			false,
 		},
 		{`
-var x int
-var y string
-func f[T](a1, a2 T) T {
-	pass
-}
-f(x, y)`,
-			"",
-			"T can't be both int and string",
+func f() int {
+	return errorf("not an int")
+}`,
+			true,
+			false,
 		},
 		{`
-func f[T](a1, a2 T) T {
-	pass
-}
-f(1, "aaa")`,
-			"",
-			"T can't be both int and string",
+func f() error {
+	return errorf("not registered")
+}`,
+			false,
+			false,
 		},
 	}
 
 	for i, c := range cases {
-		if *justCase >= 0 && i != *justCase {
-			continue
-		}
-
-		pkg, _, errs := processFileAsPkg(strings.TrimSpace(c.code))
-
-		var err error
-		if len(errs) > 0 {
-			err = errs[0]
-		}
-
-		tc := pkg.tc
-
-		if c.err != "" {
-			if err == nil || !strings.Contains(err.Error(), c.err) {
-				t.Fatalf("Case %d: Didn't return error containing `%s`, but `%s`", i, c.err, err)
-			} else {
-				continue
-			}
-		}
-
-		if len(tc.instantiations) != 1 {
-			t.Fatalf("Case %d: Unexpected number of instantiations: %d", i, len(tc.instantiations))
-		}
-
-		for k := range tc.instantiations {
-			if string(k) != c.want {
-				t.Fatalf("Case %d: Deduced wrong arguments: %s instead of %s", i, k, c.want)
-			}
+		pkg := NewPackage("main", NewFile("main.go", "package main\n"+c.code))
+		pkg.builtinErrorf = c.builtin
+		errs := pkg.ParseAndCheck()
+		if (len(errs) == 0) != c.pass {
+			t.Errorf("case %d: unexpected errors: %v", i, errs)
 		}
 	}
 }
 
-func TestTypesExprStmt(t *testing.T) {
-	testVarTypes(t, []typeTestCase{
+func TestTypesSelfAssignWarning(t *testing.T) {
+	testWarnings(t, []warningTestCase{
 		{`
 func f() {
-    pass
-}
-f()
-var placeholder int = 0`,
+	var x, y int
+	x = x
+}`,
 			true,
-			"int",
+			1,
 		},
 		{`
-func f[T]() {
-    pass
-}
-f[int]()
-var placeholder int = 0`,
+func f() {
+	var x, y int
+	x = x
+}`,
+			false,
+			0,
+		},
+		{`
+func f() {
+	var x, y int
+	x = y
+	x += x
+}`,
 			true,
-			"int",
+			0,
 		},
 		{`
-func f[T](a T) {
-    pass
-}
-f(1)
-var placeholder int = 0`,
+struct T { a []int }
+func f() {
+	var t T
+	var i = 0
+	t.a[i] = t.a[i]
+	t.a[i] = t.a[i+1]
+}`,
 			true,
-			"int",
+			1,
 		},
 		{`
-if true {
-	1 + 1 // Error: expression evaluated but not used (it's only checked for blocks ATM)
+func f() {
+	var x, y int
+	x, y = y, x
+	x, y = x, 2
+}`,
+			true,
+			1,
+		},
+	}, func(tc *TypesContext) { tc.enabledWarnings |= WARN_SELF_ASSIGN })
 }
-var placeholder int = 0`,
+
+func TestTypesSelfCompareWarning(t *testing.T) {
+	testWarnings(t, []warningTestCase{
+		{`
+func f(x int) bool {
+	return x == x
+}`,
+			true,
+			1,
+		},
+		{`
+func f(x int) bool {
+	return x == x
+}`,
 			false,
-			"",
+			0,
 		},
-	})
+		{`
+func f(x, y int) bool {
+	return x == y
+}`,
+			true,
+			0,
+		},
+		{`
+struct T { a []int }
+func f(t T, i int) bool {
+	if t.a[i] > t.a[i] {
+		return true
+	}
+	return t.a[i] < t.a[i+1]
+}`,
+			true,
+			1,
+		},
+		{`
+func f(x float64) bool {
+	return x != x // NaN check
+}`,
+			true,
+			0,
+		},
+		{`
+func f() bool {
+	return 1 == 1
+}`,
+			true,
+			0,
+		},
+	}, func(tc *TypesContext) { tc.enabledWarnings |= WARN_SELF_COMPARE })
 }
 
-func TestTypesWhenStmt(t *testing.T) {
-	testVarTypes(t, []typeTestCase{
+func TestTypesDeadCasesWarning(t *testing.T) {
+	testWarnings(t, []warningTestCase{
 		{`
-func f[T]() {
-	when int {
-	is int:
+func f(x int) {
+	switch {
+	case true:
+		pass
+	case x > 1:
 		pass
 	}
-}
-f[int]()
-var placeholder int = 0`,
+}`,
 			true,
-			"int",
+			1,
 		},
 		{`
-func f[T]() {
-	when int {
-	implements int: // Error: not an interface: int
+func f(x int) {
+	switch {
+	case true:
+		pass
+	case x > 1:
 		pass
 	}
-}
-f[int]()
-var placeholder int = 0`,
+}`,
 			false,
-			"",
+			0,
 		},
 		{`
-func f[T]() {
-	when T {
-	implements interface{}:
+func f(x int) {
+	switch {
+	case x > 1:
+		pass
+	case x > 0:
+		pass
+	default:
 		pass
 	}
-}
-f[int]()
-var placeholder int = 0`,
+}`,
 			true,
-			"int",
+			0,
 		},
 		{`
-func f[T]() {
-	when T {
-	is int:
-		var x int = "test" // Fail, "test" can't be int
+const limit = 10
+func f(x int) {
+	switch {
+	case limit < 5:
+		pass
+	case x > 1:
+		pass
+	case limit >= 10 && true:
+		pass
+	case x > 0:
+		pass
 	}
-}
-f[int]()
-var placeholder int = 0`,
-			false,
-			"",
+}`,
+			true,
+			2,
 		},
 		{`
-func f[T]() {
-	when T {
-	is int:
-		var x int = "test" // "test" can't be int, but this branch isn't typechecked
+const mode = 2
+func f() {
+	switch mode {
+	case 1:
+		pass
+	case 2:
+		pass
+	case 3:
+		pass
 	}
-}
-f[string]()
-var placeholder int = 0`,
+}`,
 			true,
-			"int",
+			2,
 		},
 		{`
-func f[T, K]() {
-	when K, T, int {
-	implements interface{}, is string, float32:
+func f(mode int) {
+	switch mode {
+	case 1:
+		pass
+	case 2:
 		pass
 	}
-}
-f[int, string]()
-var placeholder int = 0`,
+}`,
 			true,
-			"int",
+			0,
 		},
-	})
+	}, func(tc *TypesContext) { tc.enabledWarnings |= WARN_DEAD_CASES })
 }
 
-/*
-func TestTypesLateIdentLookup(t *testing.T) {
-	testVarTypes(t, []typeTestCase{
-		{`
-var a A
-struct A:
-	pass
-var b = a
-`,
-			true,
-			"A",
-		},
-	})
+func TestTypesNestingDepthLimit(t *testing.T) {
+	cases := []struct {
+		terms    int
+		maxDepth int
+		pass     bool
+	}{
+		{10, 50, true},
+		{100, 50, false},
+		{1000, DefaultMaxNestingDepth, true},
+	}
+
+	for i, c := range cases {
+		code := "package main\nvar x = 1" + strings.Repeat(" + 1", c.terms)
+
+		pkg := NewPackage("main", NewFile("main.go", code))
+		pkg.tc.maxDepth = c.maxDepth
+
+		errs := pkg.ParseAndCheck()
+		if c.pass && len(errs) > 0 {
+			t.Fatalf("Case %d: Unexpected error: %s", i, errs[0])
+		}
+		if !c.pass && (len(errs) == 0 || errs[0].Error() != "Expression too deeply nested") {
+			t.Fatalf("Case %d: Expected the nesting error, got: %v", i, errs)
+		}
+	}
+}
+
+func TestTypesNestingDepthLimitSelectors(t *testing.T) {
+	// The parser reads selector chains in a loop, so only the typer sees
+	// how deeply they nest.
+	cases := []struct {
+		selectors int
+		pass      bool
+	}{
+		{10, true},
+		{100, false},
+	}
+
+	for i, c := range cases {
+		code := "package main\ntype T0 struct {\n\tv int\n}\n"
+		for j := 1; j <= c.selectors; j++ {
+			code += fmt.Sprintf("type T%d struct {\n\tn T%d\n}\n", j, j-1)
+		}
+		code += fmt.Sprintf("var x T%d\nvar y = x%s.v\n", c.selectors, strings.Repeat(".n", c.selectors))
+
+		pkg := NewPackage("main", NewFile("main.go", code))
+		pkg.tc.maxDepth = 50
+
+		errs := pkg.ParseAndCheck()
+		if c.pass && len(errs) > 0 {
+			t.Fatalf("Case %d: Unexpected error: %s", i, errs[0])
+		}
+		if !c.pass && (len(errs) == 0 || errs[0].Error() != "Expression too deeply nested") {
+			t.Fatalf("Case %d: Expected the nesting error, got: %v", i, errs)
+		}
+	}
 }
-*/